@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Centrality metric names accepted by the analytics API
+const (
+	MetricDegree         = "degree"
+	MetricWeightedDegree = "weighted_degree"
+	MetricBetweenness    = "betweenness"
+	MetricCloseness      = "closeness"
+	MetricEigenvector    = "eigenvector"
+	MetricPageRank       = "pagerank"
+)
+
+var centralityMetrics = map[string]func(*network) map[string]float64{
+	MetricDegree:         (*network).degreeCentrality,
+	MetricWeightedDegree: (*network).weightedDegreeCentrality,
+	MetricBetweenness:    (*network).betweennessCentrality,
+	MetricCloseness:      (*network).closenessCentrality,
+	MetricEigenvector:    (*network).eigenvectorCentrality,
+	MetricPageRank:       (*network).pageRank,
+}
+
+const (
+	pageRankDamping    = 0.85
+	maxIterations      = 100
+	convergenceEpsilon = 1e-9
+)
+
+// CentralityScore is one person's score for a metric
+type CentralityScore struct {
+	ID    string  `json:"id"`
+	Name  string  `json:"name"`
+	Score float64 `json:"score"`
+}
+
+// CentralityMetricNames lists the supported metrics alphabetically
+func CentralityMetricNames() []string {
+	names := make([]string, 0, len(centralityMetrics))
+	for name := range centralityMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ComputeCentrality scores every person with the named metric, highest first
+func ComputeCentrality(store GraphStore, metric string) ([]CentralityScore, error) {
+	compute, ok := centralityMetrics[metric]
+	if !ok {
+		return nil, fmt.Errorf("unknown centrality metric %q", metric)
+	}
+
+	net, err := loadNetwork(store)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := compute(net)
+	results := make([]CentralityScore, 0, len(net.ids))
+	for _, id := range net.ids {
+		results = append(results, CentralityScore{ID: id, Name: net.people[id].Name, Score: scores[id]})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results, nil
+}
+
+// degreeCentrality counts each person's connections
+func (n *network) degreeCentrality() map[string]float64 {
+	scores := make(map[string]float64, len(n.ids))
+	for _, id := range n.ids {
+		scores[id] = float64(len(n.edges[id]))
+	}
+	return scores
+}
+
+// weightedDegreeCentrality sums the strength of each person's connections
+func (n *network) weightedDegreeCentrality() map[string]float64 {
+	scores := make(map[string]float64, len(n.ids))
+	for _, id := range n.ids {
+		for _, conn := range n.edges[id] {
+			scores[id] += float64(conn.Strength)
+		}
+	}
+	return scores
+}
+
+// betweennessCentrality is the normalized fraction of shortest paths passing
+// through each person, computed with Brandes' algorithm
+func (n *network) betweennessCentrality() map[string]float64 {
+	scores := make(map[string]float64, len(n.ids))
+	for _, id := range n.ids {
+		scores[id] = 0
+	}
+
+	for _, source := range n.ids {
+		var stack []string
+		preds := map[string][]string{}
+		sigma := map[string]float64{source: 1}
+		dist := map[string]int{source: 0}
+		queue := []string{source}
+
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			stack = append(stack, v)
+			for _, conn := range n.edges[v] {
+				w := n.other(conn, v)
+				if _, seen := dist[w]; !seen {
+					dist[w] = dist[v] + 1
+					queue = append(queue, w)
+				}
+				if dist[w] == dist[v]+1 {
+					sigma[w] += sigma[v]
+					preds[w] = append(preds[w], v)
+				}
+			}
+		}
+
+		delta := map[string]float64{}
+		for i := len(stack) - 1; i >= 0; i-- {
+			w := stack[i]
+			for _, v := range preds[w] {
+				delta[v] += sigma[v] / sigma[w] * (1 + delta[w])
+			}
+			if w != source {
+				scores[w] += delta[w]
+			}
+		}
+	}
+
+	// Each undirected pair was counted from both ends
+	count := float64(len(n.ids))
+	norm := 0.5
+	if count > 2 {
+		norm = 1 / ((count - 1) * (count - 2))
+	}
+	for id := range scores {
+		scores[id] *= norm
+	}
+	return scores
+}
+
+// closenessCentrality is the inverse average hop distance to everyone a
+// person can reach, scaled by how much of the network they can reach
+// (Wasserman-Faust) so isolated clusters don't score as highly central
+func (n *network) closenessCentrality() map[string]float64 {
+	scores := make(map[string]float64, len(n.ids))
+	total := float64(len(n.ids))
+
+	for _, source := range n.ids {
+		dist := map[string]int{source: 0}
+		queue := []string{source}
+		sum := 0
+
+		for len(queue) > 0 {
+			v := queue[0]
+			queue = queue[1:]
+			for _, conn := range n.edges[v] {
+				w := n.other(conn, v)
+				if _, seen := dist[w]; !seen {
+					dist[w] = dist[v] + 1
+					sum += dist[w]
+					queue = append(queue, w)
+				}
+			}
+		}
+
+		reached := float64(len(dist) - 1)
+		if sum > 0 && total > 1 {
+			scores[source] = (reached / float64(sum)) * (reached / (total - 1))
+		} else {
+			scores[source] = 0
+		}
+	}
+	return scores
+}
+
+// eigenvectorCentrality scores people by the importance of their neighbors,
+// weighting each connection by its strength. Power iteration runs on A+I so
+// it converges on bipartite graphs too.
+func (n *network) eigenvectorCentrality() map[string]float64 {
+	scores := make(map[string]float64, len(n.ids))
+	if len(n.ids) == 0 {
+		return scores
+	}
+	for _, id := range n.ids {
+		scores[id] = 1 / math.Sqrt(float64(len(n.ids)))
+	}
+
+	for iter := 0; iter < maxIterations; iter++ {
+		next := make(map[string]float64, len(n.ids))
+		for _, id := range n.ids {
+			next[id] = scores[id]
+			for _, conn := range n.edges[id] {
+				next[id] += float64(conn.Strength) * scores[n.other(conn, id)]
+			}
+		}
+
+		var norm float64
+		for _, v := range next {
+			norm += v * v
+		}
+		norm = math.Sqrt(norm)
+		if norm == 0 {
+			return next
+		}
+
+		var diff float64
+		for id := range next {
+			next[id] /= norm
+			diff += math.Abs(next[id] - scores[id])
+		}
+		scores = next
+		if diff < convergenceEpsilon*float64(len(n.ids)) {
+			break
+		}
+	}
+	return scores
+}
+
+// pageRank follows connection direction (source -> target), weighted by
+// strength, so rank flows towards the people others point at
+func (n *network) pageRank() map[string]float64 {
+	count := float64(len(n.ids))
+	scores := make(map[string]float64, len(n.ids))
+	if count == 0 {
+		return scores
+	}
+
+	// Outgoing strength per person
+	outWeight := make(map[string]float64, len(n.ids))
+	for _, id := range n.ids {
+		for _, conn := range n.edges[id] {
+			if conn.Source == id {
+				outWeight[id] += float64(conn.Strength)
+			}
+		}
+	}
+
+	for _, id := range n.ids {
+		scores[id] = 1 / count
+	}
+
+	for iter := 0; iter < maxIterations; iter++ {
+		// Rank held by people with no outgoing links is spread evenly
+		var dangling float64
+		for _, id := range n.ids {
+			if outWeight[id] == 0 {
+				dangling += scores[id]
+			}
+		}
+
+		next := make(map[string]float64, len(n.ids))
+		base := (1-pageRankDamping)/count + pageRankDamping*dangling/count
+		for _, id := range n.ids {
+			next[id] = base
+		}
+		for _, id := range n.ids {
+			if outWeight[id] == 0 {
+				continue
+			}
+			for _, conn := range n.edges[id] {
+				if conn.Source == id {
+					next[conn.Target] += pageRankDamping * scores[id] * float64(conn.Strength) / outWeight[id]
+				}
+			}
+		}
+
+		var diff float64
+		for id := range next {
+			diff += math.Abs(next[id] - scores[id])
+		}
+		scores = next
+		if diff < convergenceEpsilon {
+			break
+		}
+	}
+	return scores
+}
+
+// StoreMetric writes scores into each person's Metrics map under name
+func StoreMetric(store GraphStore, name string, scores []CentralityScore) error {
+	for _, score := range scores {
+		if err := store.SetMetric(score.ID, name, score.Score); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestCentrality(t *testing.T) {
+	path := testGraph("a b c d", "a-b", "b-c", "c-d")
+	star := testGraph("hub l1 l2 l3 l4", "l1-hub", "l2-hub:2", "l3-hub:3", "l4-hub:4")
+	bridge := testGraph("a b c d e f", "a-b", "a-c", "b-c", "c-d", "d-e", "d-f", "e-f")
+	components := testGraph("a b c d e", "a-b", "c-d", "d-e")
+	cycle := testGraph("a b c", "a-b", "b-c", "c-a")
+	pair := testGraph("a b", "a-b")
+
+	tests := []struct {
+		name   string
+		metric string
+		graph  GraphData
+		want   map[string]float64
+	}{
+		{"degree of a path", MetricDegree, path, map[string]float64{"a": 1, "b": 2, "c": 2, "d": 1}},
+		{"weighted degree of a star", MetricWeightedDegree, star, map[string]float64{"hub": 10, "l1": 1, "l2": 2, "l3": 3, "l4": 4}},
+
+		// A path's inner people each sit between two pairs out of the three
+		// that don't include them
+		{"betweenness of a path", MetricBetweenness, path, map[string]float64{"a": 0, "b": 2.0 / 3, "c": 2.0 / 3, "d": 0}},
+		{"betweenness of a star", MetricBetweenness, star, map[string]float64{"hub": 1, "l1": 0, "l2": 0, "l3": 0, "l4": 0}},
+		// Six of the ten pairs without c cross the bridge
+		{"betweenness of a bridge", MetricBetweenness, bridge, map[string]float64{"a": 0, "b": 0, "c": 0.6, "d": 0.6, "e": 0, "f": 0}},
+		{"betweenness across components", MetricBetweenness, components, map[string]float64{"a": 0, "b": 0, "c": 0, "d": 1.0 / 6, "e": 0}},
+		{"betweenness of a pair", MetricBetweenness, pair, map[string]float64{"a": 0, "b": 0}},
+
+		{"closeness of a path", MetricCloseness, path, map[string]float64{"a": 0.5, "b": 0.75, "c": 0.75, "d": 0.5}},
+		{"closeness of a star", MetricCloseness, star, map[string]float64{"hub": 1, "l1": 4.0 / 7, "l2": 4.0 / 7, "l3": 4.0 / 7, "l4": 4.0 / 7}},
+		// Scaled by the share of the network each person can reach
+		{"closeness across components", MetricCloseness, components, map[string]float64{"a": 0.25, "b": 0.25, "c": 1.0 / 3, "d": 0.5, "e": 1.0 / 3}},
+
+		// The hub's score is twice each leaf's, and the scores have unit length
+		{"eigenvector of a star", MetricEigenvector, testGraph("hub l1 l2 l3 l4", "l1-hub", "l2-hub", "l3-hub", "l4-hub"),
+			map[string]float64{"hub": math.Sqrt(0.5), "l1": math.Sqrt(0.125), "l2": math.Sqrt(0.125), "l3": math.Sqrt(0.125), "l4": math.Sqrt(0.125)}},
+		{"eigenvector of a cycle", MetricEigenvector, cycle, map[string]float64{"a": 1 / math.Sqrt(3), "b": 1 / math.Sqrt(3), "c": 1 / math.Sqrt(3)}},
+
+		{"pagerank of a cycle", MetricPageRank, cycle, map[string]float64{"a": 1.0 / 3, "b": 1.0 / 3, "c": 1.0 / 3}},
+		// Every leaf links to the hub, which links nowhere, so its rank is
+		// spread evenly: leaf = 0.15/5 + 0.85*hub/5 and hub = leaf + 0.85*4*leaf
+		{"pagerank of a star", MetricPageRank, star, map[string]float64{"hub": 4.4 / 8.4, "l1": 1 / 8.4, "l2": 1 / 8.4, "l3": 1 / 8.4, "l4": 1 / 8.4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := centralityMetrics[tt.metric](newNetwork(tt.graph))
+			if len(got) != len(tt.want) {
+				t.Fatalf("scores = %v, want %v", got, tt.want)
+			}
+			for id, want := range tt.want {
+				if math.Abs(got[id]-want) > 1e-6 {
+					t.Errorf("%s = %v, want %v", id, got[id], want)
+				}
+			}
+		})
+	}
+}
+
+func TestComputeCentralityRanksAndStores(t *testing.T) {
+	store := testStore(t, testGraph("a b c d", "a-b", "b-c", "c-d"))
+	if err := store.SetMetric("b", "pagerank", 0.5); err != nil {
+		t.Fatal(err)
+	}
+
+	scores, err := ComputeCentrality(store, MetricDegree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CentralityScore{{"b", "B", 2}, {"c", "C", 2}, {"a", "A", 1}, {"d", "D", 1}}
+	if !reflect.DeepEqual(scores, want) {
+		t.Fatalf("ComputeCentrality = %v, want %v", scores, want)
+	}
+
+	if err := StoreMetric(store, MetricDegree, scores); err != nil {
+		t.Fatal(err)
+	}
+	person, _ := store.GetPerson("b")
+	if want := map[string]float64{"degree": 2, "pagerank": 0.5}; !reflect.DeepEqual(person.Metrics, want) {
+		t.Errorf("metrics = %v, want %v", person.Metrics, want)
+	}
+
+	if _, err := ComputeCentrality(store, "fame"); err == nil {
+		t.Error("ComputeCentrality accepted an unknown metric")
+	}
+}
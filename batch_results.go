@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+)
+
+// FailureReason classifies why one name in a batch failed, so that clients
+// can tell failures worth retrying from names that need fixing
+type FailureReason string
+
+const (
+	ReasonNotFound       FailureReason = "not_found"      // no article with that name
+	ReasonDisambiguation FailureReason = "disambiguation" // the name is ambiguous
+	ReasonInvalid        FailureReason = "invalid"        // the article doesn't describe a valid person
+	ReasonNetwork        FailureReason = "network"        // Wikipedia couldn't be reached, offline mode is on, or it answered with an error status
+	ReasonParse          FailureReason = "parse"          // Wikipedia's response couldn't be read
+	ReasonUpstream       FailureReason = "upstream"       // Wikipedia reported some other error
+	ReasonStorage        FailureReason = "storage"        // the person couldn't be saved
+	ReasonCanceled       FailureReason = "canceled"       // the job stopped before the name was finished
+)
+
+// failureReason classifies an error from scraping or validating a person
+func failureReason(err error) FailureReason {
+	var validation *ValidationError
+	var netErr net.Error
+	var syntax *json.SyntaxError
+	var unmarshal *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, ErrPageNotFound):
+		return ReasonNotFound
+	case errors.Is(err, ErrDisambiguation):
+		return ReasonDisambiguation
+	case errors.As(err, &validation):
+		return ReasonInvalid
+	case errors.Is(err, context.Canceled):
+		return ReasonCanceled
+	case errors.As(err, &netErr), errors.Is(err, ErrUnexpectedStatus), errors.Is(err, ErrOffline):
+		return ReasonNetwork
+	case errors.As(err, &syntax), errors.As(err, &unmarshal), errors.Is(err, io.ErrUnexpectedEOF):
+		return ReasonParse
+	default:
+		return ReasonUpstream
+	}
+}
+
+// status is the HTTP status a request for the name alone would have had
+func (r FailureReason) status() int {
+	switch r {
+	case ReasonNotFound:
+		return http.StatusNotFound
+	case ReasonDisambiguation:
+		return http.StatusConflict
+	case ReasonInvalid:
+		return http.StatusUnprocessableEntity
+	case ReasonStorage:
+		return http.StatusInternalServerError
+	case ReasonCanceled:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// retryable reports whether submitting the name again may succeed
+func (r FailureReason) retryable() bool {
+	switch r {
+	case ReasonNotFound, ReasonDisambiguation, ReasonInvalid:
+		return false
+	default:
+		return true
+	}
+}
+
+// BatchResult is the outcome for one name in a batch scrape
+type BatchResult struct {
+	Name        string        `json:"name"`
+	Status      int           `json:"status"` // as if the name had been scraped alone
+	Person      *Person       `json:"person,omitempty"`
+	Connections int           `json:"connections"`
+	Reason      FailureReason `json:"reason,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	Retryable   bool          `json:"retryable,omitempty"`
+}
+
+// MultiStatus is a multi-status document reporting every name in a batch
+type MultiStatus struct {
+	JobID     string        `json:"jobId"`
+	State     JobState      `json:"state"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Pending   int           `json:"pending"`
+	Results   []BatchResult `json:"results"`
+	Retry     []string      `json:"retry"` // failed names worth submitting again
+}
+
+// jobResults builds the multi-status document for a job, along with the
+// status of the response: 202 while the job is unfinished, 200 once every
+// name succeeded and 207 otherwise
+func jobResults(job Job) (MultiStatus, int) {
+	doc := MultiStatus{
+		JobID:   job.ID,
+		State:   job.State,
+		Results: make([]BatchResult, 0, len(job.Items)),
+		Retry:   []string{},
+	}
+	for _, item := range job.Items {
+		result := BatchResult{
+			Name:        item.Name,
+			Person:      item.Person,
+			Connections: item.Connections,
+			Error:       item.Error,
+		}
+		switch item.State {
+		case JobDone:
+			result.Status = http.StatusOK
+			doc.Succeeded++
+		case JobFailed, JobCanceled:
+			result.Reason = item.Reason
+			if result.Reason == "" {
+				// Jobs saved before reasons were recorded
+				result.Reason = ReasonUpstream
+			}
+			result.Status = result.Reason.status()
+			result.Retryable = result.Reason.retryable()
+			if result.Retryable {
+				doc.Retry = append(doc.Retry, item.Name)
+			}
+			doc.Failed++
+		default:
+			result.Status = http.StatusAccepted
+			doc.Pending++
+		}
+		doc.Results = append(doc.Results, result)
+	}
+	if job.Summary != nil {
+		// Only the first failures have results; the summary has the totals
+		doc.Succeeded, doc.Failed = job.Summary.Imported, job.Summary.Failed
+	}
+
+	switch {
+	case !job.State.finished():
+		return doc, http.StatusAccepted
+	case doc.Failed == 0:
+		return doc, http.StatusOK
+	default:
+		return doc, http.StatusMultiStatus
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Community detection algorithms accepted by the analytics API
+const (
+	AlgorithmLouvain          = "louvain"
+	AlgorithmLabelPropagation = "label_propagation"
+)
+
+// CommunityOptions controls community detection
+type CommunityOptions struct {
+	Algorithm  string  `json:"algorithm"`  // louvain (default) or label_propagation
+	Resolution float64 `json:"resolution"` // Louvain resolution; >1 favors smaller communities (default 1)
+	Apply      bool    `json:"apply"`      // write each community into Person.Group
+}
+
+// normalize fills in defaults and rejects unknown algorithms
+func (o *CommunityOptions) normalize() error {
+	if o.Algorithm == "" {
+		o.Algorithm = AlgorithmLouvain
+	}
+	if o.Algorithm != AlgorithmLouvain && o.Algorithm != AlgorithmLabelPropagation {
+		return fmt.Errorf("algorithm must be %s or %s", AlgorithmLouvain, AlgorithmLabelPropagation)
+	}
+	if o.Resolution == 0 {
+		o.Resolution = 1
+	}
+	if o.Resolution < 0 {
+		return fmt.Errorf("resolution must be positive")
+	}
+	return nil
+}
+
+// Community is a set of people more densely connected to each other than to
+// the rest of the network
+type Community struct {
+	Group   int      `json:"group"`
+	Size    int      `json:"size"`
+	Members []string `json:"members"`
+}
+
+// CommunityResult is the outcome of a detection run
+type CommunityResult struct {
+	Algorithm   string         `json:"algorithm"`
+	Modularity  float64        `json:"modularity"`
+	Communities []Community    `json:"communities"`
+	Groups      map[string]int `json:"groups"` // person ID -> group
+	Applied     bool           `json:"applied"`
+}
+
+// weightedGraph is a dense-index undirected graph. adj[i][j] holds the total
+// weight between i and j in both directions, so a self-loop counts twice.
+type weightedGraph struct {
+	adj    []map[int]float64
+	degree []float64
+	total  float64 // sum of degrees (twice the total edge weight)
+}
+
+func newWeightedGraph(size int) *weightedGraph {
+	g := &weightedGraph{adj: make([]map[int]float64, size), degree: make([]float64, size)}
+	for i := range g.adj {
+		g.adj[i] = map[int]float64{}
+	}
+	return g
+}
+
+func (g *weightedGraph) addEdge(i, j int, weight float64) {
+	g.adj[i][j] += weight
+	g.adj[j][i] += weight
+	g.degree[i] += weight
+	g.degree[j] += weight
+	g.total += 2 * weight
+}
+
+// weightedGraph builds an undirected graph weighted by connection strength
+func (n *network) weightedGraph() *weightedGraph {
+	index := make(map[string]int, len(n.ids))
+	for i, id := range n.ids {
+		index[id] = i
+	}
+
+	g := newWeightedGraph(len(n.ids))
+	seen := map[string]bool{}
+	for _, id := range n.ids {
+		for _, conn := range n.edges[id] {
+			if seen[conn.ID] {
+				continue
+			}
+			seen[conn.ID] = true
+			weight := float64(conn.Strength)
+			if weight < minStrength {
+				weight = minStrength
+			}
+			g.addEdge(index[conn.Source], index[conn.Target], weight)
+		}
+	}
+	return g
+}
+
+// modularity scores a partition of g at the given resolution
+func (g *weightedGraph) modularity(community []int, resolution float64) float64 {
+	if g.total == 0 {
+		return 0
+	}
+	internal := map[int]float64{}
+	totals := map[int]float64{}
+	for i, neighbors := range g.adj {
+		totals[community[i]] += g.degree[i]
+		for j, weight := range neighbors {
+			if community[i] == community[j] {
+				internal[community[i]] += weight
+			}
+		}
+	}
+
+	var q float64
+	for c, tot := range totals {
+		q += internal[c]/g.total - resolution*(tot/g.total)*(tot/g.total)
+	}
+	return q
+}
+
+// louvain returns a community index for every node of g. Nodes are visited
+// in index order so results are reproducible.
+func (g *weightedGraph) louvain(resolution float64) []int {
+	membership := make([]int, len(g.adj))
+	for i := range membership {
+		membership[i] = i
+	}
+
+	current := g
+	for {
+		community, moved := current.localMoves(resolution)
+		if !moved {
+			break
+		}
+
+		// Renumber communities densely and fold them into single nodes
+		renumber := map[int]int{}
+		for _, c := range community {
+			if _, ok := renumber[c]; !ok {
+				renumber[c] = len(renumber)
+			}
+		}
+		for i := range membership {
+			membership[i] = renumber[community[membership[i]]]
+		}
+
+		next := newWeightedGraph(len(renumber))
+		for i, neighbors := range current.adj {
+			ci := renumber[community[i]]
+			for j, weight := range neighbors {
+				next.adj[ci][renumber[community[j]]] += weight
+			}
+			next.degree[ci] += current.degree[i]
+		}
+		next.total = current.total
+
+		if len(renumber) == len(current.adj) {
+			break
+		}
+		current = next
+	}
+	return membership
+}
+
+// localMoves is the first Louvain phase: move single nodes to the
+// neighboring community with the best modularity gain until none improves
+func (g *weightedGraph) localMoves(resolution float64) ([]int, bool) {
+	community := make([]int, len(g.adj))
+	totals := make([]float64, len(g.adj))
+	for i := range community {
+		community[i] = i
+		totals[i] = g.degree[i]
+	}
+	if g.total == 0 {
+		return community, false
+	}
+
+	moved := false
+	for improved := true; improved; {
+		improved = false
+		for i, neighbors := range g.adj {
+			own := community[i]
+			totals[own] -= g.degree[i]
+
+			// Weight from i into each neighboring community
+			links := map[int]float64{}
+			for j, weight := range neighbors {
+				if j != i {
+					links[community[j]] += weight
+				}
+			}
+
+			gain := func(c int) float64 {
+				return links[c] - resolution*totals[c]*g.degree[i]/g.total
+			}
+			best, bestGain := own, gain(own)
+			candidates := make([]int, 0, len(links))
+			for c := range links {
+				candidates = append(candidates, c)
+			}
+			sort.Ints(candidates)
+			for _, c := range candidates {
+				if c != own && gain(c) > bestGain+1e-12 {
+					best, bestGain = c, gain(c)
+				}
+			}
+
+			community[i] = best
+			totals[best] += g.degree[i]
+			if best != own {
+				improved = true
+				moved = true
+			}
+		}
+	}
+	return community, moved
+}
+
+// labelPropagation assigns each node the label carrying the most weight among
+// its neighbors until labels stop changing. Ties keep the current label if
+// possible, otherwise the lowest one, so results are reproducible.
+func (g *weightedGraph) labelPropagation() []int {
+	labels := make([]int, len(g.adj))
+	for i := range labels {
+		labels[i] = i
+	}
+
+	for iter := 0; iter < maxIterations; iter++ {
+		changed := false
+		for i, neighbors := range g.adj {
+			weights := map[int]float64{}
+			for j, weight := range neighbors {
+				if j != i {
+					weights[labels[j]] += weight
+				}
+			}
+			if len(weights) == 0 {
+				continue
+			}
+
+			best, bestWeight := labels[i], weights[labels[i]]
+			for label, weight := range weights {
+				if weight > bestWeight || (weight == bestWeight && best != labels[i] && label < best) {
+					best, bestWeight = label, weight
+				}
+			}
+			if best != labels[i] {
+				labels[i] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return labels
+}
+
+// DetectCommunities partitions the network and optionally stores the result
+// in each person's Group. Groups are numbered from 1, largest first.
+func DetectCommunities(store GraphStore, opts CommunityOptions) (CommunityResult, error) {
+	if err := opts.normalize(); err != nil {
+		return CommunityResult{}, err
+	}
+
+	net, err := loadNetwork(store)
+	if err != nil {
+		return CommunityResult{}, err
+	}
+	g := net.weightedGraph()
+
+	var membership []int
+	switch opts.Algorithm {
+	case AlgorithmLouvain:
+		membership = g.louvain(opts.Resolution)
+	case AlgorithmLabelPropagation:
+		membership = g.labelPropagation()
+	}
+
+	// Collect members per community, keeping network order within each
+	byCommunity := map[int][]string{}
+	var order []int
+	for i, c := range membership {
+		if _, ok := byCommunity[c]; !ok {
+			order = append(order, c)
+		}
+		byCommunity[c] = append(byCommunity[c], net.ids[i])
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return len(byCommunity[order[a]]) > len(byCommunity[order[b]])
+	})
+
+	result := CommunityResult{
+		Algorithm:   opts.Algorithm,
+		Modularity:  g.modularity(membership, opts.Resolution),
+		Communities: make([]Community, len(order)),
+		Groups:      make(map[string]int, len(net.ids)),
+	}
+	for i, c := range order {
+		members := byCommunity[c]
+		result.Communities[i] = Community{Group: i + 1, Size: len(members), Members: members}
+		for _, id := range members {
+			result.Groups[id] = i + 1
+		}
+	}
+
+	if opts.Apply {
+		for _, id := range net.ids {
+			if net.people[id].Group == result.Groups[id] {
+				continue
+			}
+			if err := store.SetGroup(id, result.Groups[id]); err != nil {
+				return result, err
+			}
+		}
+		result.Applied = true
+	}
+
+	return result, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestDetectCommunities(t *testing.T) {
+	// Two triangles joined by the c-d bridge: each side holds 3 of the 7
+	// connections and half the degree, so modularity is 2*(3/7 - 1/4) = 5/14
+	bridge := testGraph("a b c d e f", "a-b", "a-c", "b-c", "c-d", "d-e", "d-f", "e-f")
+	// Two separate triangles and someone with no connections
+	apart := testGraph("a b c d e f g", "a-b", "a-c", "b-c", "d-e", "d-f", "e-f")
+
+	tests := []struct {
+		name       string
+		graph      GraphData
+		algorithm  string
+		want       []Community
+		modularity float64
+	}{
+		{"louvain splits the bridge", bridge, AlgorithmLouvain, []Community{
+			{1, 3, []string{"a", "b", "c"}},
+			{2, 3, []string{"d", "e", "f"}},
+		}, 5.0 / 14},
+		{"louvain on components", apart, AlgorithmLouvain, []Community{
+			{1, 3, []string{"a", "b", "c"}},
+			{2, 3, []string{"d", "e", "f"}},
+			{3, 1, []string{"g"}},
+		}, 0.5},
+		{"label propagation on components", apart, AlgorithmLabelPropagation, []Community{
+			{1, 3, []string{"a", "b", "c"}},
+			{2, 3, []string{"d", "e", "f"}},
+			{3, 1, []string{"g"}},
+		}, 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := DetectCommunities(testStore(t, tt.graph), CommunityOptions{Algorithm: tt.algorithm})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result.Communities, tt.want) {
+				t.Errorf("communities = %v, want %v", result.Communities, tt.want)
+			}
+			if math.Abs(result.Modularity-tt.modularity) > 1e-9 {
+				t.Errorf("modularity = %v, want %v", result.Modularity, tt.modularity)
+			}
+			if result.Applied {
+				t.Error("result applied without Apply")
+			}
+		})
+	}
+}
+
+func TestDetectCommunitiesApply(t *testing.T) {
+	graph := testGraph("a b c d e f", "a-b", "a-c", "b-c", "c-d", "d-e", "d-f", "e-f")
+	graph.Nodes[0].Info = "Founder"
+	store := testStore(t, graph)
+
+	result, err := DetectCommunities(store, CommunityOptions{Apply: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Applied {
+		t.Error("Applied = false")
+	}
+	want := map[string]int{"a": 1, "b": 1, "c": 1, "d": 2, "e": 2, "f": 2}
+	if !reflect.DeepEqual(result.Groups, want) {
+		t.Errorf("groups = %v, want %v", result.Groups, want)
+	}
+	for id, group := range want {
+		person, _ := store.GetPerson(id)
+		if person.Group != group {
+			t.Errorf("%s stored group %d, want %d", id, person.Group, group)
+		}
+	}
+	if person, _ := store.GetPerson("a"); person.Info != "Founder" {
+		t.Errorf("info = %q, want it left alone", person.Info)
+	}
+}
+
+func TestCommunityOptions(t *testing.T) {
+	for _, opts := range []CommunityOptions{{Algorithm: "girvan_newman"}, {Resolution: -1}} {
+		if _, err := DetectCommunities(NewMemoryStore(), opts); err == nil {
+			t.Errorf("DetectCommunities accepted %+v", opts)
+		}
+	}
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultConfigFile is read if present when no file is named
+	defaultConfigFile = "config.json"
+	// configPollInterval is how often the config file is checked for changes
+	configPollInterval = 10 * time.Second
+)
+
+// Config holds every tunable setting. The wikipedia, nlp and api sections
+// match the config.json rendered by the Helm chart.
+type Config struct {
+	Server    ServerConfig    `json:"server"`
+	Storage   StorageConfig   `json:"storage"`
+	Graph     GraphConfig     `json:"graph"`
+	Wikipedia WikipediaConfig `json:"wikipedia"`
+	NLP       NLPConfig       `json:"nlp"`
+	API       APIConfig       `json:"api"`
+}
+
+// ServerConfig configures the HTTP listener
+type ServerConfig struct {
+	Port int `json:"port"`
+}
+
+// StorageConfig selects and tunes the graph store
+type StorageConfig struct {
+	Backend          string      `json:"backend"` // memory, file or sqlite
+	DataDir          string      `json:"dataDir"`
+	SQLitePath       string      `json:"sqlitePath"` // defaults to graph.db in dataDir
+	Fsync            FsyncPolicy `json:"fsync"`
+	SnapshotEvery    int         `json:"snapshotEvery"`    // WAL records between snapshots
+	SnapshotInterval Duration    `json:"snapshotInterval"` // e.g. "5m"
+}
+
+// GraphConfig controls checks on the graph's contents
+type GraphConfig struct {
+	TemporalCheck TemporalPolicy `json:"temporalCheck"`
+}
+
+// WikipediaConfig controls crawling and refreshing from Wikipedia
+type WikipediaConfig struct {
+	ScrapeInterval      int      `json:"scrapeInterval"` // seconds between refreshes; 0 turns them off
+	MaxDepth            int      `json:"maxDepth"`
+	MaxRelatedPerFigure int      `json:"maxRelatedPerFigure"`
+	SeedFigures         []string `json:"seedFigures"`
+	RefreshLease        string   `json:"refreshLease"`      // lock file; defaults to refresh.lock in the data directory
+	Workers             int      `json:"workers"`           // figures processed at once by batch operations
+	RequestsPerSecond   float64  `json:"requestsPerSecond"` // shared limit on requests to Wikipedia and Wikidata
+	Offline             bool     `json:"offline"`           // never contact Wikipedia or Wikidata; import dumps instead
+	DumpDir             string   `json:"dumpDir"`           // where dumps are imported from; defaults to dumps in the data directory
+}
+
+// NLPConfig tunes relationship and entity extraction
+type NLPConfig struct {
+	Model                   string `json:"model"`                   // reserved for an external NLP service
+	MinRelationshipStrength int    `json:"minRelationshipStrength"` // weaker inferred relationships are dropped
+	ExtractionBatchSize     int    `json:"extractionBatchSize"`     // reserved for an external NLP service
+	MaxEntitiesPerText      int    `json:"maxEntitiesPerText"`      // most entities extracted from one text; 0 for no limit
+}
+
+// APIConfig controls the HTTP API
+type APIConfig struct {
+	EnableCORS         bool   `json:"enableCors"`
+	RateLimit          int    `json:"rateLimit"`          // API requests per minute per client; 0 is unlimited
+	TrustedProxyHeader string `json:"trustedProxyHeader"` // X-Forwarded-For or X-Real-IP, set by a proxy in front; "" uses the connection's address
+	CacheEnabled       bool   `json:"cacheEnabled"`       // cache pages fetched from Wikipedia and Wikidata
+	CacheTTL           int    `json:"cacheTTL"`           // seconds before cached pages are revalidated
+	CacheEntries       int    `json:"cacheEntries"`       // pages kept in memory
+	CacheDir           string `json:"cacheDir"`           // also keep pages on disk here; "" keeps them in memory only
+	CacheDiskEntries   int    `json:"cacheDiskEntries"`   // pages kept in cacheDir
+	CacheMaxAge        int    `json:"cacheMaxAge"`        // seconds before an unconfirmed page is dropped; 0 keeps it
+}
+
+// Duration is a time.Duration written as a string such as "5m" in JSON
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"5m\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// DefaultConfig returns the settings used when nothing overrides them
+func DefaultConfig() Config {
+	return Config{
+		Server: ServerConfig{Port: 8080},
+		Storage: StorageConfig{
+			Backend:          "memory",
+			DataDir:          "./data",
+			Fsync:            FsyncInterval,
+			SnapshotEvery:    1000,
+			SnapshotInterval: Duration(5 * time.Minute),
+		},
+		Graph: GraphConfig{TemporalCheck: TemporalWarn},
+		Wikipedia: WikipediaConfig{
+			MaxDepth:            defaultCrawlDepth,
+			MaxRelatedPerFigure: defaultCrawlRelated,
+			Workers:             4,
+			RequestsPerSecond:   5,
+		},
+		NLP: NLPConfig{
+			MinRelationshipStrength: 1,
+			ExtractionBatchSize:     50,
+		},
+		API: APIConfig{RateLimit: 60, CacheTTL: 600, CacheEntries: 1000, CacheDiskEntries: 20000, CacheMaxAge: 30 * 24 * 3600},
+	}
+}
+
+// setting is a single value that can be overridden by an environment
+// variable or a flag named after its JSON path
+type setting struct {
+	key string // flag name, e.g. wikipedia.maxDepth
+	env string
+	set func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{"server.port", "PORT", intSetting(func(c *Config) *int { return &c.Server.Port })},
+	{"storage.backend", "STORAGE_BACKEND", stringSetting(func(c *Config) *string { return &c.Storage.Backend })},
+	{"storage.dataDir", "DATA_DIR", stringSetting(func(c *Config) *string { return &c.Storage.DataDir })},
+	{"storage.sqlitePath", "SQLITE_PATH", stringSetting(func(c *Config) *string { return &c.Storage.SQLitePath })},
+	{"storage.fsync", "STORAGE_FSYNC", func(c *Config, value string) error {
+		c.Storage.Fsync = FsyncPolicy(value)
+		return nil
+	}},
+	{"storage.snapshotEvery", "STORAGE_SNAPSHOT_EVERY", intSetting(func(c *Config) *int { return &c.Storage.SnapshotEvery })},
+	{"storage.snapshotInterval", "STORAGE_SNAPSHOT_INTERVAL", func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		c.Storage.SnapshotInterval = Duration(d)
+		return err
+	}},
+	{"graph.temporalCheck", "TEMPORAL_CHECK", func(c *Config, value string) error {
+		c.Graph.TemporalCheck = TemporalPolicy(value)
+		return nil
+	}},
+	{"wikipedia.scrapeInterval", "WIKIPEDIA_SCRAPE_INTERVAL", intSetting(func(c *Config) *int { return &c.Wikipedia.ScrapeInterval })},
+	{"wikipedia.maxDepth", "WIKIPEDIA_MAX_DEPTH", intSetting(func(c *Config) *int { return &c.Wikipedia.MaxDepth })},
+	{"wikipedia.maxRelatedPerFigure", "WIKIPEDIA_MAX_RELATED", intSetting(func(c *Config) *int { return &c.Wikipedia.MaxRelatedPerFigure })},
+	{"wikipedia.seedFigures", "SEED_FIGURES", func(c *Config, value string) error {
+		c.Wikipedia.SeedFigures = splitList(value)
+		return nil
+	}},
+	{"wikipedia.refreshLease", "REFRESH_LEASE_FILE", stringSetting(func(c *Config) *string { return &c.Wikipedia.RefreshLease })},
+	{"wikipedia.workers", "WIKIPEDIA_WORKERS", intSetting(func(c *Config) *int { return &c.Wikipedia.Workers })},
+	{"wikipedia.requestsPerSecond", "WIKIPEDIA_REQUESTS_PER_SECOND", func(c *Config, value string) error {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("must be a number")
+		}
+		c.Wikipedia.RequestsPerSecond = rate
+		return nil
+	}},
+	{"wikipedia.offline", "WIKIPEDIA_OFFLINE", boolSetting(func(c *Config) *bool { return &c.Wikipedia.Offline })},
+	{"wikipedia.dumpDir", "WIKIPEDIA_DUMP_DIR", stringSetting(func(c *Config) *string { return &c.Wikipedia.DumpDir })},
+	{"nlp.model", "NLP_MODEL", stringSetting(func(c *Config) *string { return &c.NLP.Model })},
+	{"nlp.minRelationshipStrength", "NLP_MIN_RELATIONSHIP_STRENGTH", intSetting(func(c *Config) *int { return &c.NLP.MinRelationshipStrength })},
+	{"nlp.extractionBatchSize", "NLP_EXTRACTION_BATCH_SIZE", intSetting(func(c *Config) *int { return &c.NLP.ExtractionBatchSize })},
+	{"nlp.maxEntitiesPerText", "NLP_MAX_ENTITIES_PER_TEXT", intSetting(func(c *Config) *int { return &c.NLP.MaxEntitiesPerText })},
+	{"api.enableCors", "API_ENABLE_CORS", boolSetting(func(c *Config) *bool { return &c.API.EnableCORS })},
+	{"api.rateLimit", "API_RATE_LIMIT", intSetting(func(c *Config) *int { return &c.API.RateLimit })},
+	{"api.trustedProxyHeader", "API_TRUSTED_PROXY_HEADER", stringSetting(func(c *Config) *string { return &c.API.TrustedProxyHeader })},
+	{"api.cacheEnabled", "API_CACHE_ENABLED", boolSetting(func(c *Config) *bool { return &c.API.CacheEnabled })},
+	{"api.cacheTTL", "API_CACHE_TTL", intSetting(func(c *Config) *int { return &c.API.CacheTTL })},
+	{"api.cacheEntries", "API_CACHE_ENTRIES", intSetting(func(c *Config) *int { return &c.API.CacheEntries })},
+	{"api.cacheDir", "API_CACHE_DIR", stringSetting(func(c *Config) *string { return &c.API.CacheDir })},
+	{"api.cacheDiskEntries", "API_CACHE_DISK_ENTRIES", intSetting(func(c *Config) *int { return &c.API.CacheDiskEntries })},
+	{"api.cacheMaxAge", "API_CACHE_MAX_AGE", intSetting(func(c *Config) *int { return &c.API.CacheMaxAge })},
+}
+
+func intSetting(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("must be an integer")
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func boolSetting(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("must be true or false")
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func stringSetting(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+// Validate checks every setting, filling in defaults that depend on others
+func (c *Config) Validate() error {
+	ve := &ValidationError{}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		ve.add("server.port", "must be between 1 and 65535")
+	}
+
+	switch c.Storage.Backend {
+	case "memory", "file", "sqlite":
+	default:
+		ve.add("storage.backend", "must be one of memory, file, sqlite")
+	}
+	if c.Storage.DataDir == "" {
+		ve.add("storage.dataDir", "is required")
+	}
+	if c.Storage.SQLitePath == "" {
+		c.Storage.SQLitePath = filepath.Join(c.Storage.DataDir, "graph.db")
+	}
+	if policy, err := ParseFsyncPolicy(string(c.Storage.Fsync)); err != nil {
+		ve.add("storage.fsync", "must be one of always, interval, never")
+	} else {
+		c.Storage.Fsync = policy
+	}
+	if c.Storage.SnapshotEvery < 0 {
+		ve.add("storage.snapshotEvery", "must not be negative")
+	}
+	if c.Storage.SnapshotInterval < 0 {
+		ve.add("storage.snapshotInterval", "must not be negative")
+	}
+
+	if policy, err := ParseTemporalPolicy(string(c.Graph.TemporalCheck)); err != nil {
+		ve.add("graph.temporalCheck", "must be one of off, warn, reject")
+	} else {
+		c.Graph.TemporalCheck = policy
+	}
+
+	if c.Wikipedia.ScrapeInterval < 0 {
+		ve.add("wikipedia.scrapeInterval", "must not be negative")
+	}
+	if c.Wikipedia.MaxDepth < 0 {
+		ve.add("wikipedia.maxDepth", "must not be negative")
+	}
+	if c.Wikipedia.MaxRelatedPerFigure < 1 || c.Wikipedia.MaxRelatedPerFigure > maxCrawlRelated {
+		ve.add("wikipedia.maxRelatedPerFigure", "must be between 1 and %d", maxCrawlRelated)
+	}
+	if c.Wikipedia.Workers < 1 {
+		ve.add("wikipedia.workers", "must be at least 1")
+	}
+	if !(c.Wikipedia.RequestsPerSecond > 0) {
+		ve.add("wikipedia.requestsPerSecond", "must be greater than 0")
+	}
+	if c.Wikipedia.RefreshLease == "" {
+		c.Wikipedia.RefreshLease = filepath.Join(c.Storage.DataDir, "refresh.lock")
+	}
+	if c.Wikipedia.DumpDir == "" {
+		c.Wikipedia.DumpDir = filepath.Join(c.Storage.DataDir, "dumps")
+	}
+
+	if c.NLP.MinRelationshipStrength < 1 || c.NLP.MinRelationshipStrength > 10 {
+		ve.add("nlp.minRelationshipStrength", "must be between 1 and 10")
+	}
+	if c.NLP.ExtractionBatchSize < 1 {
+		ve.add("nlp.extractionBatchSize", "must be at least 1")
+	}
+	if c.NLP.MaxEntitiesPerText < 0 {
+		ve.add("nlp.maxEntitiesPerText", "must not be negative")
+	}
+
+	if c.API.RateLimit < 0 {
+		ve.add("api.rateLimit", "must not be negative")
+	}
+	switch header := http.CanonicalHeaderKey(c.API.TrustedProxyHeader); header {
+	case "", "X-Forwarded-For", "X-Real-Ip":
+		c.API.TrustedProxyHeader = header
+	default:
+		ve.add("api.trustedProxyHeader", "must be X-Forwarded-For, X-Real-IP or empty")
+	}
+	if c.API.CacheTTL < 0 {
+		ve.add("api.cacheTTL", "must not be negative")
+	}
+	if c.API.CacheEntries < 1 {
+		ve.add("api.cacheEntries", "must be at least 1")
+	}
+	if c.API.CacheDiskEntries < 1 {
+		ve.add("api.cacheDiskEntries", "must be at least 1")
+	}
+	if c.API.CacheMaxAge < 0 {
+		ve.add("api.cacheMaxAge", "must not be negative")
+	} else if c.API.CacheMaxAge > 0 && c.API.CacheMaxAge < c.API.CacheTTL {
+		ve.add("api.cacheMaxAge", "must not be less than api.cacheTTL")
+	}
+	return ve.err()
+}
+
+// requiresRestart lists the settings in next that differ from c but only
+// take effect at startup: the listener, the store and the temporal policy
+func (c Config) requiresRestart(next Config) []string {
+	var changed []string
+	if c.Server != next.Server {
+		changed = append(changed, "server")
+	}
+	if c.Storage != next.Storage {
+		changed = append(changed, "storage")
+	}
+	if c.Graph != next.Graph {
+		changed = append(changed, "graph")
+	}
+	if c.Wikipedia.RefreshLease != next.Wikipedia.RefreshLease {
+		changed = append(changed, "wikipedia.refreshLease")
+	}
+	return changed
+}
+
+// ConfigManager loads the configuration and reloads it when the file
+// changes. Settings are applied in order: defaults, the config file,
+// environment variables, then command-line flags.
+type ConfigManager struct {
+	path     string
+	optional bool              // the default file may be absent
+	flags    map[string]string // setting key -> value given on the command line
+
+	mu        sync.RWMutex
+	current   Config
+	contents  []byte // config file contents the current settings came from
+	listeners []func(Config)
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// LoadConfig parses the command line, reads the config file it names
+// (-config, or CONFIG_FILE) and validates the result
+func LoadConfig(args []string) (*ConfigManager, error) {
+	m := &ConfigManager{flags: map[string]string{}}
+
+	fs := flag.NewFlagSet("historical-network-visualizer", flag.ContinueOnError)
+	fs.StringVar(&m.path, "config", os.Getenv("CONFIG_FILE"), "path to config.json")
+	for _, s := range settings {
+		key := s.key
+		fs.Func(key, fmt.Sprintf("overrides %s (env %s)", key, s.env), func(value string) error {
+			m.flags[key] = value
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if m.path == "" {
+		m.path, m.optional = defaultConfigFile, true
+	}
+
+	contents, err := m.read()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := m.build(contents)
+	if err != nil {
+		return nil, err
+	}
+	m.current, m.contents = cfg, contents
+	return m, nil
+}
+
+// read returns the config file's contents, or nil if the optional default
+// file doesn't exist
+func (m *ConfigManager) read() ([]byte, error) {
+	contents, err := os.ReadFile(m.path)
+	if errors.Is(err, os.ErrNotExist) && m.optional {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+	return contents, nil
+}
+
+// build layers the file contents, environment and flags over the defaults
+func (m *ConfigManager) build(contents []byte) (Config, error) {
+	cfg := DefaultConfig()
+	if len(contents) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(contents))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&cfg); err != nil {
+			return Config{}, fmt.Errorf("error parsing %s: %w", m.path, err)
+		}
+	}
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.env); ok && value != "" {
+			if err := s.set(&cfg, value); err != nil {
+				return Config{}, fmt.Errorf("invalid %s: %w", s.env, err)
+			}
+		}
+		if value, ok := m.flags[s.key]; ok {
+			if err := s.set(&cfg, value); err != nil {
+				return Config{}, fmt.Errorf("invalid -%s: %w", s.key, err)
+			}
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// Current returns the settings in effect
+func (m *ConfigManager) Current() Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.current
+}
+
+// OnReload registers a function to call with the new settings after each
+// successful reload
+func (m *ConfigManager) OnReload(listener func(Config)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, listener)
+}
+
+// Watch polls the config file in the background, reloading it when its
+// contents change
+func (m *ConfigManager) Watch() {
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(configPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				if err := m.Reload(); err != nil {
+					log.Printf("Keeping previous configuration: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Close stops watching the config file
+func (m *ConfigManager) Close() {
+	if m.stop == nil {
+		return
+	}
+	close(m.stop)
+	<-m.done
+}
+
+// Reload rereads the config file if it changed. Settings that only take
+// effect at startup keep their current values until the server restarts.
+func (m *ConfigManager) Reload() error {
+	contents, err := m.read()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	if bytes.Equal(contents, m.contents) {
+		m.mu.Unlock()
+		return nil
+	}
+	next, err := m.build(contents)
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	m.contents = contents
+
+	current := m.current
+	if changed := current.requiresRestart(next); len(changed) > 0 {
+		log.Printf("Configuration changes to %v take effect after a restart", changed)
+	}
+	next.Server, next.Storage, next.Graph = current.Server, current.Storage, current.Graph
+	next.Wikipedia.RefreshLease = current.Wikipedia.RefreshLease
+	if reflect.DeepEqual(current, next) {
+		m.mu.Unlock()
+		return nil
+	}
+	m.current = next
+	listeners := append([]func(Config){}, m.listeners...)
+	m.mu.Unlock()
+
+	log.Printf("Reloaded configuration from %s", m.path)
+	for _, listener := range listeners {
+		listener(next)
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Crawl defaults, matching the Helm chart's wikipedia settings
+	defaultCrawlDepth   = 2
+	defaultCrawlRelated = 10
+	// maxCrawlRelated bounds the fan-out a single crawl may ask for
+	maxCrawlRelated = 100
+)
+
+// ErrCrawlRunning is returned when a crawl is started while another runs
+var ErrCrawlRunning = errors.New("a crawl is already running")
+
+// CrawlOptions bounds a recursive crawl
+type CrawlOptions struct {
+	Seeds      []string `json:"seeds"`
+	MaxDepth   int      `json:"maxDepth"`   // link hops from a seed; 0 scrapes only the seeds
+	MaxRelated int      `json:"maxRelated"` // people followed from each figure
+}
+
+// normalize drops blank seeds and checks the bounds
+func (o *CrawlOptions) normalize() error {
+	var seeds []string
+	for _, seed := range o.Seeds {
+		if seed = strings.TrimSpace(seed); seed != "" {
+			seeds = append(seeds, seed)
+		}
+	}
+	o.Seeds = seeds
+
+	if len(o.Seeds) == 0 {
+		return fmt.Errorf("at least one seed figure is required")
+	}
+	if o.MaxDepth < 0 {
+		return fmt.Errorf("maxDepth must not be negative")
+	}
+	if o.MaxRelated < 1 || o.MaxRelated > maxCrawlRelated {
+		return fmt.Errorf("maxRelated must be between 1 and %d", maxCrawlRelated)
+	}
+	return nil
+}
+
+// CrawlStatus reports the progress of the current or most recent crawl
+type CrawlStatus struct {
+	Running     bool              `json:"running"`
+	Options     CrawlOptions      `json:"options"`
+	StartedAt   time.Time         `json:"startedAt"`
+	FinishedAt  *time.Time        `json:"finishedAt,omitempty"`
+	Queued      int               `json:"queued"`          // figures waiting to be scraped
+	People      []string          `json:"people"`          // IDs of people scraped, in crawl order
+	NonPeople   int               `json:"nonPeople"`       // linked pages classified as not people
+	Connections int               `json:"connections"`     // connections added to the graph
+	Failed      map[string]string `json:"failed"`          // title -> error
+	Error       string            `json:"error,omitempty"` // why the crawl stopped early
+}
+
+// copy returns a snapshot that is safe to read while the crawl continues
+func (s *CrawlStatus) copy() CrawlStatus {
+	snapshot := *s
+	snapshot.People = append([]string{}, s.People...)
+	snapshot.Failed = make(map[string]string, len(s.Failed))
+	for title, err := range s.Failed {
+		snapshot.Failed[title] = err
+	}
+	return snapshot
+}
+
+// Crawler follows links between person articles breadth-first from a set of
+// seed figures, adding the people it finds and the connections between them
+// to the graph. One crawl runs at a time, in the background.
+type Crawler struct {
+	scraper  *WikipediaScraper
+	store    GraphStore
+	temporal TemporalPolicy
+
+	mu     sync.Mutex
+	status *CrawlStatus
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewCrawler creates a crawler writing into the given store
+func NewCrawler(scraper *WikipediaScraper, store GraphStore, temporal TemporalPolicy) *Crawler {
+	return &Crawler{scraper: scraper, store: store, temporal: temporal}
+}
+
+// Start begins a crawl in the background
+func (c *Crawler) Start(opts CrawlOptions) (CrawlStatus, error) {
+	if err := opts.normalize(); err != nil {
+		return CrawlStatus{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.status != nil && c.status.Running {
+		return c.status.copy(), ErrCrawlRunning
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.status = &CrawlStatus{
+		Running:   true,
+		Options:   opts,
+		StartedAt: time.Now().UTC(),
+		Queued:    len(opts.Seeds),
+		People:    []string{},
+		Failed:    map[string]string{},
+	}
+	c.cancel = cancel
+	c.done = make(chan struct{})
+
+	go func(done chan struct{}) {
+		defer close(done)
+		defer cancel()
+		err := c.run(ctx, opts)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		finished := time.Now().UTC()
+		c.status.Running = false
+		c.status.FinishedAt = &finished
+		if err != nil {
+			c.status.Error = err.Error()
+		}
+		log.Printf("Crawl finished: %d people, %d connections, %d failures",
+			len(c.status.People), c.status.Connections, len(c.status.Failed))
+	}(c.done)
+
+	return c.status.copy(), nil
+}
+
+// Status returns the progress of the current or most recent crawl. ok is
+// false if no crawl has been started.
+func (c *Crawler) Status() (status CrawlStatus, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.status == nil {
+		return CrawlStatus{}, false
+	}
+	return c.status.copy(), true
+}
+
+// Stop cancels a running crawl and waits for it to finish
+func (c *Crawler) Stop() {
+	c.mu.Lock()
+	cancel, done := c.cancel, c.done
+	c.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// update changes the status under the lock
+func (c *Crawler) update(change func(*CrawlStatus)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	change(c.status)
+}
+
+type crawlItem struct {
+	title string
+	depth int
+}
+
+// crawlResult is the outcome of scraping one crawlItem
+type crawlResult struct {
+	person  *Person
+	related []string
+	err     error
+}
+
+// run scrapes figures breadth-first, then finds the relationships between
+// everyone scraped. Relationships are analyzed last so that text analysis
+// can recognize every person the crawl discovered. Each level of the crawl
+// is fetched on the scraper's worker pool and then added in queue order, so
+// a crawl finds the same people however many workers there are.
+func (c *Crawler) run(ctx context.Context, opts CrawlOptions) error {
+	level := make([]crawlItem, 0, len(opts.Seeds))
+	seen := map[string]bool{} // lowercased titles queued so far
+	for _, seed := range opts.Seeds {
+		if !seen[strings.ToLower(seed)] {
+			seen[strings.ToLower(seed)] = true
+			level = append(level, crawlItem{title: seed})
+		}
+	}
+
+	var scraped []string
+	scrapedIDs := map[string]bool{}
+	for len(level) > 0 {
+		results := make([]crawlResult, len(level))
+		err := c.scraper.each(ctx, len(level), func(i int) {
+			person, related, err := c.scraper.scrape(ctx, level[i].title)
+			if err == nil {
+				err = ValidatePerson(*person)
+			}
+			results[i] = crawlResult{person: person, related: related, err: err}
+		})
+		if err != nil {
+			return fmt.Errorf("crawl canceled: %w", err)
+		}
+
+		var next []crawlItem
+		for i, item := range level {
+			person, err := results[i].person, results[i].err
+			queued := len(level) - i - 1 + len(next)
+			if err == nil && scrapedIDs[person.ID] {
+				// Reached again through a redirect
+				c.update(func(s *CrawlStatus) { s.Queued = queued })
+				continue
+			}
+			if err == nil {
+				if err = c.store.AddPerson(*person); errors.Is(err, ErrPersonExists) {
+					err = nil
+				}
+			}
+			if err != nil {
+				log.Printf("Crawl failed for %s: %v", item.title, err)
+				c.update(func(s *CrawlStatus) {
+					s.Failed[item.title] = err.Error()
+					s.Queued = queued
+				})
+				continue
+			}
+
+			scrapedIDs[person.ID] = true
+			scraped = append(scraped, person.ID)
+			seen[strings.ToLower(person.Name)] = true
+
+			var related []string
+			nonPeople := 0
+			if item.depth < opts.MaxDepth {
+				related, nonPeople = c.relatedPeople(ctx, results[i].related, seen, opts.MaxRelated)
+				for _, title := range related {
+					seen[strings.ToLower(title)] = true
+					next = append(next, crawlItem{title: title, depth: item.depth + 1})
+				}
+			}
+			queued += len(related)
+			c.update(func(s *CrawlStatus) {
+				s.People = append(s.People, person.ID)
+				s.NonPeople += nonPeople
+				s.Queued = queued
+			})
+		}
+		level = next
+	}
+
+	err := c.scraper.each(ctx, len(scraped), func(i int) {
+		id := scraped[i]
+		connections, err := c.scraper.FindRelationships(ctx, id)
+		if err != nil {
+			log.Printf("Crawl could not find relationships for %s: %v", id, err)
+			c.update(func(s *CrawlStatus) { s.Failed[id] = err.Error() })
+			return
+		}
+		added := len(storeConnections(c.store, c.temporal.filter(c.store, connections)))
+		c.update(func(s *CrawlStatus) { s.Connections += added })
+	})
+	if err != nil {
+		return fmt.Errorf("crawl canceled: %w", err)
+	}
+	return nil
+}
+
+// relatedPeople picks up to limit people from a figure's linked articles,
+// in order, skipping titles already seen. It also returns how many of the
+// links it checked were not people.
+func (c *Crawler) relatedPeople(ctx context.Context, related []string, seen map[string]bool, limit int) ([]string, int) {
+	var candidates []string
+	for _, title := range related {
+		if !seen[strings.ToLower(title)] {
+			candidates = append(candidates, title)
+		}
+	}
+	// Lead sections can link hundreds of articles; the first few are the
+	// relevant ones
+	if len(candidates) > 2*maxTitlesPerQuery {
+		candidates = candidates[:2*maxTitlesPerQuery]
+	}
+	if len(candidates) == 0 {
+		return nil, 0
+	}
+
+	summaries, err := c.scraper.api.Summaries(ctx, candidates)
+	if err != nil {
+		log.Printf("Crawl could not classify linked pages: %v", err)
+		return nil, 0
+	}
+
+	var people []string
+	picked := map[string]bool{}
+	nonPeople := 0
+	for _, title := range candidates {
+		if len(people) >= limit {
+			break
+		}
+		summary, ok := summaries[title]
+		if !ok || picked[summary.Title] || seen[strings.ToLower(summary.Title)] {
+			continue
+		}
+		if !c.isPerson(ctx, summary) {
+			nonPeople++
+			continue
+		}
+		picked[summary.Title] = true
+		people = append(people, summary.Title)
+	}
+	return people, nonPeople
+}
+
+// isPerson classifies a linked article. Biographies' short descriptions give
+// the person's dates, e.g. "Greek philosopher (c. 470–399 BC)", which rules
+// out most other pages cheaply; Wikidata then confirms the page is about a
+// human rather than, say, a dynasty with dates of its own.
+func (c *Crawler) isPerson(ctx context.Context, summary PageSummary) bool {
+	if summary.Disambiguation {
+		return false
+	}
+	birth, death := FindLifespan(summary.Description)
+	if birth.IsZero() && death.IsZero() {
+		return false
+	}
+	if summary.WikidataID == "" {
+		return true
+	}
+	human, err := c.scraper.wikidata.IsHuman(ctx, summary.WikidataID)
+	if err != nil {
+		log.Printf("Could not check %s on Wikidata: %v", summary.Title, err)
+		return true
+	}
+	return human
+}
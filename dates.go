@@ -0,0 +1,455 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DatePrecision is how exactly a historical date is known
+type DatePrecision string
+
+const (
+	PrecisionDay     DatePrecision = "day"
+	PrecisionMonth   DatePrecision = "month"
+	PrecisionYear    DatePrecision = "year"
+	PrecisionDecade  DatePrecision = "decade"
+	PrecisionCentury DatePrecision = "century"
+)
+
+// Calendars named by a date's "O.S."/"N.S." or Julian/Gregorian note
+const (
+	CalendarJulian    = "julian"
+	CalendarGregorian = "gregorian"
+)
+
+// circaMargin is how many years either side a "c." date may be off by
+const circaMargin = 5
+
+// HistoricalDate is a possibly approximate date. Years use the historical
+// calendar: negative years are BCE and there is no year 0.
+type HistoricalDate struct {
+	Year      int           `json:"year"` // best single estimate
+	Month     int           `json:"month,omitempty"`
+	Day       int           `json:"day,omitempty"`
+	Precision DatePrecision `json:"precision"`
+	Circa     bool          `json:"circa,omitempty"`    // "c." - approximate
+	Floruit   bool          `json:"floruit,omitempty"`  // "fl." - when the person was active, not born or died
+	Earliest  int           `json:"earliest"`           // earliest plausible year
+	Latest    int           `json:"latest"`             // latest plausible year
+	Calendar  string        `json:"calendar,omitempty"` // julian or gregorian, when the source says
+}
+
+// IsZero reports whether the date is unknown
+func (d HistoricalDate) IsZero() bool {
+	return d.Year == 0
+}
+
+// yearDate wraps a bare year as a year-precision date
+func yearDate(year int) *HistoricalDate {
+	return &HistoricalDate{Year: year, Precision: PrecisionYear, Earliest: year, Latest: year}
+}
+
+// withDefaults fills in the precision and bounds of a date given only a
+// year, widening the bounds to cover the precision and any "c."
+func (d *HistoricalDate) withDefaults() {
+	if d.Precision == "" {
+		d.Precision = PrecisionYear
+	}
+	if d.Earliest != 0 || d.Latest != 0 {
+		return
+	}
+	margin := 0
+	switch d.Precision {
+	case PrecisionDecade:
+		margin = 5
+	case PrecisionCentury:
+		margin = 50
+	}
+	if d.Circa {
+		margin += circaMargin
+	}
+	d.Earliest, d.Latest = addYears(d.Year, -margin), addYears(d.Year, margin)
+}
+
+// midpoint is the middle of the plausible range
+func (d HistoricalDate) midpoint() int {
+	mid := d.Earliest + (d.Latest-d.Earliest)/2
+	if mid == 0 {
+		return d.Year
+	}
+	return mid
+}
+
+// String renders the date as it would be written, e.g. "c. 470 BCE"
+func (d HistoricalDate) String() string {
+	year := func(y int) string {
+		if y < 0 {
+			return fmt.Sprintf("%d BCE", -y)
+		}
+		return fmt.Sprint(y)
+	}
+
+	var text string
+	switch d.Precision {
+	case PrecisionCentury:
+		n, suffix := (abs(d.Year)+99)/100, ""
+		if d.Year < 0 {
+			suffix = " BCE"
+		}
+		text = fmt.Sprintf("%s century%s", ordinal(n), suffix)
+	case PrecisionDecade:
+		if d.Year < 0 {
+			text = fmt.Sprintf("%ds BCE", -d.Latest)
+		} else {
+			text = fmt.Sprintf("%ds", d.Earliest)
+		}
+	default:
+		text = year(d.Year)
+		if d.Earliest != d.Latest && !d.Circa {
+			text = year(d.Earliest) + "/" + year(d.Latest)
+		}
+	}
+
+	if d.Circa {
+		text = "c. " + text
+	}
+	if d.Floruit {
+		text = "fl. " + text
+	}
+	return text
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return fmt.Sprintf("%d%s", n, suffix)
+}
+
+// normalizeDates keeps the structured dates and the integer year fields in
+// step. A structured date wins; a bare integer year becomes a year-precision
+// date, so clients that only know yearBirth/yearDeath keep working.
+func (p *Person) normalizeDates() {
+	if p.Birth != nil {
+		p.Birth.withDefaults()
+		p.YearBirth = p.Birth.Year
+	} else if p.YearBirth != 0 {
+		p.Birth = yearDate(p.YearBirth)
+	}
+
+	if p.Death != nil {
+		p.Death.withDefaults()
+		p.YearDeath = p.Death.Year
+	} else if p.YearDeath != 0 {
+		p.Death = yearDate(p.YearDeath)
+	}
+
+	if p.Floruit != nil {
+		p.Floruit.withDefaults()
+	}
+}
+
+// birthDate returns the structured birth date, falling back to yearBirth
+func (p Person) birthDate() *HistoricalDate {
+	if p.Birth != nil {
+		return p.Birth
+	}
+	if p.YearBirth != 0 {
+		return yearDate(p.YearBirth)
+	}
+	return nil
+}
+
+// deathDate returns the structured death date, falling back to yearDeath
+func (p Person) deathDate() *HistoricalDate {
+	if p.Death != nil {
+		return p.Death
+	}
+	if p.YearDeath != 0 {
+		return yearDate(p.YearDeath)
+	}
+	return nil
+}
+
+// eraYear is the year used to place a person in an era: the middle of their
+// plausible birth range, or failing that when they were active or died
+func (p Person) eraYear() (int, bool) {
+	for _, date := range []*HistoricalDate{p.birthDate(), p.Floruit, p.deathDate()} {
+		if date != nil && !date.IsZero() {
+			return date.midpoint(), true
+		}
+	}
+	return 0, false
+}
+
+const monthPattern = `January|February|March|April|May|June|July|August|September|October|November|December|` +
+	`Jan|Feb|Mar|Apr|Jun|Jul|Aug|Sept|Sep|Oct|Nov|Dec`
+
+// datePattern matches a single date expression at the start of a string
+var datePattern = regexp.MustCompile(`(?i)^` +
+	`(?P<qual>(?:(?:c\.|ca\.|circa|approx\.|approximately|about|around|fl\.|floruit|flourished)\s*)*)` +
+	`(?:` +
+	`(?P<iso>\d{4})-(?P<isomonth>\d{2})-(?P<isoday>\d{2})` +
+	`|(?P<century>\d{1,2})(?:st|nd|rd|th)[\s-]+century` +
+	`|(?P<decade>\d{1,3}0)s` +
+	`|(?:(?P<day1>\d{1,2})(?:(?:/|\s+or\s+)(?P<altday>\d{1,2}))?\s+(?P<month1>` + monthPattern + `)\.?\s+` +
+	`|(?P<month2>` + monthPattern + `)\.?\s+(?:(?P<day2>\d{1,2}),?\s+)?)?` +
+	`(?P<ad>(?:AD|A\.D\.)\s*)?(?P<year>\d{1,4})(?:/(?P<alt>\d{1,4}))?` +
+	`(?:\s+or\s+(?P<oryear>\d{1,4})(?:/(?P<oralt>\d{1,4}))?)?` +
+	`)` +
+	`(?:\s*(?P<era>BCE\b|BC\b|B\.C\.E\.|B\.C\.|AD\b|CE\b|A\.D\.|C\.E\.))?` +
+	`(?:\s*[\[(]?(?P<calendar>O\.S\.|N\.S\.|Old Style|New Style|Julian|Gregorian)[\])]?)?`)
+
+var qualifierPattern = regexp.MustCompile(`c\.|ca\.|circa|approx\.|approximately|about|around|fl\.|floruit|flourished`)
+
+// hiddenISODate is the machine-readable date Wikipedia puts before the readable one
+var hiddenISODate = regexp.MustCompile(`^\(\d{4}-\d{2}-\d{2}\)`)
+
+// rangeSeparator splits "384–322 BC" or "c. 470 to 399 BC"
+var rangeSeparator = regexp.MustCompile(`\s*(?:–|—|−|-|\bto\b)\s*`)
+
+var months = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+// parsedDate is a date plus what the parser saw, used to resolve ranges
+type parsedDate struct {
+	HistoricalDate
+	explicitEra bool // BC/BCE/AD/CE was written
+	strong      bool // unlikely to be some other number
+}
+
+// matchDate parses a date at the start of s and returns the rest of s.
+// impliedBCE treats a date without an era as BCE.
+func matchDate(s string, impliedBCE bool) (parsedDate, string, bool) {
+	s = strings.TrimSpace(s)
+	m := datePattern.FindStringSubmatchIndex(s)
+	if m == nil {
+		return parsedDate{}, s, false
+	}
+	group := func(name string) string {
+		i := datePattern.SubexpIndex(name)
+		if m[2*i] < 0 {
+			return ""
+		}
+		return s[m[2*i]:m[2*i+1]]
+	}
+
+	var d parsedDate
+	for _, q := range qualifierPattern.FindAllString(strings.ToLower(group("qual")), -1) {
+		switch q {
+		case "fl.", "floruit", "flourished":
+			d.Floruit = true
+		default:
+			d.Circa = true
+		}
+	}
+
+	era := strings.ToUpper(strings.ReplaceAll(group("era"), ".", ""))
+	d.explicitEra = era != "" || group("ad") != ""
+	bce := era == "BC" || era == "BCE" || (impliedBCE && !d.explicitEra)
+	d.strong = d.Circa || d.Floruit || d.explicitEra
+
+	switch {
+	case group("iso") != "":
+		d.Year, _ = strconv.Atoi(group("iso"))
+		d.Month, _ = strconv.Atoi(group("isomonth"))
+		d.Day, _ = strconv.Atoi(group("isoday"))
+		d.Precision = PrecisionDay
+		d.Earliest, d.Latest = d.Year, d.Year
+		d.strong = true
+
+	case group("century") != "":
+		n, _ := strconv.Atoi(group("century"))
+		if n == 0 {
+			return parsedDate{}, s, false
+		}
+		d.Precision = PrecisionCentury
+		d.Earliest, d.Latest = (n-1)*100+1, n*100
+		d.strong = true
+
+	case group("decade") != "":
+		start, _ := strconv.Atoi(group("decade"))
+		d.Precision = PrecisionDecade
+		d.Earliest, d.Latest = start, start+9
+		d.strong = true
+
+	default:
+		year, _ := strconv.Atoi(group("year"))
+		if year == 0 {
+			return parsedDate{}, s, false
+		}
+		d.Year, d.Earliest, d.Latest = year, year, year
+		d.Precision = PrecisionYear
+		d.strong = d.strong || len(group("year")) == 4
+
+		if month := group("month1") + group("month2"); month != "" {
+			d.Month = months[strings.ToLower(month[:3])]
+			d.Precision = PrecisionMonth
+			d.strong = true
+			if day := group("day1") + group("day2"); day != "" {
+				d.Day, _ = strconv.Atoi(day)
+				d.Precision = PrecisionDay
+			}
+			if group("altday") != "" {
+				// "20/21 July": the day is one of two, so only the month is certain
+				d.Precision = PrecisionMonth
+			}
+		}
+
+		if alt := group("alt"); alt != "" {
+			if len(alt) < len(group("year")) {
+				// Dual dating such as 1726/27: the later year is the modern reckoning
+				yearText := group("year")
+				altYear, _ := strconv.Atoi(yearText[:len(yearText)-len(alt)] + alt)
+				d.Year, d.Earliest, d.Latest = altYear, altYear, altYear
+				d.Calendar = CalendarJulian
+			} else {
+				// Either of two years, such as 470/469 BC
+				altYear, _ := strconv.Atoi(alt)
+				d.Earliest, d.Latest = min(year, altYear), max(year, altYear)
+			}
+		}
+
+		// "428/427 or 424/423": further candidate years widen the range
+		for _, text := range []string{group("oryear"), group("oralt")} {
+			if other, _ := strconv.Atoi(text); other != 0 {
+				d.Earliest, d.Latest = min(d.Earliest, other), max(d.Latest, other)
+			}
+		}
+	}
+
+	switch strings.ToLower(strings.ReplaceAll(group("calendar"), ".", "")) {
+	case "os", "old style", "julian":
+		d.Calendar = CalendarJulian
+	case "ns", "new style", "gregorian":
+		d.Calendar = CalendarGregorian
+	}
+
+	if bce {
+		if d.Precision == PrecisionDecade {
+			// The 470s BC run from 479 to 470 BC
+			d.Earliest, d.Latest = -(d.Earliest + 9), -d.Earliest
+		} else {
+			d.Year, d.Earliest, d.Latest = -d.Year, -d.Latest, -d.Earliest
+		}
+	}
+	if d.Precision == PrecisionDecade || d.Precision == PrecisionCentury {
+		d.Year = d.Earliest + (d.Latest-d.Earliest)/2
+	}
+	if d.Circa {
+		d.Earliest, d.Latest = addYears(d.Earliest, -circaMargin), addYears(d.Latest, circaMargin)
+	}
+	return d, s[m[1]:], true
+}
+
+// ParseHistoricalDate parses a string consisting of a single date such as
+// "c. 470 BC", "14 March 1879", "1879-03-14", "AD 30", "fl. 5th century BC"
+// or "20 March 1726/27 (O.S.)"
+func ParseHistoricalDate(s string) (HistoricalDate, bool) {
+	d, rest, ok := matchDate(s, false)
+	if !ok || strings.Trim(rest, " ,.;)]") != "" {
+		return HistoricalDate{}, false
+	}
+	return d.HistoricalDate, true
+}
+
+// LeadingDate parses a date at the start of s, ignoring whatever follows it,
+// as in an infobox "Born" cell: "c. 470 BC Alopece, Athens"
+func LeadingDate(s string) (HistoricalDate, bool) {
+	s = strings.TrimSpace(hiddenISODate.ReplaceAllString(strings.TrimSpace(s), ""))
+	d, _, ok := matchDate(s, false)
+	if !ok || !d.strong {
+		return HistoricalDate{}, false
+	}
+	return d.HistoricalDate, true
+}
+
+// ParseDateRange parses "384–322 BC", "c. 470 – 399 BC",
+// "428/427 or 424/423 – 348 BC" or "14 March 1879 – 18 April 1955".
+// Alternative years widen a date's earliest and latest bounds. An era written only on one end applies to
+// both when that reads sensibly, so "384–322 BC" is entirely BCE.
+func ParseDateRange(s string) (from, to HistoricalDate, ok bool) {
+	s = strings.TrimSpace(s)
+	for _, loc := range rangeSeparator.FindAllStringIndex(s, -1) {
+		startText, endText := s[:loc[0]], s[loc[1]:]
+		start, rest, okStart := matchDate(startText, false)
+		if !okStart || strings.TrimSpace(rest) != "" {
+			continue
+		}
+		end, rest, okEnd := matchDate(endText, false)
+		if !okEnd || strings.Trim(rest, " ,.;") != "" {
+			continue
+		}
+		if !start.strong && !end.strong {
+			continue
+		}
+
+		if !start.explicitEra && end.explicitEra && end.Year < 0 {
+			start, _, _ = matchDate(startText, true)
+		}
+		if start.explicitEra && start.Year < 0 && !end.explicitEra && end.Year <= -start.Year {
+			// "63 BC – 14" counting down is still BC
+			end, _, _ = matchDate(endText, true)
+		}
+		return start.HistoricalDate, end.HistoricalDate, true
+	}
+	return HistoricalDate{}, HistoricalDate{}, false
+}
+
+// footnotePattern matches citation markers such as [1], [a] or [note 2]
+var footnotePattern = regexp.MustCompile(`\[(?:\d+|[a-z]|note \d+|citation needed)\]`)
+
+// parentheticalPattern matches innermost parenthesized text
+var parentheticalPattern = regexp.MustCompile(`\(([^()]*)\)`)
+
+// FindLifespan looks for birth and death dates in the parentheses that
+// usually follow a name in an article's opening sentence, such as
+// "Socrates (Ancient Greek: Σωκράτης; c. 470 – 399 BC)" or "(born 1950)".
+// A lone floruit date is returned as the birth date with Floruit set.
+func FindLifespan(text string) (birth, death HistoricalDate) {
+	text = footnotePattern.ReplaceAllString(text, "")
+	for _, m := range parentheticalPattern.FindAllStringSubmatch(text, -1) {
+		for _, part := range strings.Split(m[1], ";") {
+			part = strings.TrimSpace(part)
+			lower := strings.ToLower(part)
+
+			switch {
+			case strings.HasPrefix(lower, "born "), strings.HasPrefix(lower, "b. "):
+				if d, ok := LeadingDate(part[strings.Index(part, " ")+1:]); ok {
+					return d, HistoricalDate{}
+				}
+			case strings.HasPrefix(lower, "died "), strings.HasPrefix(lower, "d. "):
+				if d, ok := LeadingDate(part[strings.Index(part, " ")+1:]); ok {
+					return HistoricalDate{}, d
+				}
+			default:
+				if from, to, ok := ParseDateRange(part); ok {
+					return from, to
+				}
+				// "fl. c. 300 BC" is all some ancient figures have
+				if d, ok := ParseHistoricalDate(part); ok && d.Floruit {
+					return d, HistoricalDate{}
+				}
+			}
+		}
+	}
+	return HistoricalDate{}, HistoricalDate{}
+}
@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestFindLifespan(t *testing.T) {
+	tests := []struct {
+		text         string
+		birth, death HistoricalDate
+	}{
+		{
+			"Socrates (Ancient Greek: Σωκράτης; c. 470 – 399 BC) was a Greek philosopher",
+			HistoricalDate{Year: -470, Precision: PrecisionYear, Circa: true, Earliest: -475, Latest: -465},
+			HistoricalDate{Year: -399, Precision: PrecisionYear, Earliest: -399, Latest: -399},
+		},
+		{
+			"Plato (/ˈpleɪtoʊ/ PLAY-toe; Greek: Πλάτων; 428/427 or 424/423 – 348 BC) was an ancient Greek philosopher",
+			HistoricalDate{Year: -428, Precision: PrecisionYear, Earliest: -428, Latest: -423},
+			HistoricalDate{Year: -348, Precision: PrecisionYear, Earliest: -348, Latest: -348},
+		},
+		{
+			"Alexander III of Macedon (Ancient Greek: Ἀλέξανδρος; 20/21 July 356 BC – 10/11 June 323 BC), commonly known as Alexander the Great",
+			HistoricalDate{Year: -356, Month: 7, Day: 20, Precision: PrecisionMonth, Earliest: -356, Latest: -356},
+			HistoricalDate{Year: -323, Month: 6, Day: 10, Precision: PrecisionMonth, Earliest: -323, Latest: -323},
+		},
+		{
+			"Confucius (孔子; pinyin: Kǒngzǐ; c. 551 – c. 479 BCE) was a Chinese philosopher",
+			HistoricalDate{Year: -551, Precision: PrecisionYear, Circa: true, Earliest: -556, Latest: -546},
+			HistoricalDate{Year: -479, Precision: PrecisionYear, Circa: true, Earliest: -484, Latest: -474},
+		},
+		{
+			"Gaius Julius Caesar (12 July 100 BC – 15 March 44 BC) was a Roman general",
+			HistoricalDate{Year: -100, Month: 7, Day: 12, Precision: PrecisionDay, Earliest: -100, Latest: -100},
+			HistoricalDate{Year: -44, Month: 3, Day: 15, Precision: PrecisionDay, Earliest: -44, Latest: -44},
+		},
+		{
+			"Sir Isaac Newton (25 December 1642 – 20 March 1726/27[a]) was an English polymath",
+			HistoricalDate{Year: 1642, Month: 12, Day: 25, Precision: PrecisionDay, Earliest: 1642, Latest: 1642},
+			HistoricalDate{Year: 1727, Month: 3, Day: 20, Precision: PrecisionDay, Earliest: 1727, Latest: 1727, Calendar: CalendarJulian},
+		},
+		{
+			"Euclid (/ˈjuːklɪd/; Ancient Greek: Εὐκλείδης; fl. 300 BC) was an ancient Greek mathematician",
+			HistoricalDate{Year: -300, Precision: PrecisionYear, Floruit: true, Earliest: -300, Latest: -300},
+			HistoricalDate{},
+		},
+		{
+			"Barack Obama (born August 4, 1961) is an American politician",
+			HistoricalDate{Year: 1961, Month: 8, Day: 4, Precision: PrecisionDay, Earliest: 1961, Latest: 1961},
+			HistoricalDate{},
+		},
+	}
+	for _, tt := range tests {
+		birth, death := FindLifespan(tt.text)
+		if birth != tt.birth || death != tt.death {
+			t.Errorf("FindLifespan(%q)\n = %#v, %#v\nwant %#v, %#v", tt.text, birth, death, tt.birth, tt.death)
+		}
+	}
+}
+
+func TestParseDateRangeAlternatives(t *testing.T) {
+	tests := []struct {
+		text     string
+		from, to string // as rendered by String
+	}{
+		{"470/469 – 399 BC", "470 BCE/469 BCE", "399 BCE"},
+		{"428/427 or 424/423 – 348 BC", "428 BCE/423 BCE", "348 BCE"},
+		{"384 or 383 – 322 BC", "384 BCE/383 BCE", "322 BCE"},
+		{"20 or 21 July 356 BC – 323 BC", "356 BCE", "323 BCE"},
+		{"1726/27 – 1800", "1727", "1800"},
+	}
+	for _, tt := range tests {
+		from, to, ok := ParseDateRange(tt.text)
+		if !ok || from.String() != tt.from || to.String() != tt.to {
+			t.Errorf("ParseDateRange(%q) = %s, %s, %v; want %s, %s", tt.text, from, to, ok, tt.from, tt.to)
+		}
+	}
+}
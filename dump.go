@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrOffline is returned for requests to Wikipedia or Wikidata made while
+// offline mode is on
+var ErrOffline = errors.New("offline mode is on; Wikipedia is not contacted")
+
+// offlineTransport refuses every request while offline mode is on. It sits
+// behind the page cache, so cached pages are still served.
+type offlineTransport struct {
+	next    http.RoundTripper
+	enabled atomic.Bool
+}
+
+func (t *offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.enabled.Load() {
+		return nil, ErrOffline
+	}
+	return t.next.RoundTrip(req)
+}
+
+// errNotInDump is reported for names a dump has no article for
+var errNotInDump = fmt.Errorf("%w in the dump", ErrPageNotFound)
+
+// dumpProgressEvery is how many people or articles are processed between
+// progress updates of an import that isn't limited to given names
+const dumpProgressEvery = 100
+
+// dumpPage is a page element of a MediaWiki XML dump, as written by
+// Special:Export and dumps.wikimedia.org
+type dumpPage struct {
+	Title    string `xml:"title"`
+	NS       int    `xml:"ns"`
+	Redirect *struct {
+		Title string `xml:"title,attr"`
+	} `xml:"redirect"`
+	Text string `xml:"revision>text"`
+}
+
+// readDump streams the articles in a MediaWiki XML dump, bzip2-compressed or
+// not, calling fn for each page in the main namespace in the order they
+// appear. It stops early if fn fails or ctx is canceled.
+func readDump(ctx context.Context, path string, fn func(page *dumpPage) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, 1<<20)
+	var input io.Reader = reader
+	if magic, _ := reader.Peek(3); bytes.Equal(magic, []byte("BZh")) {
+		input = bzip2.NewReader(reader)
+	}
+
+	decoder := xml.NewDecoder(input)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading dump: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "page" {
+			continue
+		}
+
+		var page dumpPage
+		if err := decoder.DecodeElement(&page, &start); err != nil {
+			return fmt.Errorf("error reading dump: %w", err)
+		}
+		if page.NS != 0 {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(&page); err != nil {
+			return err
+		}
+	}
+}
+
+var (
+	headingPattern      = regexp.MustCompile(`^={2,6}\s*(.*?)\s*={2,6}$`)
+	firstHeadingPattern = regexp.MustCompile(`(?m)^==[^=]`)
+	// disambiguationTemplatePattern matches the templates marking pages that
+	// list articles rather than describe one person
+	disambiguationTemplatePattern = regexp.MustCompile(`(?i)\{\{\s*(disambiguation|disambig|dab|hndis|geodis|surname|given name|set index)\s*[|}]`)
+	// personCategoryPattern matches the categories given to biographies
+	personCategoryPattern = regexp.MustCompile(`(?i)\[\[\s*Category\s*:\s*(living people|[^\]|]*\b(births|deaths)\b)`)
+)
+
+// trailingSections end an article's prose; what follows is lists of
+// sources and links
+var trailingSections = map[string]bool{
+	"see also": true, "notes": true, "references": true, "citations": true,
+	"sources": true, "bibliography": true, "further reading": true, "external links": true,
+}
+
+// pageFromWikitext builds from an article's wikitext the same page the
+// MediaWiki API returns, less what only the API knows: the Wikidata ID.
+// Disambiguation pages yield a *DisambiguationError.
+func pageFromWikitext(title, wikitext string) (*WikiPage, error) {
+	if disambiguationTemplatePattern.MatchString(wikitext) {
+		options := articleLinks(wikitext)
+		if len(options) > maxDisambiguationOptions {
+			options = options[:maxDisambiguationOptions]
+		}
+		return nil, &DisambiguationError{Title: title, Options: options}
+	}
+
+	lead := wikitext
+	if loc := firstHeadingPattern.FindStringIndex(wikitext); loc != nil {
+		lead = wikitext[:loc[0]]
+	}
+	page := &WikiPage{
+		Title:   title,
+		Extract: articleText(lead),
+		Infobox: parseInfobox(lead),
+		Links:   articleLinks(lead),
+	}
+	if image := page.Infobox["image"]; image != "" {
+		image = strings.TrimPrefix(strings.TrimPrefix(image, "File:"), "Image:")
+		page.ImageURL = commonsFileURL(image)
+	}
+	return page, nil
+}
+
+// looksLikePerson reports whether an article is a biography: its infobox
+// gives a birth, death or floruit, or it is in a births, deaths or living
+// people category
+func looksLikePerson(page *WikiPage, wikitext string) bool {
+	for _, field := range []string{"birth_date", "death_date", "floruit"} {
+		if page.Infobox[field] != "" {
+			return true
+		}
+	}
+	return personCategoryPattern.MatchString(wikitext)
+}
+
+// articleText renders wikitext as plain text like the API's extracts: one
+// paragraph or heading per line, without infoboxes, tables, images or the
+// sections listing sources
+func articleText(wikitext string) string {
+	wikitext = commentPattern.ReplaceAllString(wikitext, "")
+	wikitext = refPattern.ReplaceAllString(wikitext, "")
+	wikitext = stripBlocks(wikitext)
+
+	var lines []string
+	for _, line := range strings.Split(wikitext, "\n") {
+		line = strings.TrimSpace(line)
+		if heading := headingPattern.FindStringSubmatch(line); heading != nil {
+			if trailingSections[strings.ToLower(heading[1])] {
+				break
+			}
+			lines = append(lines, wikitextToPlain(heading[1]))
+			continue
+		}
+		if strings.HasPrefix(line, "|") || strings.HasPrefix(line, "!") || strings.HasPrefix(line, "__") {
+			continue // stray table rows and behavior switches
+		}
+		if text := wikitextToPlain(line); text != "" {
+			lines = append(lines, text)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// stripBlocks removes templates and tables that start a line, such as
+// infoboxes and navigation boxes, and file and category links anywhere.
+// Templates within a paragraph are kept so that dates can be rendered.
+func stripBlocks(wikitext string) string {
+	var out strings.Builder
+	for i := 0; i < len(wikitext); {
+		atLineStart := i == 0 || wikitext[i-1] == '\n'
+		rest := wikitext[i:]
+		switch {
+		case atLineStart && (strings.HasPrefix(rest, "{{") || strings.HasPrefix(rest, "{|")):
+			i += blockLength(rest)
+		case strings.HasPrefix(rest, "[[") && isMediaLink(rest[2:]):
+			i += linkLength(rest)
+		default:
+			out.WriteByte(wikitext[i])
+			i++
+		}
+	}
+	return out.String()
+}
+
+// blockLength returns the length of the template or table at the start of
+// s, including anything nested in it, or len(s) if it is unterminated
+func blockLength(s string) int {
+	depth := 0
+	for i := 0; i+1 < len(s); i++ {
+		atLineStart := i == 0 || s[i-1] == '\n'
+		switch {
+		case s[i:i+2] == "{{", s[i:i+2] == "{|" && atLineStart:
+			depth++
+			i++
+		case s[i:i+2] == "}}", s[i:i+2] == "|}" && atLineStart:
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(s)
+}
+
+// linkLength returns the length of the link at the start of s, including
+// links nested in its caption, or len(s) if it is unterminated
+func linkLength(s string) int {
+	depth := 0
+	for i := 0; i+1 < len(s); i++ {
+		switch s[i : i+2] {
+		case "[[":
+			depth++
+			i++
+		case "]]":
+			depth--
+			i++
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(s)
+}
+
+// isMediaLink reports whether a link target names a file or category
+func isMediaLink(target string) bool {
+	target = strings.ToLower(strings.TrimSpace(target))
+	for _, prefix := range []string{"file:", "image:", "category:"} {
+		if strings.HasPrefix(target, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// importDump builds people and relationships from a MediaWiki XML dump
+// without contacting Wikipedia, running the same extraction as scraping on
+// the dump's wikitext. With names, only those articles are imported,
+// following redirects; without, every biography in the dump is, and the job
+// counts them in its summary rather than having an item for each. The dump
+// is read twice: once to find everyone, so that the names of people later
+// in the dump are known, then again to find and store the relationships in
+// each article. Wikidata isn't consulted, so only relationships inferred
+// from the text are found.
+func (ws *WikipediaService) importDump(ctx context.Context, path string, names []string, update func(func(*Job))) error {
+	// Item indexes waiting for each lowercased title: the names asked for,
+	// then the targets of their redirects
+	waiting := map[string][]int{}
+	redirected := map[string][]int{}
+	for i, name := range names {
+		key := strings.ToLower(name)
+		waiting[key] = append(waiting[key], i)
+	}
+
+	imported := map[string]string{} // lowercased title -> person ID
+	claimed := map[string][]int{}   // person ID -> indexes of the items they satisfy
+	people := map[string]*Person{}  // person ID -> person, for the items claimed
+	var summary JobSummary
+	unreported := 0
+
+	// report saves the summary of an import without names, a batch of
+	// changes at a time since every update rewrites the job
+	report := func() {
+		totals := summary
+		unreported = 0
+		update(func(job *Job) { job.Summary = &totals })
+	}
+	progress := func() {
+		if unreported++; unreported == dumpProgressEvery {
+			report()
+		}
+	}
+	claim := func(id string, indexes []int) {
+		claimed[id] = append(claimed[id], indexes...)
+		person := people[id]
+		update(func(job *Job) {
+			for _, i := range indexes {
+				job.Items[i].State = JobRunning
+				job.Items[i].Person = person
+			}
+		})
+	}
+	fail := func(title string, indexes []int, err error, reason FailureReason) {
+		if len(names) > 0 {
+			update(func(job *Job) {
+				for _, i := range indexes {
+					job.Items[i].State = JobFailed
+					job.Items[i].Error = err.Error()
+					job.Items[i].Reason = reason
+				}
+			})
+			return
+		}
+		summary.Failed++
+		if summary.Failed <= maxJobFailures {
+			update(func(job *Job) {
+				job.Items = append(job.Items, JobItem{Name: title, State: JobFailed, Error: err.Error(), Reason: reason})
+			})
+		}
+		progress()
+	}
+	add := func(key string, person *Person, indexes []int) {
+		imported[key] = person.ID
+		if len(names) > 0 {
+			people[person.ID] = person
+			claim(person.ID, indexes)
+			return
+		}
+		if summary.Imported++; summary.Imported%dumpProgressEvery == 0 {
+			log.Printf("Dump import has found %d people", summary.Imported)
+		}
+		progress()
+	}
+	// store adds relationships found in the article about the person with
+	// the given ID
+	store := func(id string, connections []Connection) {
+		added := storeConnections(ws.store, ws.temporal.filter(ws.store, connections))
+		if len(names) == 0 {
+			summary.Connections += len(added)
+			return
+		}
+		if len(added) == 0 {
+			return
+		}
+		indexes := claimed[id]
+		update(func(job *Job) {
+			for _, i := range indexes {
+				job.Items[i].Connections += len(added)
+			}
+			job.Connections = append(job.Connections, added...)
+		})
+	}
+
+	err := readDump(ctx, path, func(page *dumpPage) error {
+		key := strings.ToLower(page.Title)
+		indexes := append(append([]int{}, waiting[key]...), redirected[key]...)
+		if page.Redirect != nil {
+			if len(waiting[key]) > 0 {
+				target := strings.ToLower(page.Redirect.Title)
+				if id, ok := imported[target]; ok {
+					claim(id, waiting[key])
+				} else {
+					redirected[target] = append(redirected[target], waiting[key]...)
+				}
+				delete(waiting, key)
+			}
+			return nil
+		}
+		if _, ok := imported[key]; ok || (len(names) > 0 && len(indexes) == 0) {
+			return nil
+		}
+		delete(waiting, key)
+		delete(redirected, key)
+
+		person, reason, err := ws.importArticle(page, len(names) == 0)
+		if err != nil {
+			log.Printf("Error importing %s: %v", page.Title, err)
+			fail(page.Title, indexes, err, reason)
+		} else if person != nil {
+			add(key, person, indexes)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, indexes := range waiting {
+		fail("", indexes, errNotInDump, ReasonNotFound)
+	}
+
+	// Redirect targets that came before their redirects are imported on the
+	// second pass, so their names must be known before it starts. Until they
+	// are, relationships with them are held back.
+	pending := map[string]bool{}
+	for key := range redirected {
+		ws.scraper.addName(key)
+		pending[createIDFromName(key)] = true
+	}
+	var deferred []Connection
+
+	err = readDump(ctx, path, func(page *dumpPage) error {
+		if page.Redirect != nil {
+			return nil
+		}
+		key := strings.ToLower(page.Title)
+		id, ok := imported[key]
+		if indexes, waited := redirected[key]; waited && !ok {
+			delete(redirected, key)
+			delete(pending, createIDFromName(key))
+			person, reason, err := ws.importArticle(page, false)
+			if err != nil {
+				log.Printf("Error importing %s: %v", page.Title, err)
+				fail(page.Title, indexes, err, reason)
+				return nil
+			}
+			add(key, person, indexes)
+			id, ok = person.ID, true
+		}
+		if !ok {
+			return nil
+		}
+
+		inferred, err := ws.scraper.analyzeRelationships(id, articleText(page.Text))
+		if err != nil {
+			return err
+		}
+		ready := inferred[:0]
+		for _, conn := range inferred {
+			if pending[conn.Target] {
+				deferred = append(deferred, conn)
+			} else {
+				ready = append(ready, conn)
+			}
+		}
+		store(id, ready)
+		if len(names) == 0 {
+			progress()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, indexes := range redirected {
+		fail("", indexes, errNotInDump, ReasonNotFound)
+	}
+	for _, conn := range deferred {
+		store(conn.Source, []Connection{conn})
+	}
+
+	if len(names) == 0 {
+		report()
+		return nil
+	}
+	update(func(job *Job) {
+		for _, indexes := range claimed {
+			for _, i := range indexes {
+				job.Items[i].State = JobDone
+			}
+		}
+	})
+	return nil
+}
+
+// importArticle builds a person from an article in a dump and adds them to
+// the graph, as scraping would. With biographiesOnly, articles that don't
+// look like biographies are skipped, returning no person and no error.
+func (ws *WikipediaService) importArticle(page *dumpPage, biographiesOnly bool) (*Person, FailureReason, error) {
+	wikiPage, err := pageFromWikitext(page.Title, page.Text)
+	if biographiesOnly && (err != nil || !looksLikePerson(wikiPage, page.Text)) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, failureReason(err), err
+	}
+	person := personFromPage(wikiPage)
+	if err := ValidatePerson(*person); err != nil {
+		if biographiesOnly {
+			return nil, "", nil
+		}
+		return nil, ReasonInvalid, err
+	}
+	// People already in the graph still have their relationships found
+	if err := ws.store.AddPerson(*person); err != nil && !errors.Is(err, ErrPersonExists) {
+		return nil, ReasonStorage, err
+	}
+	ws.scraper.register(person)
+	return person, "", nil
+}
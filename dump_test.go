@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testDump writes a MediaWiki XML dump of the given pages, each a title and
+// its wikitext, or "#REDIRECT [[target]]"
+func testDump(t *testing.T, pages ...[2]string) string {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("<mediawiki>\n")
+	for _, page := range pages {
+		redirect := ""
+		if target, ok := strings.CutPrefix(page[1], "#REDIRECT [["); ok {
+			redirect = fmt.Sprintf(`<redirect title="%s" />`, strings.TrimSuffix(target, "]]"))
+		}
+		fmt.Fprintf(&b, "<page><title>%s</title><ns>0</ns>%s<revision><text>%s</text></revision></page>\n", page[0], redirect, page[1])
+	}
+	b.WriteString("</mediawiki>\n")
+	path := filepath.Join(t.TempDir(), "dump.xml")
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func biography(birth, death, text string) string {
+	return fmt.Sprintf("{{Infobox philosopher\n| birth_date = %s\n| death_date = %s\n}}\n%s\n", birth, death, text)
+}
+
+var philosophersDump = [][2]string{
+	{"Socrates", biography("c. 470 BC", "399 BC", "Socrates was the teacher of Plato in Athens.")},
+	{"Plato", biography("428/427 BC", "348 BC", "Plato was a student of Socrates.")},
+	{"Aristocles", "#REDIRECT [[Plato]]"},
+	{"Athens", "Athens is a city in Greece."},
+}
+
+// runImport runs importDump as the job manager would, applying its updates
+// to a job with an item per name
+func runImport(t *testing.T, store GraphStore, path string, names []string) Job {
+	t.Helper()
+	jobs, _ := NewJobManager("")
+	ws := NewWikipediaService(store, DefaultConfig(), localLease{}, jobs)
+	defer ws.Close()
+
+	job := Job{}
+	for _, name := range names {
+		job.Items = append(job.Items, JobItem{Name: name, State: JobQueued})
+	}
+	err := ws.importDump(context.Background(), path, names, func(change func(*Job)) { change(&job) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	job.State = JobDone
+	return job
+}
+
+func TestImportDumpNames(t *testing.T) {
+	store := NewMemoryStore()
+	job := runImport(t, store, testDump(t, philosophersDump...), []string{"Socrates", "Aristocles", "Nobody"})
+
+	// Plato's article comes before the redirect to it, so he is imported on
+	// the second pass, after Socrates' relationship with him was found
+	want := []struct {
+		state       JobState
+		person      string
+		connections int
+		reason      FailureReason
+	}{
+		{JobDone, "socrates", 1, ""},
+		{JobDone, "plato", 1, ""},
+		{JobFailed, "", 0, ReasonNotFound},
+	}
+	for i, item := range job.Items {
+		id := ""
+		if item.Person != nil {
+			id = item.Person.ID
+		}
+		if item.State != want[i].state || id != want[i].person || item.Connections != want[i].connections || item.Reason != want[i].reason {
+			t.Errorf("item %s = %s %q %d %s, want %+v", item.Name, item.State, id, item.Connections, item.Reason, want[i])
+		}
+	}
+	if len(job.Connections) != 2 || job.Summary != nil {
+		t.Errorf("job connections = %v, summary = %+v", job.Connections, job.Summary)
+	}
+	if _, err := store.ConnectionBetween("socrates", "plato"); err != nil {
+		t.Errorf("socrates -> plato: %v", err)
+	}
+	if _, err := store.ConnectionBetween("plato", "socrates"); err != nil {
+		t.Errorf("plato -> socrates: %v", err)
+	}
+}
+
+func TestImportDumpEverything(t *testing.T) {
+	store := NewMemoryStore()
+	job := runImport(t, store, testDump(t, philosophersDump...), nil)
+
+	if job.Summary == nil || *job.Summary != (JobSummary{Imported: 2, Connections: 2}) {
+		t.Errorf("summary = %+v", job.Summary)
+	}
+	if len(job.Items) != 0 || len(job.Connections) != 0 {
+		t.Errorf("job has %d items and %d connections, want only the summary", len(job.Items), len(job.Connections))
+	}
+	if people, _ := store.ListPeople(); len(people) != 2 {
+		t.Errorf("imported %v", personIDs(people))
+	}
+	if doc, status := jobResults(job); doc.Succeeded != 2 || doc.Failed != 0 || status != 200 {
+		t.Errorf("results = %+v, %d", doc, status)
+	}
+}
+
+// failingStore refuses to add anyone
+type failingStore struct {
+	GraphStore
+}
+
+func (failingStore) AddPerson(Person) error {
+	return errors.New("disk full")
+}
+
+func TestImportDumpKeepsFirstFailures(t *testing.T) {
+	var pages [][2]string
+	for i := 0; i < maxJobFailures+5; i++ {
+		pages = append(pages, [2]string{fmt.Sprintf("Person %d", i), biography("1900", "1950", "")})
+	}
+	job := runImport(t, failingStore{NewMemoryStore()}, testDump(t, pages...), nil)
+
+	if job.Summary == nil || job.Summary.Failed != maxJobFailures+5 || job.Summary.Imported != 0 {
+		t.Errorf("summary = %+v", job.Summary)
+	}
+	if len(job.Items) != maxJobFailures || job.Items[0].Name != "Person 0" || job.Items[0].Reason != ReasonStorage {
+		t.Errorf("%d failure items, first %+v", len(job.Items), job.Items[0])
+	}
+	if doc, status := jobResults(job); doc.Failed != maxJobFailures+5 || status != 207 {
+		t.Errorf("results failed = %d, status %d", doc.Failed, status)
+	}
+}
@@ -0,0 +1,637 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	walFileName      = "graph.wal"
+	snapshotFileName = "graph.snapshot.json"
+	lockFileName     = "graph.lock"
+)
+
+// FsyncPolicy controls when the write-ahead log is flushed to stable storage
+type FsyncPolicy string
+
+const (
+	FsyncAlways   FsyncPolicy = "always"   // fsync after every record
+	FsyncInterval FsyncPolicy = "interval" // fsync in the background every SyncInterval
+	FsyncNever    FsyncPolicy = "never"    // leave flushing to the operating system
+)
+
+// ParseFsyncPolicy converts a configuration string into an FsyncPolicy
+func ParseFsyncPolicy(s string) (FsyncPolicy, error) {
+	switch policy := FsyncPolicy(s); policy {
+	case FsyncAlways, FsyncInterval, FsyncNever:
+		return policy, nil
+	case "":
+		return FsyncInterval, nil
+	default:
+		return "", fmt.Errorf("unknown fsync policy %q (want always, interval or never)", s)
+	}
+}
+
+// FileStoreOptions configures a FileStore
+type FileStoreOptions struct {
+	Dir              string        // directory holding the WAL and snapshot
+	Fsync            FsyncPolicy   // when to fsync the WAL
+	SyncInterval     time.Duration // how often to fsync under FsyncInterval
+	SnapshotEvery    int           // snapshot after this many WAL records (0 disables)
+	SnapshotInterval time.Duration // snapshot at least this often when there are new records (0 disables)
+}
+
+// walRecord is a single mutation in the write-ahead log
+type walRecord struct {
+	Seq        uint64      `json:"seq"`
+	Op         string      `json:"op"`
+	Person     *Person     `json:"person,omitempty"`
+	Connection *Connection `json:"connection,omitempty"`
+	ID         string      `json:"id,omitempty"`
+	Source     string      `json:"source,omitempty"` // legacy remove_connection records
+	Target     string      `json:"target,omitempty"` // legacy remove_connection records
+}
+
+// WAL operations
+const (
+	opPutPerson        = "put_person"
+	opDeletePerson     = "delete_person"
+	opAddConnection    = "add_connection"
+	opPutConnection    = "put_connection"
+	opRemoveConnection = "remove_connection"
+)
+
+// graphSnapshot is the on-disk form of a full copy of the graph
+type graphSnapshot struct {
+	Seq   uint64    `json:"seq"`
+	Taken time.Time `json:"taken"`
+	Graph GraphData `json:"graph"`
+}
+
+// FileStore is a GraphStore that keeps the graph in memory and makes it
+// durable with an append-only write-ahead log plus periodic snapshots.
+// Each WAL line is "<crc32 hex> <json record>".
+type FileStore struct {
+	*MemoryStore
+
+	opts     FileStoreOptions
+	lock     *os.File   // holds the data directory lock while open
+	mu       sync.Mutex // serializes writes so WAL order matches apply order
+	wal      *os.File
+	writer   *bufio.Writer
+	seq      uint64 // sequence number of the last record written
+	size     int64  // length of the WAL, where the next record starts
+	pending  int    // records written since the last snapshot
+	dirty    bool   // records written since the last fsync
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     sync.WaitGroup
+	closed   bool
+}
+
+// OpenFileStore opens (or creates) a file-backed store in opts.Dir,
+// replaying the latest snapshot and WAL to rebuild the graph. It fails if
+// another process has the directory open, since each process keeps its own
+// copy of the graph and a snapshot by one would discard the other's records.
+func OpenFileStore(opts FileStoreOptions) (_ *FileStore, err error) {
+	if opts.Fsync == "" {
+		opts.Fsync = FsyncInterval
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = time.Second
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating data directory: %w", err)
+	}
+	lock, err := lockDir(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil && lock != nil {
+			lock.Close()
+		}
+	}()
+
+	fs := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		opts:        opts,
+		lock:        lock,
+		stop:        make(chan struct{}),
+	}
+
+	if err := fs.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := fs.replayWAL(); err != nil {
+		return nil, err
+	}
+
+	wal, err := os.OpenFile(fs.walPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening WAL: %w", err)
+	}
+	info, err := wal.Stat()
+	if err != nil {
+		wal.Close()
+		return nil, fmt.Errorf("error reading WAL: %w", err)
+	}
+	fs.wal = wal
+	fs.writer = bufio.NewWriter(wal)
+	fs.size = info.Size()
+
+	fs.done.Add(1)
+	go fs.background()
+
+	return fs, nil
+}
+
+func (fs *FileStore) walPath() string {
+	return filepath.Join(fs.opts.Dir, walFileName)
+}
+
+func (fs *FileStore) snapshotPath() string {
+	return filepath.Join(fs.opts.Dir, snapshotFileName)
+}
+
+// loadSnapshot restores the graph from the snapshot file, if there is one
+func (fs *FileStore) loadSnapshot() error {
+	data, err := os.ReadFile(fs.snapshotPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading snapshot: %w", err)
+	}
+
+	var snap graphSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("error parsing snapshot: %w", err)
+	}
+
+	for _, person := range snap.Graph.Nodes {
+		fs.MemoryStore.PutPerson(person)
+	}
+	for _, conn := range snap.Graph.Links {
+		fs.MemoryStore.AddConnection(conn)
+	}
+	fs.seq = snap.Seq
+	return nil
+}
+
+// replayWAL applies every WAL record newer than the snapshot. A torn or
+// corrupt final record (e.g. from a crash mid-write) is truncated away;
+// corruption anywhere else is reported as an error.
+func (fs *FileStore) replayWAL() error {
+	f, err := os.OpenFile(fs.walPath(), os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error opening WAL: %w", err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var offset int64
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(line) == 0 && readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil && readErr != io.EOF {
+			return fmt.Errorf("error reading WAL: %w", readErr)
+		}
+
+		record, parseErr := decodeWALRecord(line)
+		if parseErr == nil && readErr == io.EOF {
+			parseErr = errors.New("missing record terminator")
+		}
+		if parseErr != nil {
+			// Only the final record may be damaged
+			if _, peekErr := reader.Peek(1); peekErr != io.EOF {
+				return fmt.Errorf("corrupt WAL record at offset %d: %w", offset, parseErr)
+			}
+			log.Printf("Truncating torn WAL record at offset %d: %v", offset, parseErr)
+			if err := f.Truncate(offset); err != nil {
+				return fmt.Errorf("error truncating WAL: %w", err)
+			}
+			return f.Sync()
+		}
+
+		offset += int64(len(line))
+		if record.Seq <= fs.seq {
+			continue // already covered by the snapshot
+		}
+		if err := fs.apply(record); err != nil {
+			log.Printf("Skipping WAL record %d (%s): %v", record.Seq, record.Op, err)
+		}
+		fs.seq = record.Seq
+		fs.pending++
+	}
+}
+
+// decodeWALRecord verifies the checksum of a WAL line and decodes it
+func decodeWALRecord(line []byte) (walRecord, error) {
+	var record walRecord
+
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	sum, payload, ok := bytes.Cut(line, []byte(" "))
+	if !ok {
+		return record, errors.New("malformed record")
+	}
+	want, err := strconv.ParseUint(string(sum), 16, 32)
+	if err != nil {
+		return record, fmt.Errorf("malformed checksum: %w", err)
+	}
+	if crc32.ChecksumIEEE(payload) != uint32(want) {
+		return record, errors.New("checksum mismatch")
+	}
+	if err := json.Unmarshal(payload, &record); err != nil {
+		return record, err
+	}
+	return record, nil
+}
+
+// apply makes the change a single record describes to the in-memory graph
+func (fs *FileStore) apply(record walRecord) error {
+	var err error
+	switch record.Op {
+	case opPutPerson:
+		if record.Person != nil {
+			err = fs.MemoryStore.PutPerson(*record.Person)
+		}
+	case opDeletePerson:
+		err = fs.MemoryStore.DeletePerson(record.ID)
+	case opAddConnection:
+		if record.Connection != nil {
+			_, err = fs.MemoryStore.AddConnection(*record.Connection)
+		}
+	case opPutConnection:
+		if record.Connection != nil {
+			err = fs.MemoryStore.UpdateConnection(*record.Connection)
+		}
+	case opRemoveConnection:
+		id := record.ID
+		if id == "" {
+			// Written before connections had IDs
+			id = fs.connectionIDFor(record.Source, record.Target)
+		}
+		err = fs.MemoryStore.RemoveConnection(id)
+	default:
+		err = fmt.Errorf("unknown operation %q", record.Op)
+	}
+	return err
+}
+
+// write makes a change durable and then applies it, so the in-memory graph
+// never holds a change the WAL lost. Callers must hold fs.mu and have
+// checked that the change applies cleanly.
+func (fs *FileStore) write(record walRecord) error {
+	if err := fs.append(record); err != nil {
+		return err
+	}
+	if err := fs.apply(record); err != nil {
+		return err
+	}
+
+	if fs.opts.SnapshotEvery > 0 && fs.pending >= fs.opts.SnapshotEvery {
+		if err := fs.snapshot(); err != nil {
+			log.Printf("Error writing snapshot: %v", err)
+		}
+	}
+	return nil
+}
+
+// append writes a record to the WAL, syncing it under FsyncAlways. If that
+// fails, the WAL is cut back to where the record started. Callers must hold
+// fs.mu.
+func (fs *FileStore) append(record walRecord) error {
+	if fs.closed {
+		return errors.New("file store is closed")
+	}
+
+	record.Seq = fs.seq + 1
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(fs.writer, "%08x ", crc32.ChecksumIEEE(payload))
+	fs.writer.Write(payload)
+	fs.writer.WriteByte('\n')
+	if err := fs.writer.Flush(); err != nil {
+		fs.discardTail()
+		return fmt.Errorf("error writing WAL: %w", err)
+	}
+	if fs.opts.Fsync == FsyncAlways {
+		if err := fs.wal.Sync(); err != nil {
+			fs.discardTail()
+			return fmt.Errorf("error syncing WAL: %w", err)
+		}
+	}
+
+	fs.size += int64(len(payload)) + 10 // checksum, space and newline
+	fs.seq = record.Seq
+	fs.pending++
+	fs.dirty = fs.opts.Fsync != FsyncAlways
+	return nil
+}
+
+// discardTail drops anything written to the WAL after the last complete
+// record, so a failed append can't be replayed later
+func (fs *FileStore) discardTail() {
+	if err := fs.wal.Truncate(fs.size); err != nil {
+		log.Printf("Error truncating WAL after a failed write: %v", err)
+	}
+	fs.writer.Reset(fs.wal)
+}
+
+func (fs *FileStore) PutPerson(person Person) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.write(walRecord{Op: opPutPerson, Person: &person})
+}
+
+func (fs *FileStore) AddPerson(person Person) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	err := fs.checked(func() error {
+		if fs.hasPerson(person.ID) {
+			return ErrPersonExists
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return fs.write(walRecord{Op: opPutPerson, Person: &person})
+}
+
+func (fs *FileStore) UpdatePerson(person Person) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.checkPerson(person.ID); err != nil {
+		return err
+	}
+	return fs.write(walRecord{Op: opPutPerson, Person: &person})
+}
+
+func (fs *FileStore) SetMetric(id, name string, value float64) error {
+	return fs.ModifyPerson(id, func(person *Person) error {
+		if person.Metrics == nil {
+			person.Metrics = make(map[string]float64)
+		}
+		person.Metrics[name] = value
+		return nil
+	})
+}
+
+func (fs *FileStore) SetGroup(id string, group int) error {
+	return fs.ModifyPerson(id, func(person *Person) error {
+		person.Group = group
+		return nil
+	})
+}
+
+func (fs *FileStore) ModifyPerson(id string, modify func(*Person) error) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	// Holding fs.mu keeps every other write out until this one is logged
+	person, err := fs.MemoryStore.GetPerson(id)
+	if err != nil {
+		return err
+	}
+	before := person.clone()
+	if err := modify(&person); err != nil {
+		return err
+	}
+	person.ID = id
+	if reflect.DeepEqual(person, before) {
+		return nil
+	}
+	return fs.write(walRecord{Op: opPutPerson, Person: &person})
+}
+
+func (fs *FileStore) DeletePerson(id string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.checkPerson(id); err != nil {
+		return err
+	}
+	return fs.write(walRecord{Op: opDeletePerson, ID: id})
+}
+
+func (fs *FileStore) AddConnection(conn Connection) (Connection, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.checked(func() error { return fs.checkAddConnection(conn) }); err != nil {
+		return Connection{}, err
+	}
+	if conn.ID == "" {
+		conn.ID = newConnectionID()
+	}
+	if err := fs.write(walRecord{Op: opAddConnection, Connection: &conn}); err != nil {
+		return Connection{}, err
+	}
+	return conn, nil
+}
+
+func (fs *FileStore) UpdateConnection(conn Connection) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.checked(func() error { return fs.checkUpdateConnection(conn) }); err != nil {
+		return err
+	}
+	return fs.write(walRecord{Op: opPutConnection, Connection: &conn})
+}
+
+func (fs *FileStore) RemoveConnection(id string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	err := fs.checked(func() error {
+		if _, ok := fs.connectionIndex[id]; !ok {
+			return ErrConnectionNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return fs.write(walRecord{Op: opRemoveConnection, ID: id})
+}
+
+// checkPerson returns ErrPersonNotFound unless the person exists
+func (fs *FileStore) checkPerson(id string) error {
+	return fs.checked(func() error {
+		if !fs.hasPerson(id) {
+			return ErrPersonNotFound
+		}
+		return nil
+	})
+}
+
+// connectionIDFor looks up the ID of the source->target connection
+func (fs *FileStore) connectionIDFor(source, target string) string {
+	conn, _ := fs.MemoryStore.ConnectionBetween(source, target)
+	return conn.ID
+}
+
+// Snapshot writes the current graph to disk and resets the WAL
+func (fs *FileStore) Snapshot() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.closed {
+		return errors.New("file store is closed")
+	}
+	return fs.snapshot()
+}
+
+// snapshot atomically replaces the snapshot file and truncates the WAL.
+// Callers must hold fs.mu.
+func (fs *FileStore) snapshot() error {
+	graph, err := fs.MemoryStore.Graph()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(graphSnapshot{Seq: fs.seq, Taken: time.Now().UTC(), Graph: graph})
+	if err != nil {
+		return err
+	}
+
+	tmpPath := fs.snapshotPath() + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("error creating snapshot: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error syncing snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, fs.snapshotPath()); err != nil {
+		return fmt.Errorf("error installing snapshot: %w", err)
+	}
+	syncDir(fs.opts.Dir)
+
+	// Every record is now covered by the snapshot. If we crash before the
+	// truncate, replay skips records with seq <= snapshot seq.
+	if err := fs.wal.Truncate(0); err != nil {
+		return fmt.Errorf("error truncating WAL: %w", err)
+	}
+	fs.writer.Reset(fs.wal)
+	fs.size = 0
+	fs.pending = 0
+	fs.dirty = false
+	return nil
+}
+
+// background fsyncs the WAL and takes periodic snapshots
+func (fs *FileStore) background() {
+	defer fs.done.Done()
+
+	syncTicker := time.NewTicker(fs.opts.SyncInterval)
+	defer syncTicker.Stop()
+
+	var snapshotC <-chan time.Time
+	if fs.opts.SnapshotInterval > 0 {
+		snapshotTicker := time.NewTicker(fs.opts.SnapshotInterval)
+		defer snapshotTicker.Stop()
+		snapshotC = snapshotTicker.C
+	}
+
+	for {
+		select {
+		case <-fs.stop:
+			return
+		case <-syncTicker.C:
+			if fs.opts.Fsync != FsyncInterval {
+				continue
+			}
+			fs.mu.Lock()
+			if fs.dirty && !fs.closed {
+				if err := fs.wal.Sync(); err != nil {
+					log.Printf("Error syncing WAL: %v", err)
+				} else {
+					fs.dirty = false
+				}
+			}
+			fs.mu.Unlock()
+		case <-snapshotC:
+			fs.mu.Lock()
+			if fs.pending > 0 && !fs.closed {
+				if err := fs.snapshot(); err != nil {
+					log.Printf("Error writing snapshot: %v", err)
+				}
+			}
+			fs.mu.Unlock()
+		}
+	}
+}
+
+// Close takes a final snapshot and releases the WAL
+func (fs *FileStore) Close() error {
+	fs.stopOnce.Do(func() { close(fs.stop) })
+	fs.done.Wait()
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.closed {
+		return nil
+	}
+
+	var err error
+	if fs.pending > 0 {
+		err = fs.snapshot()
+	}
+	if syncErr := fs.wal.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := fs.wal.Close(); err == nil {
+		err = closeErr
+	}
+	if fs.lock != nil {
+		fs.lock.Close()
+	}
+	fs.closed = true
+	return err
+}
+
+// syncDir fsyncs a directory so a rename inside it is durable
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
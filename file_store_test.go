@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func openTestFileStore(t *testing.T, dir string) *FileStore {
+	t.Helper()
+	fs, err := OpenFileStore(FileStoreOptions{Dir: dir, Fsync: FsyncAlways})
+	if err != nil {
+		t.Fatalf("OpenFileStore: %v", err)
+	}
+	return fs
+}
+
+// writeTestWAL closes a store holding two people, without a snapshot, and
+// returns the lines of its WAL
+func writeTestWAL(t *testing.T, dir string) []string {
+	t.Helper()
+	fs := openTestFileStore(t, dir)
+	for _, id := range []string{"socrates", "plato"} {
+		if err := fs.AddPerson(Person{ID: id, Name: id}); err != nil {
+			t.Fatalf("AddPerson(%s): %v", id, err)
+		}
+	}
+	// Close without snapshotting so every record stays in the WAL
+	fs.stopOnce.Do(func() { close(fs.stop) })
+	fs.done.Wait()
+	fs.wal.Close()
+	fs.lock.Close()
+	fs.closed = true
+
+	data, err := os.ReadFile(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return walLines(data)
+}
+
+// walLines splits a WAL into lines, keeping their newlines
+func walLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func TestFileStoreReplaysTornWAL(t *testing.T) {
+	tests := []struct {
+		name    string
+		damage  func(lines []string) []string
+		want    []string // people after reopening
+		wantErr bool
+	}{
+		{
+			name:   "intact",
+			damage: func(lines []string) []string { return lines },
+			want:   []string{"socrates", "plato"},
+		},
+		{
+			name: "final record cut short",
+			damage: func(lines []string) []string {
+				last := lines[len(lines)-1]
+				return append(lines[:len(lines)-1], last[:len(last)/2])
+			},
+			want: []string{"socrates"},
+		},
+		{
+			name: "final record missing its newline",
+			damage: func(lines []string) []string {
+				return append(lines[:len(lines)-1], strings.TrimSuffix(lines[len(lines)-1], "\n"))
+			},
+			want: []string{"socrates"},
+		},
+		{
+			name: "final record with a bad checksum",
+			damage: func(lines []string) []string {
+				return append(lines[:len(lines)-1], "00000000"+lines[len(lines)-1][8:])
+			},
+			want: []string{"socrates"},
+		},
+		{
+			name: "corrupt record before the end",
+			damage: func(lines []string) []string {
+				return append([]string{"00000000" + lines[0][8:]}, lines[1:]...)
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			lines := writeTestWAL(t, dir)
+			walPath := filepath.Join(dir, walFileName)
+			if err := os.WriteFile(walPath, []byte(strings.Join(tt.damage(lines), "")), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			fs, err := OpenFileStore(FileStoreOptions{Dir: dir, Fsync: FsyncAlways})
+			if tt.wantErr {
+				if err == nil {
+					fs.Close()
+					t.Fatal("expected an error for a corrupt WAL")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("OpenFileStore: %v", err)
+			}
+			defer fs.Close()
+
+			people, _ := fs.ListPeople()
+			var got []string
+			for _, person := range people {
+				got = append(got, person.ID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("people = %v, want %v", got, tt.want)
+			}
+
+			// The torn tail is gone, so new records follow the last good one
+			if err := fs.AddPerson(Person{ID: "aristotle", Name: "Aristotle"}); err != nil {
+				t.Fatalf("AddPerson after replay: %v", err)
+			}
+			data, _ := os.ReadFile(walPath)
+			for i, line := range walLines(data) {
+				if _, err := decodeWALRecord([]byte(line)); err != nil {
+					t.Fatalf("WAL line %d after replay: %v", i+1, err)
+				}
+			}
+		})
+	}
+}
+
+func TestFileStoreFailedWriteLeavesMemoryUntouched(t *testing.T) {
+	fs := openTestFileStore(t, t.TempDir())
+	defer fs.Close()
+	if err := fs.AddPerson(Person{ID: "socrates", Name: "Socrates"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.AddPerson(Person{ID: "plato", Name: "Plato"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Make every WAL write fail
+	fs.wal.Close()
+
+	if err := fs.AddPerson(Person{ID: "aristotle", Name: "Aristotle"}); err == nil {
+		t.Fatal("AddPerson succeeded without a WAL")
+	}
+	if _, err := fs.GetPerson("aristotle"); !errors.Is(err, ErrPersonNotFound) {
+		t.Fatalf("GetPerson after a failed write: %v, want ErrPersonNotFound", err)
+	}
+	if _, err := fs.AddConnection(Connection{Source: "socrates", Target: "plato"}); err == nil {
+		t.Fatal("AddConnection succeeded without a WAL")
+	}
+	if conns, _ := fs.ListConnections(); len(conns) != 0 {
+		t.Fatalf("connections after a failed write: %v", conns)
+	}
+	if err := fs.DeletePerson("plato"); err == nil {
+		t.Fatal("DeletePerson succeeded without a WAL")
+	}
+	if _, err := fs.GetPerson("plato"); err != nil {
+		t.Fatalf("GetPerson after a failed delete: %v", err)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build unix
+
+package main
+
+import "testing"
+
+func TestFileStoreLocksDataDirectory(t *testing.T) {
+	dir := t.TempDir()
+	fs := openTestFileStore(t, dir)
+
+	if second, err := OpenFileStore(FileStoreOptions{Dir: dir}); err == nil {
+		second.Close()
+		t.Fatal("a second store opened the same directory")
+	}
+
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fs = openTestFileStore(t, dir)
+	fs.Close()
+}
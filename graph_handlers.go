@@ -0,0 +1,679 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// GraphService serves the core graph API on top of a GraphStore
+type GraphService struct {
+	store    GraphStore
+	temporal TemporalPolicy // how to treat connections impossible given lifespans
+}
+
+// NewGraphService creates a new graph service backed by the given store
+func NewGraphService(store GraphStore, temporal TemporalPolicy) *GraphService {
+	return &GraphService{store: store, temporal: temporal}
+}
+
+// GetGraphData returns the complete network
+func (gs *GraphService) GetGraphData(w http.ResponseWriter, r *http.Request) {
+	graph, err := gs.store.Graph()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(graph)
+}
+
+// GetEgoNetwork returns the neighborhood of a person up to ?depth= hops
+func (gs *GraphService) GetEgoNetwork(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	q := r.URL.Query()
+
+	depth := 1
+	if d, err := optionalInt(q, "depth"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if d != nil {
+		depth = *d
+	}
+	if depth < 0 || depth > maxEgoDepth {
+		http.Error(w, fmt.Sprintf("depth must be between 0 and %d", maxEgoDepth), http.StatusBadRequest)
+		return
+	}
+
+	filter := ConnectionFilter{Types: splitList(q.Get("types"))}
+	if minStrength, err := optionalInt(q, "min_strength"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if minStrength != nil {
+		filter.MinStrength = *minStrength
+	}
+
+	graph, err := EgoNetwork(gs.store, id, depth, filter)
+	if errors.Is(err, ErrPersonNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(graph)
+}
+
+// GetPath finds how two people are connected. ?weighted=true ranks paths by
+// relationship strength instead of hop count and ?k=N returns alternatives.
+func (gs *GraphService) GetPath(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, to := q.Get("from"), q.Get("to")
+	if from == "" || to == "" {
+		http.Error(w, "Query parameters 'from' and 'to' are required", http.StatusBadRequest)
+		return
+	}
+
+	k := 1
+	if n, err := optionalInt(q, "k"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if n != nil {
+		k = *n
+	}
+	if k < 1 || k > maxPaths {
+		http.Error(w, fmt.Sprintf("k must be between 1 and %d", maxPaths), http.StatusBadRequest)
+		return
+	}
+
+	var weight edgeWeight
+	if q.Get("weighted") == "true" {
+		weight = strengthWeight
+	}
+
+	net, err := loadNetwork(gs.store)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !net.has(from) || !net.has(to) {
+		http.Error(w, "Person not found", http.StatusNotFound)
+		return
+	}
+
+	routes := net.shortestPaths(from, to, k, weight)
+	if len(routes) == 0 {
+		http.Error(w, fmt.Sprintf("No path between %s and %s", from, to), http.StatusNotFound)
+		return
+	}
+
+	response := struct {
+		From     string `json:"from"`
+		To       string `json:"to"`
+		Weighted bool   `json:"weighted"`
+		Paths    []Path `json:"paths"`
+	}{
+		From:     from,
+		To:       to,
+		Weighted: weight != nil,
+	}
+	for _, route := range routes {
+		response.Paths = append(response.Paths, net.toPath(route))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetCentrality ranks people by ?metric= (degree, weighted_degree,
+// betweenness, closeness, eigenvector or pagerank). A POST also stores each
+// score in the person's metrics map under the metric name.
+func (gs *GraphService) GetCentrality(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	metric := q.Get("metric")
+	if _, ok := centralityMetrics[metric]; !ok {
+		http.Error(w, "Query parameter 'metric' must be one of "+strings.Join(CentralityMetricNames(), ", "), http.StatusBadRequest)
+		return
+	}
+
+	limit, err := optionalInt(q, "limit")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if limit != nil && *limit < 1 {
+		http.Error(w, "limit must be positive", http.StatusBadRequest)
+		return
+	}
+
+	scores, err := ComputeCentrality(gs.store, metric)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	stored := false
+	if r.Method == http.MethodPost {
+		if err := StoreMetric(gs.store, metric, scores); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		stored = true
+	}
+
+	if limit != nil && *limit < len(scores) {
+		scores = scores[:*limit]
+	}
+
+	response := struct {
+		Metric string            `json:"metric"`
+		Stored bool              `json:"stored"`
+		Scores []CentralityScore `json:"scores"`
+	}{
+		Metric: metric,
+		Stored: stored,
+		Scores: scores,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DetectCommunities partitions the network into communities. The optional
+// JSON body selects the algorithm and whether to write the result into each
+// person's group.
+func (gs *GraphService) DetectCommunities(w http.ResponseWriter, r *http.Request) {
+	var opts CommunityOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := opts.normalize(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := DetectCommunities(gs.store, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// AuditTemporal lists every connection that contradicts the lifespans of
+// the people it joins
+func (gs *GraphService) AuditTemporal(w http.ResponseWriter, r *http.Request) {
+	issues, checked, err := AuditTemporal(gs.store)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Checked int             `json:"checked"`
+		Issues  []TemporalIssue `json:"issues"`
+	}{
+		Checked: checked,
+		Issues:  issues,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetGraphAt returns the network as it existed in ?year= (negative or
+// suffixed with BCE for years before the common era). ?mode=born keeps
+// people who had died by then.
+func (gs *GraphService) GetGraphAt(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("year") == "" {
+		http.Error(w, "Query parameter 'year' is required", http.StatusBadRequest)
+		return
+	}
+	year, err := parseYear(q.Get("year"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mode, err := ParseSnapshotMode(q.Get("mode"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	graph, err := GraphAt(gs.store, year, mode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(graph)
+}
+
+// GetTimeline returns how the network changed between ?from= and ?to=,
+// one frame every ?step= years
+func (gs *GraphService) GetTimeline(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("from") == "" || q.Get("to") == "" {
+		http.Error(w, "Query parameters 'from' and 'to' are required", http.StatusBadRequest)
+		return
+	}
+	from, err := parseYear(q.Get("from"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := parseYear(q.Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	step := 10
+	if n, err := optionalInt(q, "step"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if n != nil {
+		step = *n
+	}
+	mode, err := ParseSnapshotMode(q.Get("mode"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := timelineYears(from, to, step); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	frames, err := Timeline(gs.store, from, to, step, mode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		From   int             `json:"from"`
+		To     int             `json:"to"`
+		Step   int             `json:"step"`
+		Mode   SnapshotMode    `json:"mode"`
+		Frames []TimelineFrame `json:"frames"`
+	}{
+		From:   from,
+		To:     to,
+		Step:   step,
+		Mode:   mode,
+		Frames: frames,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetPeople returns a filtered, sorted page of historical figures
+func (gs *GraphService) GetPeople(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter, err := parsePersonFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, err := parseListOptions(q, personSortFields)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	people, err := gs.store.ListPeople()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	matched := []Person{}
+	for _, person := range people {
+		if filter.Matches(person) {
+			matched = append(matched, person)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(paginate(matched, personSortFields, opts))
+}
+
+// GetPersonDetails returns a single historical figure
+func (gs *GraphService) GetPersonDetails(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	person, err := gs.store.GetPerson(id)
+	if errors.Is(err, ErrPersonNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(person)
+}
+
+// GetConnections returns a filtered, sorted page of connections
+func (gs *GraphService) GetConnections(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter, err := parseConnectionFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts, err := parseListOptions(q, connectionSortFields)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	connections, err := gs.store.ListConnections()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	matched := []Connection{}
+	for _, conn := range connections {
+		if filter.Matches(conn) {
+			matched = append(matched, conn)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(paginate(matched, connectionSortFields, opts))
+}
+
+// AddPerson stores a new historical figure
+func (gs *GraphService) AddPerson(w http.ResponseWriter, r *http.Request) {
+	var person Person
+	if err := json.NewDecoder(r.Body).Decode(&person); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	person.normalizeDates()
+	if err := ValidatePerson(person); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	err := gs.store.AddPerson(person)
+	if errors.Is(err, ErrPersonExists) {
+		http.Error(w, fmt.Sprintf("Person %q already exists", person.ID), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(person)
+}
+
+// ReplacePerson overwrites every field of an existing historical figure
+func (gs *GraphService) ReplacePerson(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var person Person
+	if err := json.NewDecoder(r.Body).Decode(&person); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	gs.updatePerson(w, r, id, person)
+}
+
+// PatchPerson updates only the fields present in the request body
+func (gs *GraphService) PatchPerson(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	person, err := gs.store.GetPerson(id)
+	if errors.Is(err, ErrPersonNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Decoding onto the existing person leaves absent fields untouched
+	if err := json.Unmarshal(body, &person); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Whichever of the integer year and the structured date was sent
+	// replaces the other
+	if _, ok := fields["birth"]; !ok && fields["yearBirth"] != nil {
+		person.Birth = nil
+	} else if ok {
+		person.YearBirth = 0
+	}
+	if _, ok := fields["death"]; !ok && fields["yearDeath"] != nil {
+		person.Death = nil
+	} else if ok {
+		person.YearDeath = 0
+	}
+	gs.updatePerson(w, r, id, person)
+}
+
+// updatePerson stores an edited person under the ID from the URL
+func (gs *GraphService) updatePerson(w http.ResponseWriter, r *http.Request, id string, person Person) {
+	if person.ID == "" {
+		person.ID = id
+	}
+	if person.ID != id {
+		http.Error(w, "Person ID cannot be changed", http.StatusBadRequest)
+		return
+	}
+	person.normalizeDates()
+	if err := ValidatePerson(person); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	err := gs.store.UpdatePerson(person)
+	if errors.Is(err, ErrPersonNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(person)
+}
+
+// DeletePerson removes a historical figure and all of their connections
+func (gs *GraphService) DeletePerson(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	err := gs.store.DeletePerson(id)
+	if errors.Is(err, ErrPersonNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetConnection returns a single connection
+func (gs *GraphService) GetConnection(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	connection, err := gs.store.GetConnection(id)
+	if errors.Is(err, ErrConnectionNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(connection)
+}
+
+// AddConnection stores a new connection between two existing people
+func (gs *GraphService) AddConnection(w http.ResponseWriter, r *http.Request) {
+	var connection Connection
+	if err := json.NewDecoder(r.Body).Decode(&connection); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := ValidateConnection(connection); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if err := gs.temporal.guard(gs.store, connection); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	connection, err := gs.store.AddConnection(connection)
+	if !writeConnectionError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(connection)
+}
+
+// ReplaceConnection overwrites every field of an existing connection
+func (gs *GraphService) ReplaceConnection(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var connection Connection
+	if err := json.NewDecoder(r.Body).Decode(&connection); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	gs.updateConnection(w, r, id, connection)
+}
+
+// PatchConnection updates only the fields present in the request body
+func (gs *GraphService) PatchConnection(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	connection, err := gs.store.GetConnection(id)
+	if errors.Is(err, ErrConnectionNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&connection); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	gs.updateConnection(w, r, id, connection)
+}
+
+// updateConnection stores an edited connection under the ID from the URL
+func (gs *GraphService) updateConnection(w http.ResponseWriter, r *http.Request, id string, connection Connection) {
+	if connection.ID == "" {
+		connection.ID = id
+	}
+	if connection.ID != id {
+		http.Error(w, "Connection ID cannot be changed", http.StatusBadRequest)
+		return
+	}
+	if err := ValidateConnection(connection); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if err := gs.temporal.guard(gs.store, connection); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	err := gs.store.UpdateConnection(connection)
+	if errors.Is(err, ErrConnectionNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if !writeConnectionError(w, err) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(connection)
+}
+
+// DeleteConnection removes a single connection
+func (gs *GraphService) DeleteConnection(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	err := gs.store.RemoveConnection(id)
+	if errors.Is(err, ErrConnectionNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeConnectionError maps a store error from adding or updating a
+// connection to an HTTP response. It returns true if err was nil.
+func writeConnectionError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrPersonNotFound):
+		http.Error(w, "Source or target person does not exist", http.StatusBadRequest)
+	case errors.Is(err, ErrConnectionExists):
+		http.Error(w, "Connection already exists", http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	return false
+}
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobState is the state of a job or of one of its items
+type JobState string
+
+const (
+	JobQueued   JobState = "queued"
+	JobRunning  JobState = "running"
+	JobDone     JobState = "done"
+	JobFailed   JobState = "failed"
+	JobCanceled JobState = "canceled"
+)
+
+// finished reports whether the state is final
+func (s JobState) finished() bool {
+	return s == JobDone || s == JobFailed || s == JobCanceled
+}
+
+const (
+	// jobHistory is how many finished jobs are kept
+	jobHistory = 100
+	// jobStaleAfter is how long an unfinished job may go without progress
+	// before it is assumed that the replica running it died
+	jobStaleAfter = 5 * time.Minute
+	// jobHeartbeat is how often a running job is saved even without
+	// progress, so that a long quiet stretch doesn't make it look stale
+	jobHeartbeat = jobStaleAfter / 5
+)
+
+// Errors returned by JobManager
+var (
+	ErrJobNotFound  = errors.New("job not found")
+	ErrJobFinished  = errors.New("job has already finished")
+	ErrJobElsewhere = errors.New("job is running on another replica")
+)
+
+// JobItem is one unit of a job's work, such as one name in a batch scrape
+type JobItem struct {
+	Name        string        `json:"name"`
+	State       JobState      `json:"state"`
+	Person      *Person       `json:"person,omitempty"`
+	Connections int           `json:"connections"` // relationships added for this item
+	Error       string        `json:"error,omitempty"`
+	Reason      FailureReason `json:"reason,omitempty"` // why the item failed
+}
+
+// Job is a long-running piece of work done in the background
+type Job struct {
+	ID          string           `json:"id"`
+	Type        string           `json:"type"`
+	State       JobState         `json:"state"`
+	Replica     string           `json:"replica"` // the replica running the job
+	CreatedAt   time.Time        `json:"createdAt"`
+	StartedAt   *time.Time       `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time       `json:"finishedAt,omitempty"`
+	UpdatedAt   time.Time        `json:"updatedAt"`
+	Counts      map[JobState]int `json:"counts"` // items in each state
+	Items       []JobItem        `json:"items"`
+	Connections []Connection     `json:"connections"` // relationships added
+	Summary     *JobSummary      `json:"summary,omitempty"`
+	Error       string           `json:"error,omitempty"`
+}
+
+// maxJobFailures is how many failures a job with a summary keeps as items
+const maxJobFailures = 100
+
+// JobSummary totals the work of a job too large for an item per name, such
+// as importing every biography in a dump. Its items are only the first
+// maxJobFailures failures, and the relationships it added aren't listed.
+type JobSummary struct {
+	Imported    int `json:"imported"` // people added, or found already in the graph
+	Failed      int `json:"failed"`
+	Connections int `json:"connections"` // relationships added
+}
+
+// copy returns a snapshot that is safe to read while the job continues
+func (j *Job) copy() Job {
+	snapshot := *j
+	snapshot.Items = append([]JobItem{}, j.Items...)
+	snapshot.Connections = append([]Connection{}, j.Connections...)
+	if j.Summary != nil {
+		summary := *j.Summary
+		snapshot.Summary = &summary
+	}
+	snapshot.Counts = map[JobState]int{}
+	for _, item := range j.Items {
+		snapshot.Counts[item.State]++
+	}
+	return snapshot
+}
+
+// finish moves the job and its unfinished items to a final state
+func (j *Job) finish(state JobState, reason string) {
+	now := time.Now().UTC()
+	j.State = state
+	j.FinishedAt = &now
+	j.UpdatedAt = now
+	if state != JobDone {
+		j.Error = reason
+	}
+	for i := range j.Items {
+		if !j.Items[i].State.finished() {
+			j.Items[i].State = JobCanceled
+			j.Items[i].Error = reason
+			j.Items[i].Reason = ReasonCanceled
+		}
+	}
+}
+
+// JobFunc does a job's work. It reports progress by passing changes to
+// update and should return promptly once ctx is canceled.
+type JobFunc func(ctx context.Context, update func(change func(*Job))) error
+
+// JobManager runs jobs one at a time, in the order they were submitted, and
+// keeps their history. With a directory, each job is saved to its own file
+// there as it progresses, so history survives restarts and replicas sharing
+// the directory can report each other's jobs.
+type JobManager struct {
+	dir string // "" keeps jobs in memory only
+
+	mu      sync.Mutex
+	jobs    map[string]*Job // jobs started here; with a directory, only unfinished ones
+	queue   []queuedJob     // jobs waiting for the running one to finish
+	running *Job
+	cancel  context.CancelFunc // cancels the running job
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+type queuedJob struct {
+	job  *Job
+	work JobFunc
+}
+
+// NewJobManager creates a job manager saving jobs in dir, or in memory if dir
+// is "". Jobs this replica left unfinished when it last stopped are marked
+// as interrupted.
+func NewJobManager(dir string) (*JobManager, error) {
+	m := &JobManager{
+		dir:  dir,
+		jobs: map[string]*Job{},
+	}
+	if dir == "" {
+		return m, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating jobs directory: %w", err)
+	}
+
+	jobs, err := m.loadAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		if !job.State.finished() && job.Replica == replicaName() {
+			job.finish(JobFailed, "interrupted by a server restart")
+			if err := m.save(job); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return m, nil
+}
+
+// newJobID generates a random, URL-safe job ID
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("error generating job ID: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// Start queues a job with an item for each name and runs it in the background
+func (m *JobManager) Start(jobType string, names []string, work JobFunc) (Job, error) {
+	now := time.Now().UTC()
+	job := &Job{
+		ID:          newJobID(),
+		Type:        jobType,
+		State:       JobQueued,
+		Replica:     replicaName(),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Items:       make([]JobItem, len(names)),
+		Connections: []Connection{},
+	}
+	for i, name := range names {
+		job.Items[i] = JobItem{Name: name, State: JobQueued}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return Job{}, fmt.Errorf("job manager is closed")
+	}
+	if err := m.save(job); err != nil {
+		return Job{}, err
+	}
+	m.jobs[job.ID] = job
+	m.queue = append(m.queue, queuedJob{job: job, work: work})
+	m.next()
+	return job.copy(), nil
+}
+
+// next starts the first queued job if none is running. The caller must hold
+// the lock.
+func (m *JobManager) next() {
+	if m.running != nil || len(m.queue) == 0 || m.closed {
+		return
+	}
+	queued := m.queue[0]
+	m.queue = m.queue[1:]
+
+	now := time.Now().UTC()
+	queued.job.State = JobRunning
+	queued.job.StartedAt = &now
+	queued.job.UpdatedAt = now
+	if err := m.save(queued.job); err != nil {
+		log.Printf("Error saving job %s: %v", queued.job.ID, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.running, m.cancel = queued.job, cancel
+	m.wg.Add(1)
+	go m.run(ctx, queued)
+}
+
+// run does a job's work and records the outcome
+func (m *JobManager) run(ctx context.Context, queued queuedJob) {
+	defer m.wg.Done()
+	job := queued.job
+	done := make(chan struct{})
+	go m.heartbeat(job, done)
+	err := queued.work(ctx, func(change func(*Job)) { m.update(job, change) })
+	close(done)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cancel()
+	m.running, m.cancel = nil, nil
+	m.complete(job, err)
+	m.next()
+}
+
+// heartbeat saves a running job every jobHeartbeat until done is closed
+func (m *JobManager) heartbeat(job *Job, done <-chan struct{}) {
+	ticker := time.NewTicker(jobHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			m.update(job, func(*Job) {})
+		}
+	}
+}
+
+// update applies a change to a job under the lock and saves it
+func (m *JobManager) update(job *Job, change func(*Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	change(job)
+	job.UpdatedAt = time.Now().UTC()
+	if err := m.save(job); err != nil {
+		log.Printf("Error saving job %s: %v", job.ID, err)
+	}
+}
+
+// complete records how a job ended and forgets it once saved. The caller
+// must hold the lock.
+func (m *JobManager) complete(job *Job, err error) {
+	switch {
+	case errors.Is(err, context.Canceled) && m.closed:
+		job.finish(JobFailed, "interrupted by server shutdown")
+	case errors.Is(err, context.Canceled):
+		job.finish(JobCanceled, "canceled")
+	case err != nil:
+		job.finish(JobFailed, err.Error())
+	default:
+		job.finish(JobDone, "")
+	}
+	log.Printf("Job %s %s", job.ID, job.State)
+
+	if err := m.save(job); err != nil {
+		log.Printf("Error saving job %s: %v", job.ID, err)
+	}
+	if m.dir != "" {
+		delete(m.jobs, job.ID)
+	}
+	m.prune()
+}
+
+// Get returns the job with the given ID
+func (m *JobManager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if job, ok := m.jobs[id]; ok {
+		return job.copy(), nil
+	}
+	if m.dir == "" || !validJobID(id) {
+		return Job{}, ErrJobNotFound
+	}
+	job, err := m.load(filepath.Join(m.dir, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return Job{}, ErrJobNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+	return job.copy(), nil
+}
+
+// List returns every job, most recent first
+func (m *JobManager) List() ([]Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	jobs := map[string]*Job{}
+	if m.dir != "" {
+		stored, err := m.loadAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, job := range stored {
+			jobs[job.ID] = job
+		}
+	}
+	for id, job := range m.jobs {
+		jobs[id] = job
+	}
+
+	list := make([]Job, 0, len(jobs))
+	for _, job := range jobs {
+		list = append(list, job.copy())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list, nil
+}
+
+// Cancel stops a queued or running job. A running job reports itself
+// canceled once its current item finishes.
+func (m *JobManager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	if job, ok := m.jobs[id]; ok && !job.State.finished() {
+		defer m.mu.Unlock()
+		if job == m.running {
+			m.cancel()
+			return job.copy(), nil
+		}
+		for i, queued := range m.queue {
+			if queued.job == job {
+				m.queue = append(m.queue[:i], m.queue[i+1:]...)
+				break
+			}
+		}
+		m.complete(job, context.Canceled)
+		return job.copy(), nil
+	}
+	m.mu.Unlock()
+
+	snapshot, err := m.Get(id)
+	if err != nil {
+		return Job{}, err
+	}
+	if !snapshot.State.finished() {
+		return snapshot, ErrJobElsewhere
+	}
+	return snapshot, ErrJobFinished
+}
+
+// Close cancels every job and waits for the running one to stop
+func (m *JobManager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	for _, queued := range m.queue {
+		m.complete(queued.job, context.Canceled)
+	}
+	m.queue = nil
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+}
+
+// validJobID guards file lookups against path traversal
+func validJobID(id string) bool {
+	_, err := hex.DecodeString(id)
+	return err == nil && id != ""
+}
+
+// save writes a job to its file, replacing the previous version atomically
+func (m *JobManager) save(job *Job) error {
+	if m.dir == "" {
+		return nil
+	}
+	snapshot := job.copy()
+	data, err := json.Marshal(&snapshot)
+	if err != nil {
+		return fmt.Errorf("error encoding job: %w", err)
+	}
+	path := filepath.Join(m.dir, job.ID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("error writing job: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error writing job: %w", err)
+	}
+	return nil
+}
+
+// load reads a saved job. An unfinished job that has made no progress for
+// jobStaleAfter is reported as failed, since the replica running it is gone.
+func (m *JobManager) load(path string) (*Job, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("error decoding job %s: %w", filepath.Base(path), err)
+	}
+	if !job.State.finished() && time.Since(job.UpdatedAt) > jobStaleAfter {
+		job.finish(JobFailed, fmt.Sprintf("replica %s stopped responding", job.Replica))
+	}
+	return &job, nil
+}
+
+// loadAll reads every saved job, skipping unreadable files
+func (m *JobManager) loadAll() ([]*Job, error) {
+	paths, err := filepath.Glob(filepath.Join(m.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var jobs []*Job
+	for _, path := range paths {
+		job, err := m.load(path)
+		if err != nil {
+			log.Printf("Skipping job file %s: %v", path, err)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// prune drops the oldest finished jobs beyond jobHistory
+func (m *JobManager) prune() {
+	var finished []*Job
+	if m.dir == "" {
+		for _, job := range m.jobs {
+			if job.State.finished() {
+				finished = append(finished, job)
+			}
+		}
+	} else {
+		stored, err := m.loadAll()
+		if err != nil {
+			log.Printf("Error listing jobs: %v", err)
+			return
+		}
+		for _, job := range stored {
+			if job.State.finished() {
+				finished = append(finished, job)
+			}
+		}
+	}
+	if len(finished) <= jobHistory {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool { return finished[i].CreatedAt.After(finished[j].CreatedAt) })
+	for _, job := range finished[jobHistory:] {
+		delete(m.jobs, job.ID)
+		if m.dir != "" {
+			if err := os.Remove(filepath.Join(m.dir, job.ID+".json")); err != nil {
+				log.Printf("Error removing job %s: %v", job.ID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+// Lease decides which replica runs scheduled work, so that replicas sharing a
+// graph don't all refresh it at once
+type Lease interface {
+	// Acquire reports whether this replica holds the lease, taking it if free
+	Acquire() (bool, error)
+	// Holder names the replica holding the lease, or "" if unknown
+	Holder() string
+	// Release gives up the lease if this replica holds it
+	Release() error
+}
+
+// localLease is always held. It suits stores that no other replica shares:
+// the in-memory store, where every replica must refresh its own copy, and the
+// file store, which only one process can open.
+type localLease struct{}
+
+func (localLease) Acquire() (bool, error) { return true, nil }
+func (localLease) Holder() string         { return replicaName() }
+func (localLease) Release() error         { return nil }
+
+// replicaName identifies this replica: the pod name under Kubernetes
+func replicaName() string {
+	if name, err := os.Hostname(); err == nil && name != "" {
+		return name
+	}
+	return "unknown"
+}
+
+// readHolder returns the replica name recorded in a lease file
+func readHolder(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
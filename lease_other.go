@@ -0,0 +1,18 @@
+//go:build !unix
+
+package main
+
+// FileLease falls back to always being held on platforms without flock, so
+// only a single replica should run there
+type FileLease struct {
+	path string
+}
+
+// NewFileLease creates a lease backed by the file at path
+func NewFileLease(path string) *FileLease {
+	return &FileLease{path: path}
+}
+
+func (l *FileLease) Acquire() (bool, error) { return true, nil }
+func (l *FileLease) Holder() string         { return replicaName() }
+func (l *FileLease) Release() error         { return nil }
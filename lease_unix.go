@@ -0,0 +1,71 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// FileLease is held by whichever replica has an exclusive lock on a file in
+// the shared data directory. The lock is kept until Release or until the
+// process exits, when the operating system frees it for another replica.
+type FileLease struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File // open and locked while the lease is held
+}
+
+// NewFileLease creates a lease backed by the file at path
+func NewFileLease(path string) *FileLease {
+	return &FileLease{path: path}
+}
+
+// Acquire takes the lock if no other replica holds it
+func (l *FileLease) Acquire() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		return true, nil
+	}
+
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return false, fmt.Errorf("error opening lease file: %w", err)
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error locking lease file: %w", err)
+	}
+
+	// Record who holds the lease, for the other replicas to report
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(replicaName()+"\n"), 0)
+	}
+	l.file = file
+	return true, nil
+}
+
+// Holder returns the replica name written by the lease's holder
+func (l *FileLease) Holder() string {
+	return readHolder(l.path)
+}
+
+// Release unlocks the file
+func (l *FileLease) Release() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close() // closing the file drops the lock
+	l.file = nil
+	return err
+}
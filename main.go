@@ -1,37 +1,79 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
-	"sync"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 // Person represents a historical figure
 type Person struct {
-	ID         string   `json:"id"`
-	Name       string   `json:"name"`
-	Era        string   `json:"era"`
-	Profession string   `json:"profession"`
-	ImageURL   string   `json:"imageUrl,omitempty"`
-	YearBirth  int      `json:"yearBirth"`
-	YearDeath  int      `json:"yearDeath,omitempty"`
-	Country    string   `json:"country"`
-	Info       string   `json:"info,omitempty"`
-	Group      int      `json:"group"` // For visualization grouping
+	ID         string             `json:"id"`
+	Name       string             `json:"name"`
+	Era        string             `json:"era"`
+	Profession string             `json:"profession"`
+	ImageURL   string             `json:"imageUrl,omitempty"`
+	YearBirth  int                `json:"yearBirth"`
+	YearDeath  int                `json:"yearDeath,omitempty"`
+	Birth      *HistoricalDate    `json:"birth,omitempty"`   // yearBirth with precision and bounds
+	Death      *HistoricalDate    `json:"death,omitempty"`   // yearDeath with precision and bounds
+	Floruit    *HistoricalDate    `json:"floruit,omitempty"` // when active, for people with unknown dates
+	Country    string             `json:"country"`
+	Info       string             `json:"info,omitempty"`
+	Group      int                `json:"group"`             // For visualization grouping
+	Metrics    map[string]float64 `json:"metrics,omitempty"` // computed analytics, e.g. pagerank
+}
+
+// clone returns a copy of the person that shares no maps with the original
+func (p Person) clone() Person {
+	for _, date := range []**HistoricalDate{&p.Birth, &p.Death, &p.Floruit} {
+		if *date != nil {
+			copied := **date
+			*date = &copied
+		}
+	}
+	if p.Metrics != nil {
+		metrics := make(map[string]float64, len(p.Metrics))
+		for name, value := range p.Metrics {
+			metrics[name] = value
+		}
+		p.Metrics = metrics
+	}
+	return p
 }
 
 // Connection represents a relationship between two historical figures
 type Connection struct {
+	ID          string `json:"id"`
 	Source      string `json:"source"`
 	Target      string `json:"target"`
-	Type        string `json:"type"`        // e.g., "mentor", "colleague", "rival", "influenced"
-	Strength    int    `json:"strength"`    // 1-10 scale
+	Type        string `json:"type"`     // e.g., "mentor", "colleague", "rival", "influenced"
+	Strength    int    `json:"strength"` // 1-10 scale
 	Description string `json:"description"`
+	Confidence  string `json:"confidence,omitempty"` // how the connection was found; empty if entered by hand
 }
 
+// Connection confidence levels
+const (
+	ConfidenceHigh = "high" // structured data such as Wikidata claims
+	ConfidenceLow  = "low"  // inferred from article text
+)
+
 // GraphData represents the complete network data
 type GraphData struct {
 	Nodes []Person     `json:"nodes"`
@@ -39,33 +81,82 @@ type GraphData struct {
 }
 
 var (
-	graphData GraphData
-	mu        sync.RWMutex
-	wikiService *WikipediaService
+	graphStore   GraphStore
+	graphService *GraphService
+	wikiService  *WikipediaService
 )
 
 func main() {
-	// Initialize with sample data
-	initSampleData()
-	
-	// Initialize Wikipedia service
-	wikiService = NewWikipediaService()
+	config, err := LoadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	cfg := config.Current()
+
+	// Initialize the graph store, seeding it with sample data when empty
+	graphStore, err = openGraphStore(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to open graph store: %v", err)
+	}
+	if people, err := graphStore.ListPeople(); err == nil && len(people) == 0 {
+		initSampleData(graphStore)
+	}
+	graphService = NewGraphService(graphStore, cfg.Graph.TemporalCheck)
+
+	// Initialize Wikipedia service, applying changed settings as they are reloaded
+	jobs, err := NewJobManager(jobsDir(cfg.Storage))
+	if err != nil {
+		log.Fatalf("Failed to open job history: %v", err)
+	}
+	wikiService = NewWikipediaService(graphStore, cfg, refreshLease(cfg), jobs)
+	config.OnReload(wikiService.Configure)
+	config.Watch()
 
 	r := mux.NewRouter()
 
 	// Original API endpoints
-	r.HandleFunc("/api/graph", getGraphData).Methods("GET")
-	r.HandleFunc("/api/people", getPeople).Methods("GET")
-	r.HandleFunc("/api/people/{id}", getPersonDetails).Methods("GET")
-	r.HandleFunc("/api/connections", getConnections).Methods("GET")
-	r.HandleFunc("/api/people", addPerson).Methods("POST")
-	r.HandleFunc("/api/connections", addConnection).Methods("POST")
+	r.HandleFunc("/api/graph", graphService.GetGraphData).Methods("GET")
+	r.HandleFunc("/api/graph/ego/{id}", graphService.GetEgoNetwork).Methods("GET")
+	r.HandleFunc("/api/graph/path", graphService.GetPath).Methods("GET")
+	r.HandleFunc("/api/graph/at", graphService.GetGraphAt).Methods("GET")
+	r.HandleFunc("/api/graph/timeline", graphService.GetTimeline).Methods("GET")
+	r.HandleFunc("/api/analytics/centrality", graphService.GetCentrality).Methods("GET", "POST")
+	r.HandleFunc("/api/analytics/communities", graphService.DetectCommunities).Methods("POST")
+	r.HandleFunc("/api/audit/temporal", graphService.AuditTemporal).Methods("GET")
+	r.HandleFunc("/api/people", graphService.GetPeople).Methods("GET")
+	r.HandleFunc("/api/people/{id}", graphService.GetPersonDetails).Methods("GET")
+	r.HandleFunc("/api/connections", graphService.GetConnections).Methods("GET")
+	r.HandleFunc("/api/people", graphService.AddPerson).Methods("POST")
+	r.HandleFunc("/api/connections", graphService.AddConnection).Methods("POST")
+
+	// Editing endpoints
+	r.HandleFunc("/api/people/{id}", graphService.ReplacePerson).Methods("PUT")
+	r.HandleFunc("/api/people/{id}", graphService.PatchPerson).Methods("PATCH")
+	r.HandleFunc("/api/people/{id}", graphService.DeletePerson).Methods("DELETE")
+	r.HandleFunc("/api/connections/{id}", graphService.GetConnection).Methods("GET")
+	r.HandleFunc("/api/connections/{id}", graphService.ReplaceConnection).Methods("PUT")
+	r.HandleFunc("/api/connections/{id}", graphService.PatchConnection).Methods("PATCH")
+	r.HandleFunc("/api/connections/{id}", graphService.DeleteConnection).Methods("DELETE")
 
 	// Wikipedia API endpoints
 	r.HandleFunc("/api/wikipedia/search", wikiService.SearchWikipedia).Methods("GET")
 	r.HandleFunc("/api/wikipedia/scrape", wikiService.ScrapeHistoricalFigure).Methods("POST")
 	r.HandleFunc("/api/wikipedia/relationships/{id}", wikiService.FindRelationships).Methods("GET")
 	r.HandleFunc("/api/wikipedia/batch-scrape", wikiService.BatchScrape).Methods("POST")
+	r.HandleFunc("/api/wikipedia/crawl", wikiService.StartCrawl).Methods("POST")
+	r.HandleFunc("/api/wikipedia/crawl", wikiService.GetCrawlStatus).Methods("GET")
+	r.HandleFunc("/api/wikipedia/refresh", wikiService.TriggerRefresh).Methods("POST")
+	r.HandleFunc("/api/wikipedia/refresh", wikiService.GetRefreshStatus).Methods("GET")
+	r.HandleFunc("/api/wikipedia/cache", wikiService.GetCacheStats).Methods("GET")
+	r.HandleFunc("/api/wikipedia/cache", wikiService.PurgeCache).Methods("DELETE")
+	r.HandleFunc("/api/wikipedia/import-dump", wikiService.ImportDump).Methods("POST")
+	r.HandleFunc("/api/jobs", wikiService.ListJobs).Methods("GET")
+	r.HandleFunc("/api/jobs/{id}", wikiService.GetJob).Methods("GET")
+	r.HandleFunc("/api/jobs/{id}/results", wikiService.GetJobResults).Methods("GET")
+	r.HandleFunc("/api/jobs/{id}", wikiService.CancelJob).Methods("DELETE")
 	r.HandleFunc("/api/wikipedia/extract-entities", wikiService.ExtractEntitiesFromText).Methods("POST")
 	r.HandleFunc("/api/wikipedia/analyze-relationship", wikiService.AnalyzeTextRelationships).Methods("POST")
 
@@ -73,99 +164,141 @@ func main() {
 	r.PathPrefix("/").Handler(http.FileServer(http.Dir("./static")))
 
 	// Start server
-	log.Println("Server starting on :8080...")
-	log.Fatal(http.ListenAndServe(":8080", r))
-}
+	addr := fmt.Sprintf(":%d", cfg.Server.Port)
+	server := &http.Server{Addr: addr, Handler: corsMiddleware(config, rateLimitMiddleware(config, r))}
+	go func() {
+		log.Printf("Server starting on %s...", addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
 
-func getGraphData(w http.ResponseWriter, r *http.Request) {
-	mu.RLock()
-	defer mu.RUnlock()
-	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(graphData)
-}
+	// Shut down gracefully so durable stores can flush
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
 
-func getPeople(w http.ResponseWriter, r *http.Request) {
-	mu.RLock()
-	defer mu.RUnlock()
-	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(graphData.Nodes)
+	log.Println("Shutting down...")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
+	config.Close()
+	wikiService.Close()
+	if closer, ok := graphStore.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Printf("Error closing graph store: %v", err)
+		}
+	}
 }
 
-func getPersonDetails(w http.ResponseWriter, r *http.Request) {
-	mu.RLock()
-	defer mu.RUnlock()
-	
-	vars := mux.Vars(r)
-	id := vars["id"]
-
-	for _, person := range graphData.Nodes {
-		if person.ID == id {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(person)
-			return
+// openGraphStore creates the graph store selected by the storage backend
+// ("memory", "file" or "sqlite")
+func openGraphStore(cfg StorageConfig) (GraphStore, error) {
+	switch cfg.Backend {
+	case "memory":
+		return NewMemoryStore(), nil
+	case "sqlite":
+		if err := os.MkdirAll(filepath.Dir(cfg.SQLitePath), 0o755); err != nil {
+			return nil, fmt.Errorf("error creating data directory: %w", err)
 		}
+		log.Printf("Using SQLite graph store at %s", cfg.SQLitePath)
+		return OpenSQLiteStore(cfg.SQLitePath)
+	case "file":
+		log.Printf("Using file-backed graph store in %s (fsync: %s)", cfg.DataDir, cfg.Fsync)
+		return OpenFileStore(FileStoreOptions{
+			Dir:              cfg.DataDir,
+			Fsync:            cfg.Fsync,
+			SnapshotEvery:    cfg.SnapshotEvery,
+			SnapshotInterval: time.Duration(cfg.SnapshotInterval),
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
 	}
-
-	http.NotFound(w, r)
 }
 
-func getConnections(w http.ResponseWriter, r *http.Request) {
-	mu.RLock()
-	defer mu.RUnlock()
-	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(graphData.Links)
+// refreshLease chooses how replicas agree on who refreshes. Only replicas of
+// the SQLite store share a graph, so they contend for a lock file in the data
+// directory; the file store allows a single replica, and with the in-memory
+// store each replica has its own graph to refresh.
+func refreshLease(cfg Config) Lease {
+	if cfg.Storage.Backend != "sqlite" {
+		return localLease{}
+	}
+	return NewFileLease(cfg.Wikipedia.RefreshLease)
 }
 
-func addPerson(w http.ResponseWriter, r *http.Request) {
-	mu.Lock()
-	defer mu.Unlock()
-
-	var person Person
-	if err := json.NewDecoder(r.Body).Decode(&person); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+// jobsDir is where jobs are saved: alongside the graph for the durable
+// backends, nowhere for the in-memory one
+func jobsDir(cfg StorageConfig) string {
+	if cfg.Backend == "memory" {
+		return ""
 	}
-
-	graphData.Nodes = append(graphData.Nodes, person)
-	w.WriteHeader(http.StatusCreated)
+	return filepath.Join(cfg.DataDir, "jobs")
 }
 
-func addConnection(w http.ResponseWriter, r *http.Request) {
-	mu.Lock()
-	defer mu.Unlock()
-
-	var connection Connection
-	if err := json.NewDecoder(r.Body).Decode(&connection); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
+// corsMiddleware allows cross-origin requests while api.enableCors is set
+func corsMiddleware(config *ConfigManager, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !config.Current().API.EnableCORS {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
 
-	// Validate that both source and target exist
-	sourceExists, targetExists := false, false
-	for _, person := range graphData.Nodes {
-		if person.ID == connection.Source {
-			sourceExists = true
+// rateLimitMiddleware answers 429 Too Many Requests to clients making more
+// than api.rateLimit API requests a minute; 0 turns the limit off. Clients
+// are told apart by their address (see clientAddress).
+func rateLimitMiddleware(config *ConfigManager, next http.Handler) http.Handler {
+	throttle := newAPIThrottle()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api := config.Current().API
+		if api.RateLimit == 0 || !strings.HasPrefix(r.URL.Path, "/api/") || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
 		}
-		if person.ID == connection.Target {
-			targetExists = true
+		client := clientAddress(r, api.TrustedProxyHeader)
+		if wait, ok := throttle.allow(client, api.RateLimit, time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Too many requests; try again later", http.StatusTooManyRequests)
+			return
 		}
-	}
+		next.ServeHTTP(w, r)
+	})
+}
 
-	if !sourceExists || !targetExists {
-		http.Error(w, "Source or target person does not exist", http.StatusBadRequest)
-		return
+// clientAddress returns the address a request came from. Behind a proxy every
+// connection comes from the proxy, so when header names one the proxy sets,
+// the address is taken from it: the last X-Forwarded-For entry, which the
+// proxy appended, or X-Real-IP. Only set a header a trusted proxy overwrites,
+// since clients can send any header themselves.
+func clientAddress(r *http.Request, header string) string {
+	if values := r.Header.Values(header); header != "" && len(values) > 0 {
+		entries := strings.Split(values[len(values)-1], ",")
+		if addr := strings.TrimSpace(entries[len(entries)-1]); addr != "" {
+			return addr
+		}
 	}
-
-	graphData.Links = append(graphData.Links, connection)
-	w.WriteHeader(http.StatusCreated)
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
 
-func initSampleData() {
+func initSampleData(store GraphStore) {
 	// Sample historical figures
-	graphData.Nodes = []Person{
+	people := []Person{
 		{ID: "socrates", Name: "Socrates", Era: "Ancient", Profession: "Philosopher", YearBirth: -470, YearDeath: -399, Country: "Greece", Group: 1, Info: "Classical Greek philosopher credited as the founder of Western philosophy"},
 		{ID: "plato", Name: "Plato", Era: "Ancient", Profession: "Philosopher", YearBirth: -428, YearDeath: -348, Country: "Greece", Group: 1, Info: "Student of Socrates and teacher of Aristotle"},
 		{ID: "aristotle", Name: "Aristotle", Era: "Ancient", Profession: "Philosopher", YearBirth: -384, YearDeath: -322, Country: "Greece", Group: 1, Info: "Student of Plato and founder of the Lyceum"},
@@ -175,4 +308,11 @@ func initSampleData() {
 		{ID: "darwin", Name: "Charles Darwin", Era: "Modern", Profession: "Naturalist", YearBirth: 1809, YearDeath: 1882, Country: "England", Group: 4, Info: "Known for his contributions to evolutionary theory"},
 		{ID: "davinci", Name: "Leonardo da Vinci", Era: "Renaissance", Profession: "Polymath", YearBirth: 1452, YearDeath: 1519, Country: "Italy", Group: 5, Info: "Renaissance polymath: painter, sculptor, architect, scientist, and engineer"},
 	}
-}
\ No newline at end of file
+
+	for _, person := range people {
+		person.normalizeDates()
+		if err := store.PutPerson(person); err != nil {
+			log.Printf("Error adding sample person %s: %v", person.ID, err)
+		}
+	}
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// mediaWikiEndpoint is the Action API of English Wikipedia
+	mediaWikiEndpoint = "https://en.wikipedia.org/w/api.php"
+	// userAgent identifies us to Wikimedia, which asks API clients to say who they are
+	userAgent = "HistoricalNetworkVisualizer/1.0 (https://github.com/jbrcoleman/historic-network)"
+	// maxDisambiguationOptions bounds the suggestions returned for an ambiguous name
+	maxDisambiguationOptions = 20
+	// maxTitlesPerQuery is the most titles the API accepts in one request
+	maxTitlesPerQuery = 50
+)
+
+var (
+	ErrPageNotFound   = errors.New("wikipedia page not found")
+	ErrDisambiguation = errors.New("wikipedia page is a disambiguation page")
+	// ErrUnexpectedStatus wraps responses from Wikipedia or Wikidata with an
+	// error status, such as those still throttled after every retry
+	ErrUnexpectedStatus = errors.New("unexpected status code")
+)
+
+// DisambiguationError is returned when a name leads to a disambiguation page
+// rather than an article. Options lists some of the articles it points to.
+type DisambiguationError struct {
+	Title   string
+	Options []string
+}
+
+func (e *DisambiguationError) Error() string {
+	if len(e.Options) == 0 {
+		return fmt.Sprintf("%q is a disambiguation page", e.Title)
+	}
+	return fmt.Sprintf("%q is a disambiguation page; try one of: %s", e.Title, strings.Join(e.Options, ", "))
+}
+
+func (e *DisambiguationError) Is(target error) bool {
+	return target == ErrDisambiguation
+}
+
+// WikiPage is the structured content of a Wikipedia article
+type WikiPage struct {
+	Title          string            // canonical title, after following redirects
+	RedirectedFrom string            // the title asked for, if it was a redirect
+	Extract        string            // plain text of the lead section
+	Infobox        map[string]string // infobox parameters rendered as plain text
+	WikidataID     string            // Q-identifier of the matching Wikidata item
+	ImageURL       string            // the article's lead image
+	Links          []string          // articles linked from the lead section, in order
+}
+
+// PageSummary is an article's short description, e.g. "Greek philosopher (c. 470–399 BC)"
+type PageSummary struct {
+	Title          string
+	Description    string
+	WikidataID     string
+	Disambiguation bool
+}
+
+// MediaWikiClient talks to the MediaWiki Action API
+type MediaWikiClient struct {
+	client   *http.Client
+	endpoint string
+}
+
+// NewMediaWikiClient creates a client for English Wikipedia
+func NewMediaWikiClient(client *http.Client) *MediaWikiClient {
+	return &MediaWikiClient{client: client, endpoint: mediaWikiEndpoint}
+}
+
+// apiPage is a page in a formatversion=2 query response
+type apiPage struct {
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Missing     bool              `json:"missing"`
+	Invalid     bool              `json:"invalid"`
+	Extract     string            `json:"extract"`
+	PageProps   map[string]string `json:"pageprops"`
+	Original    struct {
+		Source string `json:"source"`
+	} `json:"original"`
+	Revisions []struct {
+		Slots struct {
+			Main struct {
+				Content string `json:"content"`
+			} `json:"main"`
+		} `json:"slots"`
+	} `json:"revisions"`
+	Links []struct {
+		Title string `json:"title"`
+	} `json:"links"`
+}
+
+type apiTitleChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type apiResponse struct {
+	Query struct {
+		Normalized []apiTitleChange `json:"normalized"`
+		Redirects  []apiTitleChange `json:"redirects"`
+		Pages      []apiPage        `json:"pages"`
+	} `json:"query"`
+	Error *struct {
+		Code string `json:"code"`
+		Info string `json:"info"`
+	} `json:"error"`
+}
+
+// do runs an action=query request, following redirects
+func (mc *MediaWikiClient) do(ctx context.Context, params url.Values) (*apiResponse, error) {
+	params.Set("action", "query")
+	params.Set("format", "json")
+	params.Set("formatversion", "2")
+	params.Set("redirects", "1")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, mc.endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := mc.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to the MediaWiki API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w from the MediaWiki API: %d", ErrUnexpectedStatus, resp.StatusCode)
+	}
+
+	var result apiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding MediaWiki API response: %w", err)
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("MediaWiki API error %s: %s", result.Error.Code, result.Error.Info)
+	}
+	return &result, nil
+}
+
+// opensearch runs an action=opensearch request, returning the raw
+// [query, titles, descriptions, urls] response
+func (mc *MediaWikiClient) opensearch(ctx context.Context, search string, limit int) ([]interface{}, error) {
+	params := url.Values{}
+	params.Set("action", "opensearch")
+	params.Set("format", "json")
+	params.Set("namespace", "0")
+	params.Set("search", search)
+	params.Set("limit", strconv.Itoa(limit))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, mc.endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := mc.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to the MediaWiki API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w from the MediaWiki API: %d", ErrUnexpectedStatus, resp.StatusCode)
+	}
+
+	var result []interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding MediaWiki API response: %w", err)
+	}
+	return result, nil
+}
+
+// query runs an action=query request for a single title and returns its page
+// and the title it was redirected from, if any
+func (mc *MediaWikiClient) query(ctx context.Context, title string, params url.Values) (*apiPage, string, error) {
+	params.Set("titles", title)
+	result, err := mc.do(ctx, params)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(result.Query.Pages) == 0 {
+		return nil, "", fmt.Errorf("MediaWiki API returned no pages for %q", title)
+	}
+
+	page := &result.Query.Pages[0]
+	if page.Missing || page.Invalid {
+		return nil, "", fmt.Errorf("%w: %s", ErrPageNotFound, title)
+	}
+
+	var redirectedFrom string
+	if len(result.Query.Redirects) > 0 {
+		redirectedFrom = result.Query.Redirects[0].From
+	}
+	return page, redirectedFrom, nil
+}
+
+// Page fetches an article's lead section, infobox, Wikidata ID and image.
+// Disambiguation pages yield a *DisambiguationError.
+func (mc *MediaWikiClient) Page(ctx context.Context, title string) (*WikiPage, error) {
+	page, redirectedFrom, err := mc.query(ctx, title, url.Values{
+		"prop":        {"extracts|pageprops|revisions|pageimages|info"},
+		"exintro":     {"1"},
+		"explaintext": {"1"},
+		"ppprop":      {"disambiguation|wikibase_item"},
+		"rvprop":      {"content"},
+		"rvslots":     {"main"},
+		"rvsection":   {"0"},
+		"piprop":      {"original"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := page.PageProps["disambiguation"]; ok {
+		return nil, &DisambiguationError{Title: page.Title, Options: mc.disambiguationOptions(ctx, page.Title)}
+	}
+
+	var wikitext string
+	if len(page.Revisions) > 0 {
+		wikitext = page.Revisions[0].Slots.Main.Content
+	}
+	return &WikiPage{
+		Title:          page.Title,
+		RedirectedFrom: redirectedFrom,
+		Extract:        page.Extract,
+		Infobox:        parseInfobox(wikitext),
+		WikidataID:     page.PageProps["wikibase_item"],
+		ImageURL:       page.Original.Source,
+		Links:          articleLinks(wikitext),
+	}, nil
+}
+
+// Summaries fetches the short descriptions of articles, keyed by the title
+// asked for. Missing pages are left out.
+func (mc *MediaWikiClient) Summaries(ctx context.Context, titles []string) (map[string]PageSummary, error) {
+	summaries := make(map[string]PageSummary, len(titles))
+	for start := 0; start < len(titles); start += maxTitlesPerQuery {
+		batch := titles[start:min(start+maxTitlesPerQuery, len(titles))]
+		result, err := mc.do(ctx, url.Values{
+			"titles": {strings.Join(batch, "|")},
+			"prop":   {"description|pageprops"},
+			"ppprop": {"disambiguation|wikibase_item"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// Trace each requested title through normalization and redirects
+		renamed := map[string]string{}
+		for _, change := range append(result.Query.Normalized, result.Query.Redirects...) {
+			renamed[change.From] = change.To
+		}
+		pages := map[string]apiPage{}
+		for _, page := range result.Query.Pages {
+			pages[page.Title] = page
+		}
+		for _, title := range batch {
+			final := title
+			for i := 0; i < 2; i++ {
+				if to, ok := renamed[final]; ok {
+					final = to
+				}
+			}
+			page, ok := pages[final]
+			if !ok || page.Missing || page.Invalid {
+				continue
+			}
+			_, disambiguation := page.PageProps["disambiguation"]
+			summaries[title] = PageSummary{
+				Title:          page.Title,
+				Description:    page.Description,
+				WikidataID:     page.PageProps["wikibase_item"],
+				Disambiguation: disambiguation,
+			}
+		}
+	}
+	return summaries, nil
+}
+
+// Text fetches the plain text of a whole article, one paragraph or heading per line
+func (mc *MediaWikiClient) Text(ctx context.Context, title string) (string, error) {
+	page, _, err := mc.query(ctx, title, url.Values{
+		"prop":        {"extracts|info"},
+		"explaintext": {"1"},
+	})
+	if err != nil {
+		return "", err
+	}
+	return page.Extract, nil
+}
+
+// disambiguationOptions lists articles linked from a disambiguation page.
+// Failures only cost the suggestions, so they are not reported.
+func (mc *MediaWikiClient) disambiguationOptions(ctx context.Context, title string) []string {
+	page, _, err := mc.query(ctx, title, url.Values{
+		"prop":        {"links"},
+		"plnamespace": {"0"},
+		"pllimit":     {strconv.Itoa(maxDisambiguationOptions)},
+	})
+	if err != nil {
+		return nil
+	}
+	options := make([]string, 0, len(page.Links))
+	for _, link := range page.Links {
+		options = append(options, link.Title)
+	}
+	return options
+}
+
+// Wikitext parsing
+
+// parseInfobox returns the parameters of the first {{Infobox ...}} template
+// in wikitext, keyed by lowercase name with spaces as underscores, and with
+// values rendered as plain text. It returns nil if there is no infobox.
+func parseInfobox(wikitext string) map[string]string {
+	start := strings.Index(strings.ToLower(wikitext), "{{infobox")
+	if start < 0 {
+		return nil
+	}
+
+	// Split the template body on top-level pipes, skipping nested templates and links
+	var fields []string
+	depth, last, closed := 0, start+2, false
+	for i := start; i+1 < len(wikitext) && !closed; i++ {
+		switch wikitext[i : i+2] {
+		case "{{", "[[":
+			depth++
+			i++
+		case "}}", "]]":
+			depth--
+			if depth == 0 {
+				fields = append(fields, wikitext[last:i])
+				closed = true
+			}
+			i++
+		default:
+			if wikitext[i] == '|' && depth == 1 {
+				fields = append(fields, wikitext[last:i])
+				last = i + 1
+			}
+		}
+	}
+	if !closed {
+		return nil // unterminated template
+	}
+
+	infobox := map[string]string{}
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), " ", "_")
+		if value = wikitextToPlain(value); key != "" && value != "" {
+			infobox[key] = value
+		}
+	}
+	return infobox
+}
+
+// articleLinkPattern captures the target of a wikilink, without any section or label
+var articleLinkPattern = regexp.MustCompile(`\[\[([^\[\]|#]+)[^\[\]]*\]\]`)
+
+// articleLinks lists the articles linked from wikitext in order of first
+// appearance, skipping files, categories and other namespaces
+func articleLinks(wikitext string) []string {
+	wikitext = commentPattern.ReplaceAllString(wikitext, "")
+	wikitext = refPattern.ReplaceAllString(wikitext, "")
+
+	var links []string
+	seen := map[string]bool{}
+	for _, match := range articleLinkPattern.FindAllStringSubmatch(wikitext, -1) {
+		title := strings.TrimSpace(strings.ReplaceAll(match[1], "_", " "))
+		if title == "" || strings.Contains(title, ":") {
+			continue
+		}
+		// Titles are case-sensitive except for the first letter
+		first, size := utf8.DecodeRuneInString(title)
+		title = string(unicode.ToUpper(first)) + title[size:]
+		if !seen[title] {
+			seen[title] = true
+			links = append(links, title)
+		}
+	}
+	return links
+}
+
+var (
+	commentPattern      = regexp.MustCompile(`(?s)<!--.*?-->`)
+	refPattern          = regexp.MustCompile(`(?is)<ref[^>/]*/>|<ref[^>]*>.*?</ref>`)
+	linkPattern         = regexp.MustCompile(`\[\[(?:[^\[\]|]*\|)?([^\[\]]*)\]\]`)
+	externalLinkPattern = regexp.MustCompile(`\[https?://[^\s\]]+\s*([^\]]*)\]`)
+	templatePattern     = regexp.MustCompile(`\{\{([^{}]*)\}\}`)
+	breakPattern        = regexp.MustCompile(`(?i)<br\s*/?>`)
+	tagPattern          = regexp.MustCompile(`<[^>]+>`)
+	bulletPattern       = regexp.MustCompile(`\n\s*\*+\s*`)
+)
+
+// wikitextToPlain renders a fragment of wikitext as plain text, expanding
+// the templates commonly found in biographical infoboxes
+func wikitextToPlain(s string) string {
+	s = commentPattern.ReplaceAllString(s, "")
+	s = refPattern.ReplaceAllString(s, "")
+	s = linkPattern.ReplaceAllString(s, "$1")
+	s = externalLinkPattern.ReplaceAllString(s, "$1")
+
+	// Expand innermost templates first
+	for {
+		expanded := templatePattern.ReplaceAllStringFunc(s, func(t string) string {
+			return renderTemplate(t[2 : len(t)-2])
+		})
+		if expanded == s {
+			break
+		}
+		s = expanded
+	}
+
+	s = breakPattern.ReplaceAllString(s, ", ")
+	s = tagPattern.ReplaceAllString(s, "")
+	s = bulletPattern.ReplaceAllString(s, ", ")
+	s = strings.NewReplacer("'''", "", "''", "", "&nbsp;", " ", "&ndash;", "–").Replace(s)
+	s = strings.Trim(strings.Join(strings.Fields(s), " "), " ,*")
+	return s
+}
+
+// renderTemplate expands a single template given the text between its braces.
+// Unknown templates render as nothing.
+func renderTemplate(inner string) string {
+	parts := strings.Split(inner, "|")
+	name := strings.ToLower(strings.TrimSpace(parts[0]))
+
+	// Positional arguments; named ones such as df=yes are dropped
+	var args []string
+	for _, part := range parts[1:] {
+		if !strings.Contains(part, "=") {
+			args = append(args, strings.TrimSpace(part))
+		}
+	}
+	arg := func(i int) string {
+		if i < len(args) {
+			return args[i]
+		}
+		return ""
+	}
+
+	switch name {
+	case "birth date", "birth date and age", "bda", "death date", "death date and age", "dda",
+		"birth year and age", "death year and age", "start date", "end date":
+		return renderDate(arg(0), arg(1), arg(2))
+	case "birth-date", "death-date", "birth-date and age", "death-date and age":
+		return arg(0)
+	case "circa", "c.", "c", "ca.":
+		return strings.TrimSpace("c. " + arg(0))
+	case "floruit", "fl.", "fl":
+		return strings.TrimSpace("fl. " + arg(0))
+	case "bce", "bc":
+		return arg(0) + " BC"
+	case "ce", "ad":
+		return "AD " + arg(0)
+	case "nowrap", "nobr", "small", "big", "longitem", "nobold", "nowrap begin", "marriage", "abbr":
+		return arg(0)
+	case "lang":
+		return arg(1)
+	case "hlist", "flatlist", "flat list", "plainlist", "plain list", "ubl", "ublist", "unbulleted list", "cslist":
+		return strings.Join(args, ", ")
+	}
+	if strings.HasPrefix(name, "lang-") {
+		return arg(0)
+	}
+	return ""
+}
+
+// renderDate formats the year, month and day arguments of a date template
+// in a form ParseHistoricalDate understands
+func renderDate(year, month, day string) string {
+	y, err := strconv.Atoi(year)
+	if err != nil {
+		return year
+	}
+	m, err := strconv.Atoi(month)
+	if err != nil || m < 1 || m > 12 {
+		return strconv.Itoa(y)
+	}
+	d, err := strconv.Atoi(day)
+	if err != nil || d < 1 || d > 31 {
+		return fmt.Sprintf("%s %d", time.Month(m), y)
+	}
+	return fmt.Sprintf("%d %s %d", d, time.Month(m), y)
+}
@@ -0,0 +1,57 @@
+package main
+
+// network is a read-only adjacency view of a graph snapshot, shared by the
+// graph algorithms. Connections are treated as undirected.
+type network struct {
+	ids    []string                // person IDs in insertion order
+	people map[string]Person       // person ID -> person
+	edges  map[string][]Connection // person ID -> incident connections
+}
+
+func newNetwork(graph GraphData) *network {
+	n := &network{
+		ids:    make([]string, 0, len(graph.Nodes)),
+		people: make(map[string]Person, len(graph.Nodes)),
+		edges:  make(map[string][]Connection, len(graph.Nodes)),
+	}
+	for _, person := range graph.Nodes {
+		n.ids = append(n.ids, person.ID)
+		n.people[person.ID] = person
+	}
+	for _, conn := range graph.Links {
+		if _, ok := n.people[conn.Source]; !ok {
+			continue
+		}
+		if _, ok := n.people[conn.Target]; !ok {
+			continue
+		}
+		n.edges[conn.Source] = append(n.edges[conn.Source], conn)
+		if conn.Target != conn.Source {
+			n.edges[conn.Target] = append(n.edges[conn.Target], conn)
+		}
+	}
+	return n
+}
+
+// loadNetwork snapshots the store into a network
+func loadNetwork(store GraphStore) (*network, error) {
+	graph, err := store.Graph()
+	if err != nil {
+		return nil, err
+	}
+	return newNetwork(graph), nil
+}
+
+// other returns the end of conn that isn't id
+func (n *network) other(conn Connection, id string) string {
+	if conn.Source == id {
+		return conn.Target
+	}
+	return conn.Source
+}
+
+// has reports whether the network contains the person
+func (n *network) has(id string) bool {
+	_, ok := n.people[id]
+	return ok
+}
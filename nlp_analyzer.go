@@ -8,10 +8,35 @@ import (
 	"sync"
 )
 
+// relationshipTypes are the relationship types the corpus is built around.
+// Connections may only use one of these or AssociatedType.
+var relationshipTypes = []string{"mentor", "student", "colleague", "influenced", "rival", "friend", "admired", "spouse"}
+
+// AssociatedType is used when two figures are mentioned together but no
+// specific relationship could be determined
+const AssociatedType = "associated"
+
+// KnownConnectionTypes returns every valid connection type
+func KnownConnectionTypes() []string {
+	return append(append([]string{}, relationshipTypes...), AssociatedType)
+}
+
+// IsKnownConnectionType reports whether relType is a valid connection type
+func IsKnownConnectionType(relType string) bool {
+	for _, known := range KnownConnectionTypes() {
+		if relType == known {
+			return true
+		}
+	}
+	return false
+}
+
 // NLPAnalyzer provides natural language processing functions for historical relationship analysis
 type NLPAnalyzer struct {
 	// Maps to store word frequencies for different relationship types
 	relationshipCorpus map[string]map[string]int
+	minStrength        int // weaker relationships are not reported
+	maxEntities        int // most entities extracted from one text; 0 for no limit
 	mu                 sync.RWMutex
 }
 
@@ -24,9 +49,24 @@ func NewNLPAnalyzer() *NLPAnalyzer {
 	// Initialize with known relationship words
 	analyzer.initializeCorpus()
 	
+	// Every relationship type needs corpus entries to be detectable
+	for _, relType := range relationshipTypes {
+		if _, ok := analyzer.relationshipCorpus[relType]; !ok {
+			panic(fmt.Sprintf("no corpus for relationship type %q", relType))
+		}
+	}
+	
 	return analyzer
 }
 
+// Configure applies the nlp settings
+func (na *NLPAnalyzer) Configure(cfg NLPConfig) {
+	na.mu.Lock()
+	defer na.mu.Unlock()
+	na.minStrength = cfg.MinRelationshipStrength
+	na.maxEntities = cfg.MaxEntitiesPerText
+}
+
 // Initialize the corpus with known relationship indicators
 func (na *NLPAnalyzer) initializeCorpus() {
 	// Mentor relationship words
@@ -77,6 +117,12 @@ func (na *NLPAnalyzer) initializeCorpus() {
 		"looked up to": 8, "honored": 7, "praised": 6, "acclaimed": 7, "celebrated": 6,
 		"idolized": 9, "hero": 8, "model": 6, "idol": 8, "exemplar": 7,
 	}
+	
+	// Spouse relationship words
+	na.relationshipCorpus["spouse"] = map[string]int{
+		"married": 10, "spouse": 10, "wife": 9, "husband": 9, "marriage": 8,
+		"wed": 8, "wedding": 7, "widow": 7, "widower": 7, "betrothed": 6,
+	}
 }
 
 // AnalyzeText determines the most likely relationship types in a given text
@@ -144,7 +190,7 @@ func (na *NLPAnalyzer) DetermineRelationshipFromText(text, source, target string
 	// If no strong relationship found, check for co-occurrence
 	if bestType == "" || highestScore < 1.0 {
 		if strings.Contains(strings.ToLower(text), strings.ToLower(target)) {
-			bestType = "associated"
+			bestType = AssociatedType
 			highestScore = 0.5
 		}
 	}
@@ -159,6 +205,13 @@ func (na *NLPAnalyzer) DetermineRelationshipFromText(text, source, target string
 		strength = 0
 	}
 	
+	na.mu.RLock()
+	minStrength := na.minStrength
+	na.mu.RUnlock()
+	if strength < minStrength {
+		return "", 0, ""
+	}
+	
 	// Extract a relevant description
 	description := na.extractRelevantDescription(text, source, target, bestType)
 	
@@ -193,7 +246,14 @@ func (na *NLPAnalyzer) ExtractNamedEntities(text string) []string {
 	uniqueNames := make(map[string]bool)
 	var results []string
 	
+	na.mu.RLock()
+	maxEntities := na.maxEntities
+	na.mu.RUnlock()
+	
 	for _, name := range filteredMatches {
+		if maxEntities > 0 && len(results) >= maxEntities {
+			break
+		}
 		if !uniqueNames[name] {
 			uniqueNames[name] = true
 			results = append(results, name)
@@ -0,0 +1,634 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PageCache keeps the pages fetched from Wikipedia and Wikidata so that an
+// article is downloaded once however many times it is scraped. It sits in
+// front of the rate limiter, so requests it answers cost nothing.
+//
+// Entries are fresh for the configured TTL. After that they are revalidated:
+// with If-None-Match or If-Modified-Since when the server gave an ETag or
+// Last-Modified, and otherwise, for MediaWiki queries about one article, by
+// checking whether the article's revision has changed. Entries live in an
+// LRU in memory and, if a directory is configured, on disk as well, where
+// they outlast evictions and restarts. The disk tier is an LRU of its own
+// with a larger capacity. Entries not confirmed for longer than the maximum
+// age are dropped from both.
+type PageCache struct {
+	next http.RoundTripper
+
+	mu           sync.Mutex
+	enabled      bool
+	ttl          time.Duration
+	maxAge       time.Duration // 0 keeps entries until they are evicted
+	capacity     int           // entries kept in memory
+	dir          string        // "" keeps entries in memory only
+	diskCapacity int           // files kept in dir
+	entries      map[string]*list.Element
+	lru          *list.List // of *cacheEntry, most recently used first
+	bytes        int64
+	files        map[string]*list.Element
+	diskLRU      *list.List // of *cacheFile, most recently used first
+	diskBytes    int64
+	stats        CacheStats
+}
+
+// cacheFile is an entry in the disk tier
+type cacheFile struct {
+	path string
+	size int64
+}
+
+// CacheStats reports how well the page cache is doing
+type CacheStats struct {
+	Enabled       bool   `json:"enabled"`
+	TTL           int    `json:"ttl"`    // seconds
+	MaxAge        int    `json:"maxAge"` // seconds
+	Capacity      int    `json:"capacity"`
+	Dir           string `json:"dir,omitempty"`
+	DiskCapacity  int    `json:"diskCapacity,omitempty"`
+	Entries       int    `json:"entries"`     // in memory
+	Bytes         int64  `json:"bytes"`       // in memory
+	DiskEntries   int    `json:"diskEntries"` // on disk
+	DiskBytes     int64  `json:"diskBytes"`   // on disk
+	Hits          int64  `json:"hits"`        // answered from a fresh entry
+	DiskHits      int64  `json:"diskHits"`    // entries read back from disk
+	Revalidated   int64  `json:"revalidated"` // stale entries the server confirmed unchanged
+	Misses        int64  `json:"misses"`      // downloaded in full
+	Stale         int64  `json:"stale"`       // stale entries served because the server failed
+	Expired       int64  `json:"expired"`     // entries dropped for being older than the maximum age
+	Evictions     int64  `json:"evictions"`
+	DiskEvictions int64  `json:"diskEvictions"`
+}
+
+// cacheEntry is a cached response body and what is needed to revalidate it
+type cacheEntry struct {
+	Key          string    `json:"key"`              // the request URL
+	Titles       []string  `json:"titles,omitempty"` // normalized titles or IDs the request was about
+	Revision     int64     `json:"revision,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	ContentType  string    `json:"contentType,omitempty"`
+	Body         []byte    `json:"body"`
+	CheckedAt    time.Time `json:"checkedAt"` // when last downloaded or revalidated
+}
+
+// NewPageCache creates a disabled cache sending requests on to next
+func NewPageCache(next http.RoundTripper) *PageCache {
+	return &PageCache{
+		next:    next,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		files:   make(map[string]*list.Element),
+		diskLRU: list.New(),
+	}
+}
+
+// Configure applies the api cache settings. Disabling the cache empties its
+// memory but leaves the disk tier for later.
+func (c *PageCache) Configure(cfg APIConfig) {
+	if cfg.CacheDir != "" {
+		if err := os.MkdirAll(cfg.CacheDir, 0o755); err != nil {
+			log.Printf("Page cache directory unavailable, keeping pages in memory only: %v", err)
+			cfg.CacheDir = ""
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.enabled = cfg.CacheEnabled
+	c.ttl = time.Duration(cfg.CacheTTL) * time.Second
+	c.maxAge = time.Duration(cfg.CacheMaxAge) * time.Second
+	c.capacity = cfg.CacheEntries
+	c.diskCapacity = cfg.CacheDiskEntries
+	if cfg.CacheDir != c.dir {
+		c.dir = cfg.CacheDir
+		c.scanDisk()
+	}
+	if !c.enabled {
+		c.clear()
+	}
+	c.evict()
+	c.evictDisk()
+}
+
+// Stats reports the cache's settings, size and counters
+func (c *PageCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Enabled = c.enabled
+	stats.TTL = int(c.ttl / time.Second)
+	stats.MaxAge = int(c.maxAge / time.Second)
+	stats.Capacity = c.capacity
+	stats.Dir = c.dir
+	stats.Entries = c.lru.Len()
+	stats.Bytes = c.bytes
+	if c.dir != "" {
+		stats.DiskCapacity = c.diskCapacity
+		stats.DiskEntries = c.diskLRU.Len()
+		stats.DiskBytes = c.diskBytes
+	}
+	return stats
+}
+
+// Purge removes the entries about title, or every entry if title is "",
+// from memory and disk. It returns how many were removed.
+func (c *PageCache) Purge(title string) (int, error) {
+	want := normalizeCacheTitle(title)
+	matches := func(entry *cacheEntry) bool {
+		if want == "" {
+			return true
+		}
+		for _, t := range entry.Titles {
+			if t == want {
+				return true
+			}
+		}
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	purged := map[string]bool{}
+	for key, elem := range c.entries {
+		if matches(elem.Value.(*cacheEntry)) {
+			c.remove(elem)
+			purged[key] = true
+		}
+	}
+
+	if c.dir == "" {
+		return len(purged), nil
+	}
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return len(purged), err
+	}
+	for _, path := range paths {
+		entry, err := readCacheEntry(path)
+		if err != nil || matches(entry) {
+			if err := c.removeFile(path); err != nil {
+				return len(purged), fmt.Errorf("error removing cached page: %w", err)
+			}
+			if entry != nil {
+				purged[entry.Key] = true
+			}
+		}
+	}
+	return len(purged), nil
+}
+
+func (c *PageCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	enabled, ttl := c.enabled, c.ttl
+	c.mu.Unlock()
+	if !enabled || req.Method != http.MethodGet {
+		return c.next.RoundTrip(req)
+	}
+
+	key := req.URL.String()
+	entry := c.lookup(key)
+	if entry != nil && time.Since(entry.CheckedAt) < ttl {
+		c.count(func(s *CacheStats) { s.Hits++ })
+		return entry.response(req), nil
+	}
+
+	outreq := req
+	if entry != nil && (entry.ETag != "" || entry.LastModified != "") {
+		outreq = req.Clone(req.Context())
+		if entry.ETag != "" {
+			outreq.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			outreq.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	} else if entry != nil && entry.Revision != 0 {
+		if revision, err := c.revision(req, entry.Titles[0]); err == nil && revision == entry.Revision {
+			c.renew(entry, nil)
+			return entry.response(req), nil
+		}
+	}
+
+	resp, err := c.next.RoundTrip(outreq)
+	if err != nil || (resp.StatusCode >= 500 && entry != nil) {
+		if entry == nil {
+			return nil, err
+		}
+		if err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		log.Printf("Serving cached %s after the request failed: %v", req.URL.Redacted(), err)
+		c.count(func(s *CacheStats) { s.Stale++ })
+		return entry.response(req), nil
+	}
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		c.renew(entry, resp.Header)
+		return entry.response(req), nil
+	}
+	if resp.StatusCode != http.StatusOK || strings.Contains(resp.Header.Get("Cache-Control"), "no-store") {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	entry = &cacheEntry{
+		Key:          key,
+		Titles:       cacheTitles(req.URL),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		ContentType:  resp.Header.Get("Content-Type"),
+		Body:         body,
+		CheckedAt:    time.Now().UTC(),
+	}
+	entry.Revision = pageRevision(req.URL, body)
+	c.store(entry)
+	c.count(func(s *CacheStats) { s.Misses++ })
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	return resp, nil
+}
+
+// count updates the counters under the lock
+func (c *PageCache) count(change func(*CacheStats)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	change(&c.stats)
+}
+
+// lookup finds the entry for key in memory, then on disk. It returns a
+// copy, which the caller may change and store again. Entries past the
+// maximum age are dropped rather than returned.
+func (c *PageCache) lookup(key string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		entry := *elem.Value.(*cacheEntry)
+		if c.expired(&entry) {
+			c.remove(elem)
+			c.expire(key)
+			return nil
+		}
+		c.lru.MoveToFront(elem)
+		c.touchFile(c.path(key))
+		return &entry
+	}
+	if c.dir == "" {
+		return nil
+	}
+
+	path := c.path(key)
+	entry, err := readCacheEntry(path)
+	if err != nil || entry.Key != key {
+		return nil
+	}
+	if c.expired(entry) {
+		c.expire(key)
+		return nil
+	}
+	c.stats.DiskHits++
+	c.touchFile(path)
+	c.add(entry)
+	copied := *entry
+	return &copied
+}
+
+// expired reports whether an entry has gone unconfirmed for longer than the
+// maximum age. The caller must hold the lock.
+func (c *PageCache) expired(entry *cacheEntry) bool {
+	return c.maxAge > 0 && time.Since(entry.CheckedAt) > c.maxAge
+}
+
+// expire drops the disk copy of an expired entry. The caller must hold the
+// lock.
+func (c *PageCache) expire(key string) {
+	c.stats.Expired++
+	if c.dir == "" {
+		return
+	}
+	if err := c.removeFile(c.path(key)); err != nil {
+		log.Printf("Error removing expired cached page: %v", err)
+	}
+}
+
+// store adds an entry to memory and disk
+func (c *PageCache) store(entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[entry.Key]; ok {
+		c.remove(elem)
+	}
+	c.add(entry)
+	c.write(entry)
+}
+
+// renew marks an entry as just confirmed unchanged, taking any new
+// validators from header
+func (c *PageCache) renew(entry *cacheEntry, header http.Header) {
+	entry.CheckedAt = time.Now().UTC()
+	if etag := header.Get("ETag"); etag != "" {
+		entry.ETag = etag
+	}
+	if modified := header.Get("Last-Modified"); modified != "" {
+		entry.LastModified = modified
+	}
+	c.store(entry)
+	c.count(func(s *CacheStats) { s.Revalidated++ })
+}
+
+// revision asks MediaWiki for the current revision of the article with the
+// given title, on the endpoint req was sent to
+func (c *PageCache) revision(req *http.Request, title string) (int64, error) {
+	probe := *req.URL
+	probe.RawQuery = url.Values{
+		"action":        {"query"},
+		"format":        {"json"},
+		"formatversion": {"2"},
+		"redirects":     {"1"},
+		"prop":          {"info"},
+		"titles":        {title},
+	}.Encode()
+
+	probeReq, err := http.NewRequestWithContext(req.Context(), http.MethodGet, probe.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	probeReq.Header.Set("User-Agent", req.Header.Get("User-Agent"))
+	resp, err := c.next.RoundTrip(probeReq)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("%w: %d", ErrUnexpectedStatus, resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	return pageRevision(probeReq.URL, body), nil
+}
+
+// add puts an entry at the front of the LRU, evicting the least recently
+// used entries beyond capacity. The caller must hold the lock.
+func (c *PageCache) add(entry *cacheEntry) {
+	c.entries[entry.Key] = c.lru.PushFront(entry)
+	c.bytes += int64(len(entry.Body))
+	c.evict()
+}
+
+// evict drops the least recently used entries beyond capacity. The caller
+// must hold the lock.
+func (c *PageCache) evict() {
+	for c.lru.Len() > max(c.capacity, 0) {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+}
+
+// remove drops an entry from memory. The caller must hold the lock.
+func (c *PageCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.Key)
+	c.bytes -= int64(len(entry.Body))
+}
+
+// scanDisk indexes the files already in the disk tier, most recently written
+// first, removing those past the maximum age. The caller must hold the lock.
+func (c *PageCache) scanDisk() {
+	c.files = make(map[string]*list.Element)
+	c.diskLRU.Init()
+	c.diskBytes = 0
+	if c.dir == "" {
+		return
+	}
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		log.Printf("Error reading page cache directory: %v", err)
+		return
+	}
+	type found struct {
+		path     string
+		size     int64
+		modified time.Time
+	}
+	var files []found
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		// Files are rewritten whenever their page is confirmed, so the
+		// modification time is when the entry was last checked
+		if c.maxAge > 0 && time.Since(info.ModTime()) > c.maxAge {
+			if err := os.Remove(path); err == nil {
+				c.stats.Expired++
+			}
+			continue
+		}
+		files = append(files, found{path, info.Size(), info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modified.Before(files[j].modified) })
+	for _, f := range files {
+		c.files[f.path] = c.diskLRU.PushFront(&cacheFile{path: f.path, size: f.size})
+		c.diskBytes += f.size
+	}
+}
+
+// touchFile moves the file at path to the front of the disk LRU, if it is
+// there. The caller must hold the lock.
+func (c *PageCache) touchFile(path string) {
+	c.recordFile(path, -1)
+}
+
+// recordFile notes that the file at path was just written with size bytes,
+// or just used if size is negative. The caller must hold the lock.
+func (c *PageCache) recordFile(path string, size int64) {
+	if elem, ok := c.files[path]; ok {
+		c.diskLRU.MoveToFront(elem)
+		if f := elem.Value.(*cacheFile); size >= 0 {
+			c.diskBytes += size - f.size
+			f.size = size
+		}
+		return
+	}
+	if size >= 0 {
+		c.files[path] = c.diskLRU.PushFront(&cacheFile{path: path, size: size})
+		c.diskBytes += size
+	}
+}
+
+// evictDisk removes the least recently used files beyond the disk
+// capacity. The caller must hold the lock.
+func (c *PageCache) evictDisk() {
+	for c.diskLRU.Len() > max(c.diskCapacity, 0) {
+		path := c.diskLRU.Back().Value.(*cacheFile).path
+		if err := c.removeFile(path); err != nil {
+			log.Printf("Error evicting cached page: %v", err)
+		}
+		c.stats.DiskEvictions++
+	}
+}
+
+// removeFile deletes a file from the disk tier. The caller must hold the
+// lock.
+func (c *PageCache) removeFile(path string) error {
+	if elem, ok := c.files[path]; ok {
+		c.diskLRU.Remove(elem)
+		delete(c.files, path)
+		c.diskBytes -= elem.Value.(*cacheFile).size
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// clear drops every entry from memory. The caller must hold the lock.
+func (c *PageCache) clear() {
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+	c.bytes = 0
+}
+
+// path is the file holding the entry for key in the disk tier
+func (c *PageCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// write saves an entry to the disk tier, if there is one, replacing the
+// previous version atomically. Failures only cost the disk copy, so they
+// are logged. The caller must hold the lock.
+func (c *PageCache) write(entry *cacheEntry) {
+	if c.dir == "" {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err == nil {
+		path := c.path(entry.Key)
+		tmp := path + ".tmp"
+		if err = os.WriteFile(tmp, data, 0o644); err == nil {
+			err = os.Rename(tmp, path)
+		}
+		if err == nil {
+			c.recordFile(path, int64(len(data)))
+			c.evictDisk()
+		}
+	}
+	if err != nil {
+		log.Printf("Error writing cached page: %v", err)
+	}
+}
+
+// readCacheEntry reads an entry saved in the disk tier
+func readCacheEntry(path string) (*cacheEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("error decoding cached page %s: %w", path, err)
+	}
+	return &entry, nil
+}
+
+// response builds a response to req from the entry
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	header := http.Header{}
+	header.Set("X-Cache", "HIT")
+	if e.ContentType != "" {
+		header.Set("Content-Type", e.ContentType)
+	}
+	if e.ETag != "" {
+		header.Set("ETag", e.ETag)
+	}
+	if e.LastModified != "" {
+		header.Set("Last-Modified", e.LastModified)
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// cacheTitles lists the normalized titles or IDs a request is about, for
+// purging: the titles of a MediaWiki or Wikidata query, the IDs of a
+// Wikidata lookup, the terms of a search or the title of a rendered article
+func cacheTitles(u *url.URL) []string {
+	query := u.Query()
+	var titles []string
+	switch {
+	case query.Get("titles") != "":
+		titles = strings.Split(query.Get("titles"), "|")
+	case query.Get("ids") != "":
+		titles = strings.Split(query.Get("ids"), "|")
+	case query.Get("search") != "":
+		titles = []string{query.Get("search")}
+	case strings.HasPrefix(u.Path, "/wiki/"):
+		titles = []string{strings.TrimPrefix(u.Path, "/wiki/")}
+	}
+	for i, title := range titles {
+		titles[i] = normalizeCacheTitle(title)
+	}
+	return titles
+}
+
+// normalizeCacheTitle makes "Albert_Einstein" and "albert einstein" match
+func normalizeCacheTitle(title string) string {
+	return strings.ToLower(strings.TrimSpace(strings.ReplaceAll(title, "_", " ")))
+}
+
+// pageRevision returns the revision of the article in the response to a
+// MediaWiki query about a single title, or 0 for any other response
+func pageRevision(u *url.URL, body []byte) int64 {
+	query := u.Query()
+	if query.Get("action") != "query" || query.Get("titles") == "" || strings.Contains(query.Get("titles"), "|") {
+		return 0
+	}
+	var result struct {
+		Query struct {
+			Pages []struct {
+				LastRevID int64 `json:"lastrevid"`
+			} `json:"pages"`
+		} `json:"query"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || len(result.Query.Pages) != 1 {
+		return 0
+	}
+	return result.Query.Pages[0].LastRevID
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestPageCache returns a cache in front of a server answering every
+// page with its path, and a count of the requests that reached the server
+func newTestPageCache(t *testing.T, cfg APIConfig) (*PageCache, *int) {
+	t.Helper()
+	downloads := 0
+	cache := NewPageCache(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		downloads++
+		rec := httptest.NewRecorder()
+		rec.WriteString(req.URL.Path)
+		return rec.Result(), nil
+	}))
+	cache.Configure(cfg)
+	return cache, &downloads
+}
+
+func fetchPage(t *testing.T, cache *PageCache, title string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, "https://en.wikipedia.org/wiki/"+title, nil)
+	resp, err := cache.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "/wiki/"+title {
+		t.Fatalf("page %s = %q", title, body)
+	}
+}
+
+func cachedFiles(t *testing.T, dir string) int {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(paths)
+}
+
+func TestPageCacheBoundsDiskTier(t *testing.T) {
+	dir := t.TempDir()
+	cfg := APIConfig{CacheEnabled: true, CacheTTL: 600, CacheEntries: 1, CacheDir: dir, CacheDiskEntries: 2}
+	cache, downloads := newTestPageCache(t, cfg)
+
+	for _, title := range []string{"A", "B", "C"} {
+		fetchPage(t, cache, title)
+	}
+	if n := cachedFiles(t, dir); n != 2 {
+		t.Fatalf("%d files on disk, want 2", n)
+	}
+
+	// B comes back from disk and becomes the most recently used file, so D
+	// evicts C
+	fetchPage(t, cache, "B")
+	fetchPage(t, cache, "D")
+	if *downloads != 4 {
+		t.Errorf("%d downloads, want 4", *downloads)
+	}
+	for title, want := range map[string]bool{"A": false, "B": true, "C": false, "D": true} {
+		_, err := os.Stat(cache.path("https://en.wikipedia.org/wiki/" + title))
+		if got := err == nil; got != want {
+			t.Errorf("%s on disk: %v, want %v", title, got, want)
+		}
+	}
+	stats := cache.Stats()
+	if stats.DiskEntries != 2 || stats.DiskEvictions != 2 || stats.DiskHits != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	// A restart with a smaller disk tier keeps the most recently written
+	cfg.CacheDiskEntries = 1
+	restarted, downloads := newTestPageCache(t, cfg)
+	if n := cachedFiles(t, dir); n != 1 {
+		t.Fatalf("%d files on disk after restart, want 1", n)
+	}
+	fetchPage(t, restarted, "D")
+	if *downloads != 0 {
+		t.Errorf("D was downloaded again after restart")
+	}
+}
+
+func TestPageCacheExpiresOldEntries(t *testing.T) {
+	dir := t.TempDir()
+	cfg := APIConfig{CacheEnabled: true, CacheTTL: 600, CacheEntries: 10, CacheDir: dir, CacheDiskEntries: 10, CacheMaxAge: 3600}
+	cache, downloads := newTestPageCache(t, cfg)
+	fetchPage(t, cache, "A")
+	fetchPage(t, cache, "B")
+
+	// A was last confirmed two hours ago, so it is downloaded afresh
+	key := "https://en.wikipedia.org/wiki/A"
+	cache.entries[key].Value.(*cacheEntry).CheckedAt = time.Now().Add(-2 * time.Hour)
+	fetchPage(t, cache, "A")
+	if *downloads != 3 || cache.Stats().Expired != 1 {
+		t.Errorf("%d downloads and stats %+v, want A downloaded again", *downloads, cache.Stats())
+	}
+
+	// Files not rewritten within the maximum age are deleted at startup
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(cache.path("https://en.wikipedia.org/wiki/B"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	restarted, _ := newTestPageCache(t, cfg)
+	if n := cachedFiles(t, dir); n != 1 || restarted.Stats().DiskEntries != 1 {
+		t.Errorf("%d files on disk after restart, want 1", n)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+)
+
+// maxPaths bounds how many alternative paths a single request may ask for
+const maxPaths = 10
+
+// Path is a route through the network between two people
+type Path struct {
+	Hops      int          `json:"hops"`
+	Cost      float64      `json:"cost"`
+	Nodes     []Person     `json:"nodes"`
+	Edges     []Connection `json:"edges"`
+	Narrative []string     `json:"narrative"` // one sentence per edge
+}
+
+// edgeWeight returns the cost of traversing a connection
+type edgeWeight func(conn Connection) float64
+
+// unitWeight counts hops
+func unitWeight(Connection) float64 { return 1 }
+
+// strengthWeight makes strong relationships cheap to traverse
+func strengthWeight(conn Connection) float64 {
+	if conn.Strength < minStrength {
+		return 1
+	}
+	return 1 / float64(conn.Strength)
+}
+
+// route is a path expressed as IDs, used while searching
+type route struct {
+	nodes []string
+	edges []Connection
+	cost  float64
+}
+
+// exclusions removes people and connections from consideration during a search
+type exclusions struct {
+	nodes map[string]bool
+	edges map[string]bool
+}
+
+func (ex exclusions) blocksNode(id string) bool       { return ex.nodes[id] }
+func (ex exclusions) blocksEdge(conn Connection) bool { return ex.edges[conn.ID] }
+
+// bfsPath finds a route with the fewest hops
+func (n *network) bfsPath(from, to string, ex exclusions) (route, bool) {
+	if ex.blocksNode(from) || ex.blocksNode(to) {
+		return route{}, false
+	}
+
+	via := map[string]Connection{}
+	visited := map[string]bool{from: true}
+	queue := []string{from}
+
+	for len(queue) > 0 && !visited[to] {
+		id := queue[0]
+		queue = queue[1:]
+		for _, conn := range n.edges[id] {
+			next := n.other(conn, id)
+			if visited[next] || ex.blocksNode(next) || ex.blocksEdge(conn) {
+				continue
+			}
+			visited[next] = true
+			via[next] = conn
+			queue = append(queue, next)
+		}
+	}
+
+	if !visited[to] {
+		return route{}, false
+	}
+	return n.traceRoute(from, to, via, unitWeight), true
+}
+
+// dijkstraPath finds the cheapest route under weight
+func (n *network) dijkstraPath(from, to string, weight edgeWeight, ex exclusions) (route, bool) {
+	if ex.blocksNode(from) || ex.blocksNode(to) {
+		return route{}, false
+	}
+
+	dist := map[string]float64{from: 0}
+	via := map[string]Connection{}
+	done := map[string]bool{}
+	pq := &distanceQueue{{id: from, dist: 0}}
+
+	for pq.Len() > 0 {
+		item := heap.Pop(pq).(distanceItem)
+		if done[item.id] {
+			continue
+		}
+		done[item.id] = true
+		if item.id == to {
+			break
+		}
+
+		for _, conn := range n.edges[item.id] {
+			next := n.other(conn, item.id)
+			if done[next] || ex.blocksNode(next) || ex.blocksEdge(conn) {
+				continue
+			}
+			d := item.dist + weight(conn)
+			if best, ok := dist[next]; !ok || d < best {
+				dist[next] = d
+				via[next] = conn
+				heap.Push(pq, distanceItem{id: next, dist: d})
+			}
+		}
+	}
+
+	if !done[to] {
+		return route{}, false
+	}
+	return n.traceRoute(from, to, via, weight), true
+}
+
+// traceRoute walks the predecessor map back from to
+func (n *network) traceRoute(from, to string, via map[string]Connection, weight edgeWeight) route {
+	r := route{nodes: []string{to}}
+	for id := to; id != from; {
+		conn := via[id]
+		id = n.other(conn, id)
+		r.nodes = append(r.nodes, id)
+		r.edges = append(r.edges, conn)
+		r.cost += weight(conn)
+	}
+
+	// Reverse into from -> to order
+	for i, j := 0, len(r.nodes)-1; i < j; i, j = i+1, j-1 {
+		r.nodes[i], r.nodes[j] = r.nodes[j], r.nodes[i]
+	}
+	for i, j := 0, len(r.edges)-1; i < j; i, j = i+1, j-1 {
+		r.edges[i], r.edges[j] = r.edges[j], r.edges[i]
+	}
+	return r
+}
+
+// shortestPaths returns up to k loopless routes in increasing cost using
+// Yen's algorithm. With a nil weight, routes are ranked by hop count and
+// the first one is found with a plain breadth-first search.
+func (n *network) shortestPaths(from, to string, k int, weight edgeWeight) []route {
+	search := func(src string, ex exclusions) (route, bool) {
+		if weight == nil {
+			return n.bfsPath(src, to, ex)
+		}
+		return n.dijkstraPath(src, to, weight, ex)
+	}
+	if weight == nil {
+		weight = unitWeight
+	}
+
+	first, ok := search(from, exclusions{})
+	if !ok {
+		return nil
+	}
+	found := []route{first}
+	var candidates []route
+
+	for len(found) < k {
+		last := found[len(found)-1]
+		for i := 0; i < len(last.nodes)-1; i++ {
+			spur := last.nodes[i]
+			rootNodes := last.nodes[:i+1]
+			rootEdges := last.edges[:i]
+
+			ex := exclusions{nodes: map[string]bool{}, edges: map[string]bool{}}
+			// Don't repeat an edge already taken from this root
+			for _, p := range found {
+				if len(p.nodes) > i && equalIDs(p.nodes[:i+1], rootNodes) {
+					ex.edges[p.edges[i].ID] = true
+				}
+			}
+			// Keep the route loopless
+			for _, id := range rootNodes[:i] {
+				ex.nodes[id] = true
+			}
+
+			spurRoute, ok := search(spur, ex)
+			if !ok {
+				continue
+			}
+
+			candidate := route{
+				nodes: append(append([]string{}, rootNodes...), spurRoute.nodes[1:]...),
+				edges: append(append([]Connection{}, rootEdges...), spurRoute.edges...),
+			}
+			for _, conn := range candidate.edges {
+				candidate.cost += weight(conn)
+			}
+			if !containsRoute(found, candidate) && !containsRoute(candidates, candidate) {
+				candidates = append(candidates, candidate)
+			}
+		}
+
+		if len(candidates) == 0 {
+			break
+		}
+		sort.SliceStable(candidates, func(a, b int) bool {
+			if candidates[a].cost != candidates[b].cost {
+				return candidates[a].cost < candidates[b].cost
+			}
+			return len(candidates[a].edges) < len(candidates[b].edges)
+		})
+		found = append(found, candidates[0])
+		candidates = candidates[1:]
+	}
+
+	return found
+}
+
+// toPath expands a route into people, connections and a readable narrative
+func (n *network) toPath(r route) Path {
+	path := Path{
+		Hops:      len(r.edges),
+		Cost:      r.cost,
+		Nodes:     make([]Person, len(r.nodes)),
+		Edges:     r.edges,
+		Narrative: make([]string, len(r.edges)),
+	}
+	for i, id := range r.nodes {
+		path.Nodes[i] = n.people[id]
+	}
+	for i, conn := range r.edges {
+		if conn.Description != "" {
+			path.Narrative[i] = conn.Description
+		} else {
+			path.Narrative[i] = fmt.Sprintf("%s -[%s]-> %s",
+				n.people[conn.Source].Name, conn.Type, n.people[conn.Target].Name)
+		}
+	}
+	return path
+}
+
+func equalIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func containsRoute(routes []route, r route) bool {
+	for _, existing := range routes {
+		if len(existing.edges) != len(r.edges) {
+			continue
+		}
+		same := true
+		for i := range r.edges {
+			if existing.edges[i].ID != r.edges[i].ID {
+				same = false
+				break
+			}
+		}
+		if same {
+			return true
+		}
+	}
+	return false
+}
+
+// distanceQueue is a min-heap of tentative distances for Dijkstra
+type distanceItem struct {
+	id   string
+	dist float64
+}
+
+type distanceQueue []distanceItem
+
+func (q distanceQueue) Len() int            { return len(q) }
+func (q distanceQueue) Less(i, j int) bool  { return q[i].dist < q[j].dist }
+func (q distanceQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *distanceQueue) Push(x interface{}) { *q = append(*q, x.(distanceItem)) }
+func (q *distanceQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestShortestPaths(t *testing.T) {
+	// Two routes from a to d: a short one of weak connections and a longer
+	// one of strong connections. f is on its own.
+	detour := testGraph("a b c d e f", "a-b", "b-d", "a-c:10", "c-e:10", "e-d:10")
+	square := testGraph("a b c d", "a-b", "a-c", "b-d", "c-d")
+	path := testGraph("a b c d", "a-b", "b-c", "c-d")
+
+	type want struct {
+		nodes []string
+		edges []string
+		cost  float64
+	}
+	tests := []struct {
+		name     string
+		graph    GraphData
+		from, to string
+		k        int
+		weighted bool
+		want     []want
+	}{
+		{"fewest hops", detour, "a", "d", 1, false, []want{
+			{[]string{"a", "b", "d"}, []string{"a-b", "b-d"}, 2},
+		}},
+		{"strongest", detour, "a", "d", 1, true, []want{
+			{[]string{"a", "c", "e", "d"}, []string{"a-c", "c-e", "e-d"}, 0.3},
+		}},
+		{"k hops", detour, "a", "d", 3, false, []want{
+			{[]string{"a", "b", "d"}, []string{"a-b", "b-d"}, 2},
+			{[]string{"a", "c", "e", "d"}, []string{"a-c", "c-e", "e-d"}, 3},
+		}},
+		{"k strongest", detour, "a", "d", 2, true, []want{
+			{[]string{"a", "c", "e", "d"}, []string{"a-c", "c-e", "e-d"}, 0.3},
+			{[]string{"a", "b", "d"}, []string{"a-b", "b-d"}, 2},
+		}},
+		{"equal routes", square, "a", "d", 2, false, []want{
+			{[]string{"a", "b", "d"}, []string{"a-b", "b-d"}, 2},
+			{[]string{"a", "c", "d"}, []string{"a-c", "c-d"}, 2},
+		}},
+		{"against connection direction", path, "d", "a", 2, false, []want{
+			{[]string{"d", "c", "b", "a"}, []string{"c-d", "b-c", "a-b"}, 3},
+		}},
+		{"unreachable", detour, "a", "f", 3, false, nil},
+		{"unreachable weighted", detour, "a", "f", 1, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var weight edgeWeight
+			if tt.weighted {
+				weight = strengthWeight
+			}
+			routes := newNetwork(tt.graph).shortestPaths(tt.from, tt.to, tt.k, weight)
+			if len(routes) != len(tt.want) {
+				t.Fatalf("got %d routes %v, want %d", len(routes), routes, len(tt.want))
+			}
+			for i, r := range routes {
+				if !reflect.DeepEqual(r.nodes, tt.want[i].nodes) {
+					t.Errorf("route %d nodes = %v, want %v", i, r.nodes, tt.want[i].nodes)
+				}
+				if got := connectionIDs(r.edges); !reflect.DeepEqual(got, tt.want[i].edges) {
+					t.Errorf("route %d edges = %v, want %v", i, got, tt.want[i].edges)
+				}
+				if math.Abs(r.cost-tt.want[i].cost) > 1e-9 {
+					t.Errorf("route %d cost = %v, want %v", i, r.cost, tt.want[i].cost)
+				}
+			}
+		})
+	}
+}
+
+func TestPathNarrative(t *testing.T) {
+	graph := testGraph("a b c", "a-b", "c-b")
+	graph.Links[0].Description = "A taught B"
+	net := newNetwork(graph)
+
+	path := net.toPath(net.shortestPaths("a", "c", 1, nil)[0])
+	if path.Hops != 2 || path.Cost != 2 {
+		t.Errorf("hops, cost = %d, %v, want 2, 2", path.Hops, path.Cost)
+	}
+	if got := personIDs(path.Nodes); !reflect.DeepEqual(got, []string{"a", "b", "c"}) {
+		t.Errorf("nodes = %v", got)
+	}
+	want := []string{"A taught B", "C -[colleague]-> B"}
+	if !reflect.DeepEqual(path.Narrative, want) {
+		t.Errorf("narrative = %q, want %q", path.Narrative, want)
+	}
+}
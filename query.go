@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// Page is the paginated envelope returned by list endpoints
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	Total      int    `json:"total"` // number of items matching the filters
+}
+
+// sortKey is the value an item is ordered by. Numeric fields use Num and
+// text fields use Str; the item ID breaks ties so the order is total.
+type sortKey struct {
+	Num int    `json:"n,omitempty"`
+	Str string `json:"s,omitempty"`
+	ID  string `json:"id"`
+}
+
+func (k sortKey) compare(other sortKey) int {
+	if k.Num != other.Num {
+		if k.Num < other.Num {
+			return -1
+		}
+		return 1
+	}
+	if c := strings.Compare(k.Str, other.Str); c != 0 {
+		return c
+	}
+	return strings.Compare(k.ID, other.ID)
+}
+
+// sortFields maps the names accepted in ?sort= to key extractors
+type sortFields[T any] map[string]func(T) sortKey
+
+var personSortFields = sortFields[Person]{
+	"id":         func(p Person) sortKey { return sortKey{ID: p.ID} },
+	"name":       func(p Person) sortKey { return sortKey{Str: strings.ToLower(p.Name), ID: p.ID} },
+	"era":        func(p Person) sortKey { return sortKey{Str: strings.ToLower(p.Era), ID: p.ID} },
+	"country":    func(p Person) sortKey { return sortKey{Str: strings.ToLower(p.Country), ID: p.ID} },
+	"profession": func(p Person) sortKey { return sortKey{Str: strings.ToLower(p.Profession), ID: p.ID} },
+	"yearBirth":  func(p Person) sortKey { return sortKey{Num: p.YearBirth, ID: p.ID} },
+	"yearDeath":  func(p Person) sortKey { return sortKey{Num: p.YearDeath, ID: p.ID} },
+}
+
+var connectionSortFields = sortFields[Connection]{
+	"id":       func(c Connection) sortKey { return sortKey{ID: c.ID} },
+	"source":   func(c Connection) sortKey { return sortKey{Str: c.Source, ID: c.ID} },
+	"target":   func(c Connection) sortKey { return sortKey{Str: c.Target, ID: c.ID} },
+	"type":     func(c Connection) sortKey { return sortKey{Str: c.Type, ID: c.ID} },
+	"strength": func(c Connection) sortKey { return sortKey{Num: c.Strength, ID: c.ID} },
+}
+
+// listOptions holds the sort and pagination parameters shared by list endpoints
+type listOptions struct {
+	sortBy     string
+	descending bool
+	limit      int
+	after      *sortKey
+}
+
+// parseListOptions reads sort, limit and cursor from the query string
+func parseListOptions[T any](q url.Values, fields sortFields[T]) (listOptions, error) {
+	opts := listOptions{sortBy: "id", limit: defaultPageSize}
+
+	if s := q.Get("sort"); s != "" {
+		opts.descending = strings.HasPrefix(s, "-")
+		opts.sortBy = strings.TrimPrefix(s, "-")
+		if _, ok := fields[opts.sortBy]; !ok {
+			var names []string
+			for name := range fields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return opts, fmt.Errorf("sort must be one of %s (prefix with - for descending)", strings.Join(names, ", "))
+		}
+	}
+
+	if l := q.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return opts, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		opts.limit = limit
+	}
+
+	if c := q.Get("cursor"); c != "" {
+		key, err := decodeCursor(c)
+		if err != nil {
+			return opts, fmt.Errorf("invalid cursor")
+		}
+		opts.after = &key
+	}
+
+	return opts, nil
+}
+
+// paginate sorts items and returns the page that follows the cursor
+func paginate[T any](items []T, fields sortFields[T], opts listOptions) Page[T] {
+	keyOf := fields[opts.sortBy]
+	compare := func(a, b sortKey) int {
+		if opts.descending {
+			return b.compare(a)
+		}
+		return a.compare(b)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return compare(keyOf(items[i]), keyOf(items[j])) < 0
+	})
+
+	// Skip everything up to and including the cursor position
+	start := 0
+	if opts.after != nil {
+		start = sort.Search(len(items), func(i int) bool {
+			return compare(keyOf(items[i]), *opts.after) > 0
+		})
+	}
+
+	end := start + opts.limit
+	if end > len(items) {
+		end = len(items)
+	}
+
+	page := Page[T]{Items: items[start:end], Total: len(items)}
+	if end < len(items) {
+		page.NextCursor = encodeCursor(keyOf(items[end-1]))
+	}
+	return page
+}
+
+// Cursors are opaque to clients: the sort key of the last item on the page
+func encodeCursor(key sortKey) string {
+	data, _ := json.Marshal(key)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string) (sortKey, error) {
+	var key sortKey
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return key, err
+	}
+	err = json.Unmarshal(data, &key)
+	return key, err
+}
+
+// PersonFilter selects people by their attributes
+type PersonFilter struct {
+	Eras       []string // exact, case-insensitive
+	Country    string   // case-insensitive substring
+	Profession string   // case-insensitive substring
+	BornAfter  *int     // exclusive
+	BornBefore *int     // exclusive
+}
+
+// parsePersonFilter reads era, country, profession, born_after and born_before
+func parsePersonFilter(q url.Values) (PersonFilter, error) {
+	filter := PersonFilter{
+		Eras:       splitList(q.Get("era")),
+		Country:    strings.ToLower(q.Get("country")),
+		Profession: strings.ToLower(q.Get("profession")),
+	}
+
+	var err error
+	if filter.BornAfter, err = optionalInt(q, "born_after"); err != nil {
+		return filter, err
+	}
+	if filter.BornBefore, err = optionalInt(q, "born_before"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// Matches reports whether a person passes every filter. People with an
+// unknown birth year (0) never match a birth year bound.
+func (f PersonFilter) Matches(p Person) bool {
+	if len(f.Eras) > 0 && !containsFold(f.Eras, p.Era) {
+		return false
+	}
+	if f.Country != "" && !strings.Contains(strings.ToLower(p.Country), f.Country) {
+		return false
+	}
+	if f.Profession != "" && !strings.Contains(strings.ToLower(p.Profession), f.Profession) {
+		return false
+	}
+	if f.BornAfter != nil && (p.YearBirth == 0 || p.YearBirth <= *f.BornAfter) {
+		return false
+	}
+	if f.BornBefore != nil && (p.YearBirth == 0 || p.YearBirth >= *f.BornBefore) {
+		return false
+	}
+	return true
+}
+
+// ConnectionFilter selects connections by type, strength, endpoints and confidence
+type ConnectionFilter struct {
+	Types       []string
+	MinStrength int
+	Source      string
+	Target      string
+	Confidence  []string
+}
+
+// parseConnectionFilter reads type, min_strength, source, target and confidence
+func parseConnectionFilter(q url.Values) (ConnectionFilter, error) {
+	filter := ConnectionFilter{
+		Types:      splitList(q.Get("type")),
+		Source:     q.Get("source"),
+		Target:     q.Get("target"),
+		Confidence: splitList(q.Get("confidence")),
+	}
+
+	minStrength, err := optionalInt(q, "min_strength")
+	if err != nil {
+		return filter, err
+	}
+	if minStrength != nil {
+		filter.MinStrength = *minStrength
+	}
+	return filter, nil
+}
+
+// Matches reports whether a connection passes every filter
+func (f ConnectionFilter) Matches(c Connection) bool {
+	if len(f.Types) > 0 && !containsFold(f.Types, c.Type) {
+		return false
+	}
+	if c.Strength < f.MinStrength {
+		return false
+	}
+	if f.Source != "" && c.Source != f.Source {
+		return false
+	}
+	if f.Target != "" && c.Target != f.Target {
+		return false
+	}
+	if len(f.Confidence) > 0 && !containsFold(f.Confidence, c.Confidence) {
+		return false
+	}
+	return true
+}
+
+// splitList parses a comma-separated query value
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// optionalInt parses an integer query parameter, returning nil if absent
+func optionalInt(q url.Values, name string) (*int, error) {
+	value := q.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an integer", name)
+	}
+	return &n, nil
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	keys := []sortKey{
+		{},
+		{ID: "socrates"},
+		{Num: -470, ID: "socrates"},
+		{Num: 1643, ID: "isaac-newton"},
+		{Str: "émilie du châtelet", ID: "emilie-du-chatelet"},
+		{Str: "a/b+c=d?", ID: "孔子"},
+	}
+	for _, key := range keys {
+		cursor := encodeCursor(key)
+		if strings.ContainsAny(cursor, "+/=") {
+			t.Errorf("cursor %q for %+v isn't URL-safe", cursor, key)
+		}
+		got, err := decodeCursor(cursor)
+		if err != nil || got != key {
+			t.Errorf("decodeCursor(encodeCursor(%+v)) = %+v, %v", key, got, err)
+		}
+
+		// The cursor survives a trip through a query string
+		opts, err := parseListOptions(url.Values{"cursor": {cursor}}, personSortFields)
+		if err != nil || opts.after == nil || *opts.after != key {
+			t.Errorf("parseListOptions with cursor for %+v = %+v, %v", key, opts.after, err)
+		}
+	}
+}
+
+func TestParseListOptionsErrors(t *testing.T) {
+	for _, query := range []string{
+		"sort=height",
+		"sort=-",
+		"limit=0",
+		"limit=1001",
+		"limit=ten",
+		"cursor=not-base64!",
+		"cursor=" + url.QueryEscape("bm90IGpzb24"), // "not json"
+	} {
+		q, _ := url.ParseQuery(query)
+		if _, err := parseListOptions(q, personSortFields); err == nil {
+			t.Errorf("parseListOptions(%s) succeeded", query)
+		}
+	}
+}
+
+func TestPaginateFollowsCursors(t *testing.T) {
+	people := []Person{
+		{ID: "socrates", Name: "Socrates", YearBirth: -470},
+		{ID: "plato", Name: "Plato", YearBirth: -428},
+		{ID: "xenophon", Name: "Xenophon", YearBirth: -430},
+		{ID: "antisthenes", Name: "Antisthenes", YearBirth: -446},
+		{ID: "aristippus", Name: "Aristippus", YearBirth: -435},
+		{ID: "euclid-of-megara", Name: "Euclid of Megara", YearBirth: -435},
+		{ID: "diogenes", Name: "Diogenes"},
+	}
+
+	for _, sortBy := range []string{"id", "name", "yearBirth", "-yearBirth", "-name"} {
+		// The whole list in one page is the reference order
+		all := paginate(append([]Person{}, people...), personSortFields, mustListOptions(t, "sort="+sortBy+"&limit=100"))
+		if all.NextCursor != "" || len(all.Items) != len(people) {
+			t.Fatalf("sort=%s: single page has %d items and cursor %q", sortBy, len(all.Items), all.NextCursor)
+		}
+
+		for limit := 1; limit <= len(people); limit++ {
+			var got []string
+			cursor := ""
+			for pages := 0; ; pages++ {
+				if pages > len(people) {
+					t.Fatalf("sort=%s limit=%d: cursors don't end", sortBy, limit)
+				}
+				query := "sort=" + url.QueryEscape(sortBy) + "&limit=" + strconv.Itoa(limit)
+				if cursor != "" {
+					query += "&cursor=" + cursor
+				}
+				page := paginate(append([]Person{}, people...), personSortFields, mustListOptions(t, query))
+				if page.Total != len(people) {
+					t.Fatalf("sort=%s: total = %d", sortBy, page.Total)
+				}
+				got = append(got, personIDs(page.Items)...)
+				if page.NextCursor == "" {
+					break
+				}
+				cursor = page.NextCursor
+			}
+			if want := personIDs(all.Items); !reflect.DeepEqual(got, want) {
+				t.Errorf("sort=%s limit=%d: pages = %v, want %v", sortBy, limit, got, want)
+			}
+		}
+	}
+}
+
+func TestPaginateResumesAfterRemovedItem(t *testing.T) {
+	people := []Person{
+		{ID: "a", YearBirth: 1},
+		{ID: "b", YearBirth: 2},
+		{ID: "c", YearBirth: 2},
+		{ID: "d", YearBirth: 3},
+	}
+	first := paginate(append([]Person{}, people...), personSortFields, mustListOptions(t, "sort=yearBirth&limit=2"))
+	if ids := personIDs(first.Items); !reflect.DeepEqual(ids, []string{"a", "b"}) {
+		t.Fatalf("first page = %v", ids)
+	}
+
+	// b is deleted before the next page is asked for; the cursor still
+	// points between b and c
+	rest := []Person{people[0], people[2], people[3]}
+	second := paginate(rest, personSortFields, mustListOptions(t, "sort=yearBirth&limit=2&cursor="+first.NextCursor))
+	if ids := personIDs(second.Items); !reflect.DeepEqual(ids, []string{"c", "d"}) {
+		t.Errorf("second page = %v, want [c d]", ids)
+	}
+}
+
+func mustListOptions(t *testing.T, query string) listOptions {
+	t.Helper()
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := parseListOptions(q, personSortFields)
+	if err != nil {
+		t.Fatalf("parseListOptions(%s): %v", query, err)
+	}
+	return opts
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRetries is how many times a throttled request is retried
+	maxRetries = 4
+	// maxBackoff caps the wait between retries when the server doesn't say
+	maxBackoff = 30 * time.Second
+)
+
+// RateLimiter is a token bucket shared by every request to Wikipedia and
+// Wikidata. Tokens accrue at rate per second up to burst; each request takes
+// one, waiting if none is left.
+type RateLimiter struct {
+	mu          sync.Mutex
+	rate        float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+	pausedUntil time.Time // set when the server asks us to back off
+}
+
+// NewRateLimiter creates a limiter allowing rate requests per second on average
+func NewRateLimiter(rate float64) *RateLimiter {
+	l := &RateLimiter{last: time.Now()}
+	l.SetRate(rate)
+	l.tokens = l.burst
+	return l
+}
+
+// SetRate changes the average rate. Bursts of up to one second's worth of
+// requests are allowed.
+func (l *RateLimiter) SetRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refill(time.Now())
+	l.rate = rate
+	l.burst = math.Max(1, math.Ceil(rate))
+	l.tokens = math.Min(l.tokens, l.burst)
+}
+
+// refill adds the tokens accrued since the last call. The caller must hold
+// the lock.
+func (l *RateLimiter) refill(now time.Time) {
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+}
+
+// Wait blocks until a request may be sent or ctx is done
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		var wait time.Duration
+		if now.Before(l.pausedUntil) {
+			wait = l.pausedUntil.Sub(now)
+		} else {
+			l.refill(now)
+			if l.tokens >= 1 {
+				l.tokens--
+				l.mu.Unlock()
+				return nil
+			}
+			wait = time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		}
+		l.mu.Unlock()
+
+		if err := pause(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// PauseUntil holds every request until t
+func (l *RateLimiter) PauseUntil(t time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if t.After(l.pausedUntil) {
+		l.pausedUntil = t
+	}
+}
+
+// apiThrottle limits how many API requests each client may make per minute.
+// Every client has its own token bucket holding up to a minute's allowance,
+// so short bursts such as a page load are let through.
+type apiThrottle struct {
+	mu        sync.Mutex
+	perMinute int
+	clients   map[string]*clientBucket
+	lastSweep time.Time
+}
+
+type clientBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newAPIThrottle() *apiThrottle {
+	return &apiThrottle{clients: map[string]*clientBucket{}}
+}
+
+// allow takes a token from the client's bucket, or reports how long until
+// one is available
+func (t *apiThrottle) allow(client string, perMinute int, now time.Time) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if perMinute != t.perMinute {
+		// The limit was reloaded; start everyone afresh
+		t.perMinute = perMinute
+		t.clients = map[string]*clientBucket{}
+	}
+	burst, rate := float64(perMinute), float64(perMinute)/60
+	if now.Sub(t.lastSweep) > time.Minute {
+		// Forget clients whose buckets have refilled, so the map doesn't grow
+		// with every address ever seen
+		for addr, b := range t.clients {
+			if b.tokens+now.Sub(b.last).Seconds()*rate >= burst {
+				delete(t.clients, addr)
+			}
+		}
+		t.lastSweep = now
+	}
+
+	b, ok := t.clients[client]
+	if !ok {
+		b = &clientBucket{tokens: burst, last: now}
+		t.clients[client] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / rate * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// throttledTransport sends requests through a RateLimiter. When the server
+// answers 429 Too Many Requests or 503 Service Unavailable, every request
+// is held for the time given by Retry-After, or an exponentially growing
+// backoff if there is none, and the request is retried.
+type throttledTransport struct {
+	base    http.RoundTripper
+	limiter *RateLimiter
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := t.limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+		resp, err := t.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		throttled := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+		if !throttled || attempt == maxRetries || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+
+		wait, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			wait = time.Second << attempt
+			if wait > maxBackoff {
+				wait = maxBackoff
+			}
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		log.Printf("%s returned %d; retrying in %s", req.URL.Host, resp.StatusCode, wait)
+		t.limiter.PauseUntil(time.Now().Add(wait))
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// retryAfter parses a Retry-After header, given either in seconds or as an
+// HTTP date
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		return max(when.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// pause waits for d, returning early with the context's error if it is
+// canceled
+func pause(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// forEach calls fn for 0 <= i < n on up to workers goroutines, stopping
+// early once ctx is canceled
+func forEach(ctx context.Context, workers, n int, fn func(i int)) error {
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(max(workers, 1), n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
+			}
+		}()
+	}
+
+	var err error
+	for i := 0; i < n; i++ {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAPIThrottle(t *testing.T) {
+	throttle := newAPIThrottle()
+	start := time.Now()
+
+	// A minute's allowance may be used at once
+	for i := 0; i < 3; i++ {
+		if _, ok := throttle.allow("10.0.0.1", 3, start); !ok {
+			t.Fatalf("request %d refused", i+1)
+		}
+	}
+	wait, ok := throttle.allow("10.0.0.1", 3, start)
+	if ok || wait != 20*time.Second {
+		t.Errorf("fourth request = %s, %v; want refused for 20s", wait, ok)
+	}
+	if _, ok := throttle.allow("10.0.0.2", 3, start); !ok {
+		t.Error("another client was refused")
+	}
+
+	// One token is back after a third of a minute
+	if _, ok := throttle.allow("10.0.0.1", 3, start.Add(20*time.Second)); !ok {
+		t.Error("request after refill refused")
+	}
+	if _, ok := throttle.allow("10.0.0.1", 3, start.Add(21*time.Second)); ok {
+		t.Error("second request after refill allowed")
+	}
+
+	// A reloaded limit starts everyone afresh
+	if _, ok := throttle.allow("10.0.0.1", 10, start.Add(21*time.Second)); !ok {
+		t.Error("request after the limit changed refused")
+	}
+
+	// Idle clients are forgotten
+	throttle.allow("10.0.0.3", 10, start.Add(10*time.Minute))
+	if len(throttle.clients) != 1 {
+		t.Errorf("%d clients remembered, want 1", len(throttle.clients))
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"api": {"rateLimit": 2}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig([]string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := rateLimitMiddleware(config, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	get := func(path, addr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = addr
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	for i, want := range []int{200, 200, 429} {
+		if rec := get("/api/people", "192.0.2.1:1234"); rec.Code != want {
+			t.Errorf("request %d = %d, want %d", i+1, rec.Code, want)
+		} else if want == 429 && rec.Header().Get("Retry-After") != "30" {
+			t.Errorf("Retry-After = %q, want 30", rec.Header().Get("Retry-After"))
+		}
+	}
+	// Another port on the same host is the same client
+	if rec := get("/api/people", "192.0.2.1:5678"); rec.Code != 429 {
+		t.Errorf("same host, new port = %d, want 429", rec.Code)
+	}
+	if rec := get("/index.html", "192.0.2.1:1234"); rec.Code != 200 {
+		t.Errorf("static file = %d, want 200", rec.Code)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRateLimiterWaitStopsWhenCanceled(t *testing.T) {
+	limiter := NewRateLimiter(0.001)
+	if err := limiter.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Wait = %v, want the context's error", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Wait took %s after the context ended", elapsed)
+	}
+}
+
+func TestThrottledTransportStopsBackoffWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	attempts := 0
+	transport := &throttledTransport{
+		limiter: NewRateLimiter(100),
+		base: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			cancel() // the job is canceled while the server asks us to wait
+			rec := httptest.NewRecorder()
+			rec.Header().Set("Retry-After", "3600")
+			rec.WriteHeader(http.StatusTooManyRequests)
+			return rec.Result(), nil
+		}),
+	}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://en.wikipedia.org/w/api.php", nil)
+
+	start := time.Now()
+	if _, err := transport.RoundTrip(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("RoundTrip = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second || attempts != 1 {
+		t.Errorf("RoundTrip took %s and %d attempts after the context was canceled", elapsed, attempts)
+	}
+}
+
+func TestScrapeStopsWhenCanceled(t *testing.T) {
+	scraper := NewWikipediaScraper()
+	scraper.limiter.PauseUntil(time.Now().Add(time.Hour))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := scraper.ScrapeHistoricalFigure(ctx, "Socrates")
+	if !errors.Is(err, context.Canceled) || failureReason(err) != ReasonCanceled {
+		t.Errorf("ScrapeHistoricalFigure = %v (%s), want canceled", err, failureReason(err))
+	}
+	if _, err := scraper.FindRelationships(ctx, "socrates"); !errors.Is(err, context.Canceled) {
+		t.Errorf("FindRelationships = %v, want canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("scraping took %s after the context was canceled", elapsed)
+	}
+}
+
+func TestClientAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string // trusted header
+		headers map[string][]string
+		want    string
+	}{
+		{"connection", "", map[string][]string{"X-Forwarded-For": {"198.51.100.7"}}, "192.0.2.1"},
+		{"forwarded", "X-Forwarded-For", map[string][]string{"X-Forwarded-For": {"198.51.100.7"}}, "198.51.100.7"},
+		{"forwarded through a client's header", "X-Forwarded-For", map[string][]string{"X-Forwarded-For": {"203.0.113.9, 198.51.100.7"}}, "198.51.100.7"},
+		{"forwarded on separate lines", "X-Forwarded-For", map[string][]string{"X-Forwarded-For": {"203.0.113.9", "198.51.100.7"}}, "198.51.100.7"},
+		{"real IP", "X-Real-Ip", map[string][]string{"X-Real-Ip": {"198.51.100.7"}}, "198.51.100.7"},
+		{"header missing", "X-Real-Ip", nil, "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/people", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			for name, values := range tt.headers {
+				req.Header[name] = values
+			}
+			if got := clientAddress(req, tt.header); got != tt.want {
+				t.Errorf("clientAddress = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// refreshJitter spreads scheduled runs up to this fraction of the
+	// interval either side, so restarted replicas don't refresh in lockstep
+	refreshJitter = 0.1
+	// refreshHistory is how many past runs are kept for the status endpoint
+	refreshHistory = 20
+)
+
+// Errors returned when a refresh can't be started
+var (
+	ErrRefreshRunning = errors.New("a refresh is already running")
+	ErrNotLeader      = errors.New("another replica runs scheduled refreshes")
+)
+
+// Refresh triggers
+const (
+	TriggerScheduled = "scheduled"
+	TriggerManual    = "manual"
+)
+
+// FieldChange is a fact about a person that changed on Wikipedia
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// FigureChange records what a refresh changed for one person
+type FigureChange struct {
+	PersonID    string        `json:"personId"`
+	Name        string        `json:"name"`
+	Fields      []FieldChange `json:"fields,omitempty"`
+	Connections []Connection  `json:"connections,omitempty"` // relationships added
+}
+
+// RefreshRun reports one pass over the graph
+type RefreshRun struct {
+	Trigger     string            `json:"trigger"`
+	StartedAt   time.Time         `json:"startedAt"`
+	FinishedAt  *time.Time        `json:"finishedAt,omitempty"`
+	Checked     int               `json:"checked"`     // people re-scraped
+	Updated     int               `json:"updated"`     // people whose facts changed
+	Connections int               `json:"connections"` // relationships added
+	Changes     []FigureChange    `json:"changes"`
+	Failed      map[string]string `json:"failed"`          // person ID -> error
+	Error       string            `json:"error,omitempty"` // why the run stopped early
+}
+
+// copy returns a snapshot that is safe to read while the run continues
+func (r *RefreshRun) copy() RefreshRun {
+	snapshot := *r
+	snapshot.Changes = append([]FigureChange{}, r.Changes...)
+	snapshot.Failed = make(map[string]string, len(r.Failed))
+	for id, err := range r.Failed {
+		snapshot.Failed[id] = err
+	}
+	return snapshot
+}
+
+// RefreshStatus describes the refresh schedule and recent runs
+type RefreshStatus struct {
+	Interval int          `json:"interval"` // seconds between runs; 0 if scheduling is off
+	NextRun  *time.Time   `json:"nextRun,omitempty"`
+	Replica  string       `json:"replica"`
+	Leader   string       `json:"leader,omitempty"` // replica holding the lease
+	Running  bool         `json:"running"`
+	Runs     []RefreshRun `json:"runs"` // most recent first
+}
+
+// Refresher periodically re-scrapes everyone in the graph from Wikipedia,
+// updating dates and biographies that have changed and adding relationships
+// that are new. Only the replica holding the lease runs; the others skip
+// their turn.
+type Refresher struct {
+	scraper  *WikipediaScraper
+	store    GraphStore
+	temporal TemporalPolicy
+	lease    Lease
+	interval time.Duration
+
+	mu      sync.Mutex
+	next    time.Time // zero while scheduling is off
+	current *RefreshRun
+	runs    []RefreshRun // most recent first
+
+	reschedule chan struct{} // wakes the schedule when the interval changes
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	stopped    bool
+}
+
+// NewRefresher creates a refresher that runs every interval, or only when
+// triggered if interval is 0
+func NewRefresher(scraper *WikipediaScraper, store GraphStore, temporal TemporalPolicy, lease Lease, interval time.Duration) *Refresher {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Refresher{
+		scraper:    scraper,
+		store:      store,
+		temporal:   temporal,
+		lease:      lease,
+		reschedule: make(chan struct{}, 1),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	r.SetInterval(interval)
+	r.wg.Add(1)
+	go r.schedule()
+	return r
+}
+
+// SetInterval changes the time between runs, counting the next run from
+// now. An interval of 0 turns scheduling off.
+func (r *Refresher) SetInterval(interval time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if interval == r.interval {
+		return
+	}
+	r.interval = interval
+	r.next = time.Time{}
+	if interval > 0 {
+		r.next = time.Now().Add(jitter(interval))
+	}
+	select {
+	case r.reschedule <- struct{}{}:
+	default:
+	}
+}
+
+// jitter returns the interval moved randomly by up to refreshJitter of itself
+func jitter(interval time.Duration) time.Duration {
+	spread := float64(interval) * refreshJitter
+	return interval + time.Duration((rand.Float64()*2-1)*spread)
+}
+
+// schedule starts a run each time the next run comes due
+func (r *Refresher) schedule() {
+	defer r.wg.Done()
+	for {
+		r.mu.Lock()
+		next := r.next
+		r.mu.Unlock()
+
+		var timer *time.Timer
+		var due <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			due = timer.C
+		}
+		fired := false
+		select {
+		case <-r.ctx.Done():
+		case <-r.reschedule:
+		case <-due:
+			fired = true
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if r.ctx.Err() != nil {
+			return
+		}
+		if !fired {
+			continue
+		}
+
+		switch _, err := r.Trigger(TriggerScheduled); {
+		case errors.Is(err, ErrNotLeader):
+			log.Printf("Skipping scheduled refresh: %v", err)
+		case err != nil:
+			log.Printf("Scheduled refresh not started: %v", err)
+		}
+
+		r.mu.Lock()
+		if r.interval > 0 {
+			r.next = time.Now().Add(jitter(r.interval))
+		}
+		r.mu.Unlock()
+	}
+}
+
+// Trigger starts a run in the background if none is running and this
+// replica holds the lease
+func (r *Refresher) Trigger(trigger string) (RefreshRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return RefreshRun{}, fmt.Errorf("refresher is stopped")
+	}
+	if r.current != nil {
+		return r.current.copy(), ErrRefreshRunning
+	}
+	leader, err := r.lease.Acquire()
+	if err != nil {
+		return RefreshRun{}, err
+	}
+	if !leader {
+		return RefreshRun{}, ErrNotLeader
+	}
+
+	r.current = &RefreshRun{
+		Trigger:   trigger,
+		StartedAt: time.Now().UTC(),
+		Changes:   []FigureChange{},
+		Failed:    map[string]string{},
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		err := r.run(r.ctx)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		finished := time.Now().UTC()
+		r.current.FinishedAt = &finished
+		if err != nil {
+			r.current.Error = err.Error()
+		}
+		log.Printf("Refresh finished: %d checked, %d updated, %d connections added, %d failures",
+			r.current.Checked, r.current.Updated, r.current.Connections, len(r.current.Failed))
+		r.runs = append([]RefreshRun{*r.current}, r.runs...)
+		if len(r.runs) > refreshHistory {
+			r.runs = r.runs[:refreshHistory]
+		}
+		r.current = nil
+	}()
+	return r.current.copy(), nil
+}
+
+// Status returns the schedule and the current and recent runs
+func (r *Refresher) Status() RefreshStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	status := RefreshStatus{
+		Interval: int(r.interval / time.Second),
+		Replica:  replicaName(),
+		Leader:   r.lease.Holder(),
+		Running:  r.current != nil,
+		Runs:     []RefreshRun{},
+	}
+	if !r.next.IsZero() {
+		next := r.next.UTC()
+		status.NextRun = &next
+	}
+	if r.current != nil {
+		status.Runs = append(status.Runs, r.current.copy())
+	}
+	for _, run := range r.runs {
+		status.Runs = append(status.Runs, run.copy())
+	}
+	return status
+}
+
+// Stop cancels the schedule and any running refresh, waits for them to
+// finish and gives up the lease
+func (r *Refresher) Stop() {
+	r.mu.Lock()
+	r.stopped = true
+	r.mu.Unlock()
+
+	r.cancel()
+	r.wg.Wait()
+	if err := r.lease.Release(); err != nil {
+		log.Printf("Error releasing refresh lease: %v", err)
+	}
+}
+
+// update changes the current run under the lock
+func (r *Refresher) update(change func(*RefreshRun)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	change(r.current)
+}
+
+// run re-scrapes everyone on the scraper's worker pool, then looks for new
+// relationships between them. As with crawls, relationships come last so
+// that text analysis can recognize everyone re-scraped.
+func (r *Refresher) run(ctx context.Context) error {
+	people, err := r.store.ListPeople()
+	if err != nil {
+		return fmt.Errorf("error listing people: %w", err)
+	}
+
+	// Indexed like people, so workers never share an element
+	titles := make([]string, len(people)) // article titles, for those found
+	fields := make([][]FieldChange, len(people))
+	added := make([][]Connection, len(people))
+	err = r.scraper.each(ctx, len(people), func(i int) {
+		person := people[i]
+		title, changed, err := r.refreshFacts(ctx, person)
+		if err != nil {
+			log.Printf("Refresh failed for %s: %v", person.ID, err)
+			r.update(func(run *RefreshRun) { run.Failed[person.ID] = err.Error() })
+			return
+		}
+		titles[i], fields[i] = title, changed
+		r.update(func(run *RefreshRun) {
+			run.Checked++
+			if len(changed) > 0 {
+				run.Updated++
+			}
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("refresh canceled: %w", err)
+	}
+
+	err = r.scraper.each(ctx, len(people), func(i int) {
+		person := people[i]
+		if titles[i] == "" {
+			return
+		}
+		connections, err := r.scraper.relationships(ctx, person.ID, titles[i])
+		if err != nil {
+			log.Printf("Refresh could not find relationships for %s: %v", person.ID, err)
+			r.update(func(run *RefreshRun) { run.Failed[person.ID] = err.Error() })
+			return
+		}
+		added[i] = storeConnections(r.store, r.temporal.filter(r.store, connections))
+		if len(added[i]) > 0 {
+			r.update(func(run *RefreshRun) { run.Connections += len(added[i]) })
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("refresh canceled: %w", err)
+	}
+
+	r.update(func(run *RefreshRun) {
+		for i, person := range people {
+			if len(fields[i]) > 0 || len(added[i]) > 0 {
+				run.Changes = append(run.Changes, FigureChange{
+					PersonID:    person.ID,
+					Name:        person.Name,
+					Fields:      fields[i],
+					Connections: added[i],
+				})
+			}
+		}
+	})
+	return nil
+}
+
+// refreshFacts re-scrapes a person and stores any dates or biography that
+// changed. It returns the title of the person's article and the changes.
+func (r *Refresher) refreshFacts(ctx context.Context, person Person) (string, []FieldChange, error) {
+	scraped, _, err := r.scraper.scrape(ctx, person.Name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Apply the changes to the person as stored now, not as listed when the
+	// run started, so that edits made since are kept
+	var fields []FieldChange
+	err = r.store.ModifyPerson(person.ID, func(current *Person) error {
+		fields = applyRefresh(current, *scraped)
+		if len(fields) == 0 {
+			return nil
+		}
+		return ValidatePerson(*current)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	for _, field := range fields {
+		log.Printf("Refreshed %s %s: %q -> %q", person.ID, field.Field, field.Old, field.New)
+	}
+	return scraped.Name, fields, nil
+}
+
+// applyRefresh copies the dates and biography Wikipedia now gives into
+// person, returning what changed. Facts Wikipedia no longer gives are kept,
+// as are fields that are usually curated by hand, such as era and group.
+func applyRefresh(person *Person, scraped Person) []FieldChange {
+	var changes []FieldChange
+	dates := []struct {
+		field   string
+		current **HistoricalDate
+		latest  *HistoricalDate
+	}{
+		{"birth", &person.Birth, scraped.Birth},
+		{"death", &person.Death, scraped.Death},
+		{"floruit", &person.Floruit, scraped.Floruit},
+	}
+	for _, date := range dates {
+		if date.latest == nil || (*date.current != nil && **date.current == *date.latest) {
+			continue
+		}
+		old := ""
+		if *date.current != nil {
+			old = (*date.current).String()
+		}
+		changes = append(changes, FieldChange{Field: date.field, Old: old, New: date.latest.String()})
+		latest := *date.latest
+		*date.current = &latest
+	}
+	person.normalizeDates()
+
+	if scraped.Info != "" && scraped.Info != person.Info {
+		changes = append(changes, FieldChange{Field: "info", Old: person.Info, New: scraped.Info})
+		person.Info = scraped.Info
+	}
+	return changes
+}
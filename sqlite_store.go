@@ -0,0 +1,489 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+
+	_ "modernc.org/sqlite" // pure-Go driver, builds without cgo
+)
+
+// sqliteMigrations are applied in order; the index is the schema version - 1.
+// Never edit a released migration, append a new one instead.
+var sqliteMigrations = []string{
+	// 1: people and connections
+	`CREATE TABLE people (
+		id         TEXT PRIMARY KEY,
+		name       TEXT NOT NULL DEFAULT '',
+		era        TEXT NOT NULL DEFAULT '',
+		profession TEXT NOT NULL DEFAULT '',
+		image_url  TEXT NOT NULL DEFAULT '',
+		year_birth INTEGER NOT NULL DEFAULT 0,
+		year_death INTEGER NOT NULL DEFAULT 0,
+		country    TEXT NOT NULL DEFAULT '',
+		info       TEXT NOT NULL DEFAULT '',
+		grp        INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX idx_people_era ON people(era);
+	CREATE INDEX idx_people_country ON people(country);
+
+	CREATE TABLE connections (
+		seq         INTEGER PRIMARY KEY AUTOINCREMENT,
+		source      TEXT NOT NULL REFERENCES people(id) ON DELETE CASCADE,
+		target      TEXT NOT NULL REFERENCES people(id) ON DELETE CASCADE,
+		type        TEXT NOT NULL DEFAULT '',
+		strength    INTEGER NOT NULL DEFAULT 0,
+		description TEXT NOT NULL DEFAULT '',
+		UNIQUE (source, target)
+	);
+	CREATE INDEX idx_connections_target ON connections(target);`,
+
+	// 2: stable connection IDs
+	`ALTER TABLE connections ADD COLUMN id TEXT;
+	UPDATE connections SET id = lower(hex(randomblob(8))) WHERE id IS NULL;
+	CREATE UNIQUE INDEX idx_connections_id ON connections(id);`,
+
+	// 3: computed analytics per person, stored as a JSON object
+	`ALTER TABLE people ADD COLUMN metrics TEXT NOT NULL DEFAULT '{}';`,
+
+	// 4: structured dates with precision and bounds, stored as JSON (NULL when unknown)
+	`ALTER TABLE people ADD COLUMN birth TEXT;
+	ALTER TABLE people ADD COLUMN death TEXT;
+	ALTER TABLE people ADD COLUMN floruit TEXT;`,
+
+	// 5: connection confidence
+	`ALTER TABLE connections ADD COLUMN confidence TEXT NOT NULL DEFAULT '';`,
+}
+
+// SQLiteStore is a GraphStore backed by an embedded SQLite database
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// OpenSQLiteStore opens (or creates) the database at path and brings its
+// schema up to date
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening SQLite database: %w", err)
+	}
+	// SQLite allows a single writer; one connection avoids SQLITE_BUSY churn
+	db.SetMaxOpenConns(1)
+
+	store := &SQLiteStore{db: db}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// migrate applies any schema migrations the database hasn't seen yet
+func (ss *SQLiteStore) migrate() error {
+	if _, err := ss.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return fmt.Errorf("error creating migrations table: %w", err)
+	}
+
+	var current int
+	if err := ss.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("error reading schema version: %w", err)
+	}
+	if current > len(sqliteMigrations) {
+		return fmt.Errorf("database schema version %d is newer than this binary supports (%d)", current, len(sqliteMigrations))
+	}
+
+	for version := current + 1; version <= len(sqliteMigrations); version++ {
+		tx, err := ss.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[version-1]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error applying migration %d: %w", version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error recording migration %d: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("error committing migration %d: %w", version, err)
+		}
+		log.Printf("Applied SQLite migration %d", version)
+	}
+	return nil
+}
+
+const personColumns = `id, name, era, profession, image_url, year_birth, year_death, country, info, grp, metrics, birth, death, floruit`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func scanPerson(row rowScanner) (Person, error) {
+	var p Person
+	var metrics string
+	var birth, death, floruit sql.NullString
+	err := row.Scan(&p.ID, &p.Name, &p.Era, &p.Profession, &p.ImageURL,
+		&p.YearBirth, &p.YearDeath, &p.Country, &p.Info, &p.Group, &metrics,
+		&birth, &death, &floruit)
+	if err != nil {
+		return p, err
+	}
+	if metrics != "" && metrics != "{}" {
+		if err := json.Unmarshal([]byte(metrics), &p.Metrics); err != nil {
+			return p, fmt.Errorf("error decoding metrics for %s: %w", p.ID, err)
+		}
+	}
+	for _, date := range []struct {
+		column sql.NullString
+		dest   **HistoricalDate
+	}{{birth, &p.Birth}, {death, &p.Death}, {floruit, &p.Floruit}} {
+		if !date.column.Valid {
+			continue
+		}
+		if err := json.Unmarshal([]byte(date.column.String), date.dest); err != nil {
+			return p, fmt.Errorf("error decoding dates for %s: %w", p.ID, err)
+		}
+	}
+	return p, nil
+}
+
+// encodeDate serializes a date for a date column, NULL when unknown
+func encodeDate(date *HistoricalDate) any {
+	if date == nil {
+		return nil
+	}
+	data, _ := json.Marshal(date)
+	return string(data)
+}
+
+// encodeMetrics serializes a metrics map for the metrics column
+func encodeMetrics(metrics map[string]float64) string {
+	if len(metrics) == 0 {
+		return "{}"
+	}
+	data, _ := json.Marshal(metrics)
+	return string(data)
+}
+
+const connectionColumns = `id, source, target, type, strength, description, confidence`
+
+func scanConnection(row rowScanner) (Connection, error) {
+	var c Connection
+	err := row.Scan(&c.ID, &c.Source, &c.Target, &c.Type, &c.Strength, &c.Description, &c.Confidence)
+	return c, err
+}
+
+func (ss *SQLiteStore) GetPerson(id string) (Person, error) {
+	person, err := scanPerson(ss.db.QueryRow(`SELECT `+personColumns+` FROM people WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Person{}, ErrPersonNotFound
+	}
+	return person, err
+}
+
+func (ss *SQLiteStore) PutPerson(person Person) error {
+	_, err := ss.db.Exec(`INSERT INTO people (`+personColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET
+			name = excluded.name, era = excluded.era, profession = excluded.profession,
+			image_url = excluded.image_url, year_birth = excluded.year_birth,
+			year_death = excluded.year_death, country = excluded.country,
+			info = excluded.info, grp = excluded.grp, metrics = excluded.metrics,
+			birth = excluded.birth, death = excluded.death, floruit = excluded.floruit`,
+		person.ID, person.Name, person.Era, person.Profession, person.ImageURL,
+		person.YearBirth, person.YearDeath, person.Country, person.Info, person.Group,
+		encodeMetrics(person.Metrics), encodeDate(person.Birth), encodeDate(person.Death),
+		encodeDate(person.Floruit))
+	return err
+}
+
+func (ss *SQLiteStore) AddPerson(person Person) error {
+	result, err := ss.db.Exec(`INSERT INTO people (`+personColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO NOTHING`,
+		person.ID, person.Name, person.Era, person.Profession, person.ImageURL,
+		person.YearBirth, person.YearDeath, person.Country, person.Info, person.Group,
+		encodeMetrics(person.Metrics), encodeDate(person.Birth), encodeDate(person.Death),
+		encodeDate(person.Floruit))
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrPersonExists
+	}
+	return nil
+}
+
+func (ss *SQLiteStore) UpdatePerson(person Person) error {
+	return updatePerson(ss.db, person)
+}
+
+func updatePerson(ex execer, person Person) error {
+	result, err := ex.Exec(`UPDATE people SET
+			name = ?, era = ?, profession = ?, image_url = ?, year_birth = ?,
+			year_death = ?, country = ?, info = ?, grp = ?, metrics = ?,
+			birth = ?, death = ?, floruit = ?
+		WHERE id = ?`,
+		person.Name, person.Era, person.Profession, person.ImageURL, person.YearBirth,
+		person.YearDeath, person.Country, person.Info, person.Group,
+		encodeMetrics(person.Metrics), encodeDate(person.Birth), encodeDate(person.Death),
+		encodeDate(person.Floruit), person.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrPersonNotFound
+	}
+	return nil
+}
+
+func (ss *SQLiteStore) SetMetric(id, name string, value float64) error {
+	result, err := ss.db.Exec(`UPDATE people SET metrics = json_set(metrics, ?, ?) WHERE id = ?`,
+		`$."`+name+`"`, value, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrPersonNotFound
+	}
+	return nil
+}
+
+func (ss *SQLiteStore) SetGroup(id string, group int) error {
+	result, err := ss.db.Exec(`UPDATE people SET grp = ? WHERE id = ?`, group, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrPersonNotFound
+	}
+	return nil
+}
+
+func (ss *SQLiteStore) ModifyPerson(id string, modify func(*Person) error) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	person, err := scanPerson(tx.QueryRow(`SELECT `+personColumns+` FROM people WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPersonNotFound
+	}
+	if err != nil {
+		return err
+	}
+	before := person.clone()
+	if err := modify(&person); err != nil {
+		return err
+	}
+	person.ID = id
+	if reflect.DeepEqual(person, before) {
+		return nil
+	}
+	if err := updatePerson(tx, person); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (ss *SQLiteStore) DeletePerson(id string) error {
+	// Connections are removed by ON DELETE CASCADE
+	result, err := ss.db.Exec(`DELETE FROM people WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrPersonNotFound
+	}
+	return nil
+}
+
+func (ss *SQLiteStore) ListPeople() ([]Person, error) {
+	return listPeople(ss.db)
+}
+
+func listPeople(q querier) ([]Person, error) {
+	rows, err := q.Query(`SELECT ` + personColumns + ` FROM people ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	people := []Person{}
+	for rows.Next() {
+		person, err := scanPerson(rows)
+		if err != nil {
+			return nil, err
+		}
+		people = append(people, person)
+	}
+	return people, rows.Err()
+}
+
+func (ss *SQLiteStore) GetConnection(id string) (Connection, error) {
+	conn, err := scanConnection(ss.db.QueryRow(`SELECT `+connectionColumns+` FROM connections WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Connection{}, ErrConnectionNotFound
+	}
+	return conn, err
+}
+
+func (ss *SQLiteStore) AddConnection(conn Connection) (Connection, error) {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return Connection{}, err
+	}
+	defer tx.Rollback()
+
+	if err := checkEndpoints(tx, conn); err != nil {
+		return Connection{}, err
+	}
+	if conn.ID == "" {
+		conn.ID = newConnectionID()
+	}
+
+	result, err := tx.Exec(`INSERT INTO connections (`+connectionColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+		conn.ID, conn.Source, conn.Target, conn.Type, conn.Strength, conn.Description, conn.Confidence)
+	if err != nil {
+		return Connection{}, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return Connection{}, ErrConnectionExists
+	}
+	return conn, tx.Commit()
+}
+
+func (ss *SQLiteStore) UpdateConnection(conn Connection) error {
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM connections WHERE id = ?)`, conn.ID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrConnectionNotFound
+	}
+	if err := checkEndpoints(tx, conn); err != nil {
+		return err
+	}
+	if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM connections WHERE source = ? AND target = ? AND id != ?)`,
+		conn.Source, conn.Target, conn.ID).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrConnectionExists
+	}
+
+	if _, err := tx.Exec(`UPDATE connections SET source = ?, target = ?, type = ?, strength = ?, description = ?,
+		confidence = ? WHERE id = ?`, conn.Source, conn.Target, conn.Type, conn.Strength, conn.Description,
+		conn.Confidence, conn.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkEndpoints returns ErrPersonNotFound unless both ends of conn exist
+func checkEndpoints(tx *sql.Tx, conn Connection) error {
+	var endpoints int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM people WHERE id IN (?, ?)`, conn.Source, conn.Target).Scan(&endpoints); err != nil {
+		return err
+	}
+	want := 2
+	if conn.Source == conn.Target {
+		want = 1
+	}
+	if endpoints < want {
+		return ErrPersonNotFound
+	}
+	return nil
+}
+
+func (ss *SQLiteStore) RemoveConnection(id string) error {
+	result, err := ss.db.Exec(`DELETE FROM connections WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrConnectionNotFound
+	}
+	return nil
+}
+
+func (ss *SQLiteStore) ListConnections() ([]Connection, error) {
+	return queryConnections(ss.db, `SELECT `+connectionColumns+` FROM connections ORDER BY seq`)
+}
+
+func (ss *SQLiteStore) Neighbors(id string) ([]Connection, error) {
+	if _, err := ss.GetPerson(id); err != nil {
+		return nil, err
+	}
+	return queryConnections(ss.db, `SELECT `+connectionColumns+` FROM connections
+		WHERE source = ? OR target = ? ORDER BY seq`, id, id)
+}
+
+func queryConnections(q querier, query string, args ...any) ([]Connection, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	connections := []Connection{}
+	for rows.Next() {
+		conn, err := scanConnection(rows)
+		if err != nil {
+			return nil, err
+		}
+		connections = append(connections, conn)
+	}
+	return connections, rows.Err()
+}
+
+func (ss *SQLiteStore) Graph() (GraphData, error) {
+	// Read both tables in one transaction so that every connection's
+	// endpoints are in the snapshot
+	tx, err := ss.db.Begin()
+	if err != nil {
+		return GraphData{}, err
+	}
+	defer tx.Rollback()
+
+	people, err := listPeople(tx)
+	if err != nil {
+		return GraphData{}, err
+	}
+	connections, err := queryConnections(tx, `SELECT `+connectionColumns+` FROM connections ORDER BY seq`)
+	if err != nil {
+		return GraphData{}, err
+	}
+	return GraphData{Nodes: people, Links: connections}, tx.Commit()
+}
+
+// Close releases the database
+func (ss *SQLiteStore) Close() error {
+	return ss.db.Close()
+}
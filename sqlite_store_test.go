@@ -0,0 +1,91 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSQLiteStoreMigratesOldSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "graph.db")
+
+	// A database written by a release that only had the first two migrations
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setup := []string{
+		`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP)`,
+		sqliteMigrations[0],
+		sqliteMigrations[1],
+		`INSERT INTO schema_migrations (version) VALUES (1), (2)`,
+		`INSERT INTO people (id, name, era, year_birth) VALUES ('socrates', 'Socrates', 'Ancient', -470), ('plato', 'Plato', 'Ancient', -428)`,
+		`INSERT INTO connections (id, source, target, type, strength) VALUES ('c1', 'socrates', 'plato', 'mentor', 9)`,
+	}
+	for _, statement := range setup {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatalf("setting up old schema: %v", err)
+		}
+	}
+	db.Close()
+
+	store, err := OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("OpenSQLiteStore: %v", err)
+	}
+	var version int
+	store.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+	if version != len(sqliteMigrations) {
+		t.Fatalf("schema version = %d, want %d", version, len(sqliteMigrations))
+	}
+
+	// Old rows survive and the new columns work
+	want := GraphData{
+		Nodes: []Person{
+			{ID: "socrates", Name: "Socrates", Era: "Ancient", YearBirth: -470},
+			{ID: "plato", Name: "Plato", Era: "Ancient", YearBirth: -428},
+		},
+		Links: []Connection{{ID: "c1", Source: "socrates", Target: "plato", Type: "mentor", Strength: 9}},
+	}
+	if got, err := store.Graph(); err != nil || !reflect.DeepEqual(got, want) {
+		t.Fatalf("graph after migrating = %+v, %v; want %+v", got, err, want)
+	}
+	socrates := want.Nodes[0]
+	socrates.Metrics = map[string]float64{"degree": 1}
+	socrates.Death = &HistoricalDate{Year: -399, Precision: PrecisionYear, Earliest: -399, Latest: -399}
+	if err := store.UpdatePerson(socrates); err != nil {
+		t.Fatalf("UpdatePerson after migrating: %v", err)
+	}
+	store.Close()
+
+	// Reopening applies nothing new and keeps the data
+	store, err = OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer store.Close()
+	var applied int
+	store.db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&applied)
+	if applied != len(sqliteMigrations) {
+		t.Errorf("%d migrations recorded after reopening, want %d", applied, len(sqliteMigrations))
+	}
+	if got, _ := store.GetPerson("socrates"); !reflect.DeepEqual(got, socrates) {
+		t.Errorf("GetPerson after reopening = %+v, want %+v", got, socrates)
+	}
+}
+
+func TestSQLiteStoreRefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "graph.db")
+	store, err := OpenSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.db.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, len(sqliteMigrations)+1)
+	store.Close()
+
+	if store, err := OpenSQLiteStore(path); err == nil {
+		store.Close()
+		t.Fatal("opened a database with a newer schema")
+	}
+}
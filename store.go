@@ -0,0 +1,477 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Errors returned by GraphStore implementations
+var (
+	ErrPersonNotFound     = errors.New("person not found")
+	ErrPersonExists       = errors.New("person already exists")
+	ErrConnectionNotFound = errors.New("connection not found")
+	ErrConnectionExists   = errors.New("connection already exists")
+)
+
+// GraphStore abstracts how the network of people and connections is stored,
+// so handlers don't depend on a particular backend
+type GraphStore interface {
+	// GetPerson returns the person with the given ID or ErrPersonNotFound
+	GetPerson(id string) (Person, error)
+	// PutPerson inserts a person, replacing any existing person with the same ID
+	PutPerson(person Person) error
+	// AddPerson inserts a person, failing with ErrPersonExists if the ID is taken
+	AddPerson(person Person) error
+	// UpdatePerson replaces an existing person, failing with ErrPersonNotFound
+	UpdatePerson(person Person) error
+	// SetMetric records one computed metric for a person, leaving the rest of
+	// the person as it is
+	SetMetric(id, name string, value float64) error
+	// SetGroup changes only a person's group
+	SetGroup(id string, group int) error
+	// ModifyPerson applies modify to the stored person and saves the result,
+	// with no other write to the person in between. If modify fails the
+	// person is left as it was. modify must not use the store.
+	ModifyPerson(id string, modify func(*Person) error) error
+	// DeletePerson removes a person together with all of their connections
+	DeletePerson(id string) error
+	// ListPeople returns every person in insertion order
+	ListPeople() ([]Person, error)
+
+	// GetConnection returns the connection with the given ID or ErrConnectionNotFound
+	GetConnection(id string) (Connection, error)
+	// AddConnection links two existing people and returns the stored connection,
+	// with an ID assigned if it had none. It fails with ErrPersonNotFound if either
+	// end is missing and ErrConnectionExists if the pair is already linked.
+	AddConnection(conn Connection) (Connection, error)
+	// UpdateConnection replaces the connection with the same ID, applying the
+	// same endpoint and duplicate checks as AddConnection
+	UpdateConnection(conn Connection) error
+	// RemoveConnection removes the connection with the given ID
+	RemoveConnection(id string) error
+	// ListConnections returns every connection in insertion order
+	ListConnections() ([]Connection, error)
+	// Neighbors returns every connection starting or ending at the given person
+	Neighbors(id string) ([]Connection, error)
+
+	// Graph returns a copy of the complete network
+	Graph() (GraphData, error)
+}
+
+// newConnectionID generates a random, URL-safe connection ID
+func newConnectionID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("error generating connection ID: %v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// connectionKey identifies a directed source->target pair
+type connectionKey struct {
+	source, target string
+}
+
+// MemoryStore keeps the network in memory, guarded by a read-write mutex.
+// Index maps are maintained on every mutation so lookups by ID, duplicate
+// checks and neighbor queries don't scan the whole graph.
+//
+// Removing a person or connection leaves a hole in data.Nodes or data.Links
+// rather than shifting everything after it, so removals cost O(1) (O(degree)
+// for a person) and insertion order is kept. A slot is live while the index
+// still points at it. Once holes make up half a slice it is compacted, which
+// is amortized over the removals that made them.
+type MemoryStore struct {
+	data GraphData
+	mu   sync.RWMutex
+
+	personIndex     map[string]int                 // person ID -> position in data.Nodes
+	connectionIndex map[string]int                 // connection ID -> position in data.Links
+	pairIndex       map[connectionKey]string       // source/target -> connection ID
+	adjacency       map[string]map[string]struct{} // person ID -> IDs of incident connections
+	removedNodes    int                            // holes in data.Nodes
+	removedLinks    int                            // holes in data.Links
+}
+
+// NewMemoryStore creates an empty in-memory graph store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		data: GraphData{
+			Nodes: []Person{},
+			Links: []Connection{},
+		},
+		personIndex:     make(map[string]int),
+		connectionIndex: make(map[string]int),
+		pairIndex:       make(map[connectionKey]string),
+		adjacency:       make(map[string]map[string]struct{}),
+	}
+}
+
+func (ms *MemoryStore) GetPerson(id string) (Person, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if i, ok := ms.personIndex[id]; ok {
+		return ms.data.Nodes[i].clone(), nil
+	}
+	return Person{}, ErrPersonNotFound
+}
+
+func (ms *MemoryStore) PutPerson(person Person) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if i, ok := ms.personIndex[person.ID]; ok {
+		ms.data.Nodes[i] = person.clone()
+		return nil
+	}
+	ms.insertPerson(person)
+	return nil
+}
+
+func (ms *MemoryStore) AddPerson(person Person) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, ok := ms.personIndex[person.ID]; ok {
+		return ErrPersonExists
+	}
+	ms.insertPerson(person)
+	return nil
+}
+
+func (ms *MemoryStore) UpdatePerson(person Person) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	i, ok := ms.personIndex[person.ID]
+	if !ok {
+		return ErrPersonNotFound
+	}
+	ms.data.Nodes[i] = person.clone()
+	return nil
+}
+
+func (ms *MemoryStore) SetMetric(id, name string, value float64) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	i, ok := ms.personIndex[id]
+	if !ok {
+		return ErrPersonNotFound
+	}
+	person := &ms.data.Nodes[i]
+	if person.Metrics == nil {
+		person.Metrics = make(map[string]float64)
+	}
+	person.Metrics[name] = value
+	return nil
+}
+
+func (ms *MemoryStore) SetGroup(id string, group int) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	i, ok := ms.personIndex[id]
+	if !ok {
+		return ErrPersonNotFound
+	}
+	ms.data.Nodes[i].Group = group
+	return nil
+}
+
+func (ms *MemoryStore) ModifyPerson(id string, modify func(*Person) error) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	i, ok := ms.personIndex[id]
+	if !ok {
+		return ErrPersonNotFound
+	}
+	person := ms.data.Nodes[i].clone()
+	if err := modify(&person); err != nil {
+		return err
+	}
+	person.ID = id
+	ms.data.Nodes[i] = person.clone()
+	return nil
+}
+
+func (ms *MemoryStore) DeletePerson(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	i, ok := ms.personIndex[id]
+	if !ok {
+		return ErrPersonNotFound
+	}
+
+	// Drop every connection that referenced the person
+	for connID := range ms.adjacency[id] {
+		ms.removeConnectionAt(ms.connectionIndex[connID])
+	}
+	delete(ms.adjacency, id)
+
+	delete(ms.personIndex, id)
+	ms.data.Nodes[i] = Person{}
+	ms.removedNodes++
+	if ms.removedNodes > len(ms.data.Nodes)/2 {
+		ms.compactNodes()
+	}
+	return nil
+}
+
+func (ms *MemoryStore) ListPeople() ([]Person, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return ms.people(), nil
+}
+
+func (ms *MemoryStore) GetConnection(id string) (Connection, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if i, ok := ms.connectionIndex[id]; ok {
+		return ms.data.Links[i], nil
+	}
+	return Connection{}, ErrConnectionNotFound
+}
+
+// ConnectionBetween returns the connection from source to target, if any
+func (ms *MemoryStore) ConnectionBetween(source, target string) (Connection, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if id, ok := ms.pairIndex[connectionKey{source, target}]; ok {
+		return ms.data.Links[ms.connectionIndex[id]], nil
+	}
+	return Connection{}, ErrConnectionNotFound
+}
+
+func (ms *MemoryStore) AddConnection(conn Connection) (Connection, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if err := ms.checkAddConnection(conn); err != nil {
+		return Connection{}, err
+	}
+	if conn.ID == "" {
+		conn.ID = newConnectionID()
+	}
+
+	ms.data.Links = append(ms.data.Links, conn)
+	ms.indexConnection(conn, len(ms.data.Links)-1)
+	return conn, nil
+}
+
+func (ms *MemoryStore) UpdateConnection(conn Connection) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if err := ms.checkUpdateConnection(conn); err != nil {
+		return err
+	}
+
+	i := ms.connectionIndex[conn.ID]
+	ms.unindexConnection(ms.data.Links[i])
+	ms.data.Links[i] = conn
+	ms.indexConnection(conn, i)
+	return nil
+}
+
+func (ms *MemoryStore) RemoveConnection(id string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	i, ok := ms.connectionIndex[id]
+	if !ok {
+		return ErrConnectionNotFound
+	}
+	ms.removeConnectionAt(i)
+	return nil
+}
+
+func (ms *MemoryStore) ListConnections() ([]Connection, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return ms.connections(), nil
+}
+
+func (ms *MemoryStore) Neighbors(id string) ([]Connection, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if !ms.hasPerson(id) {
+		return nil, ErrPersonNotFound
+	}
+
+	// Return incident connections in insertion order
+	positions := make([]int, 0, len(ms.adjacency[id]))
+	for connID := range ms.adjacency[id] {
+		positions = append(positions, ms.connectionIndex[connID])
+	}
+	sort.Ints(positions)
+
+	neighbors := make([]Connection, len(positions))
+	for i, pos := range positions {
+		neighbors[i] = ms.data.Links[pos]
+	}
+	return neighbors, nil
+}
+
+func (ms *MemoryStore) Graph() (GraphData, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	return GraphData{Nodes: ms.people(), Links: ms.connections()}, nil
+}
+
+// people copies the live people in insertion order. The caller must hold the
+// lock.
+func (ms *MemoryStore) people() []Person {
+	people := make([]Person, 0, len(ms.data.Nodes)-ms.removedNodes)
+	for i, person := range ms.data.Nodes {
+		if ms.livePerson(i) {
+			people = append(people, person.clone())
+		}
+	}
+	return people
+}
+
+// connections copies the live connections in insertion order. The caller
+// must hold the lock.
+func (ms *MemoryStore) connections() []Connection {
+	if ms.removedLinks == 0 {
+		return append([]Connection{}, ms.data.Links...)
+	}
+	links := make([]Connection, 0, len(ms.data.Links)-ms.removedLinks)
+	for i, conn := range ms.data.Links {
+		if ms.liveConnection(i) {
+			links = append(links, conn)
+		}
+	}
+	return links
+}
+
+// checked runs a check under the read lock, so that a caller serializing
+// its own writes can test a mutation before making it
+func (ms *MemoryStore) checked(check func() error) error {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return check()
+}
+
+// The helpers below expect the caller to hold the lock.
+
+func (ms *MemoryStore) hasPerson(id string) bool {
+	_, ok := ms.personIndex[id]
+	return ok
+}
+
+// checkAddConnection returns the error AddConnection would fail with
+func (ms *MemoryStore) checkAddConnection(conn Connection) error {
+	if !ms.hasPerson(conn.Source) || !ms.hasPerson(conn.Target) {
+		return ErrPersonNotFound
+	}
+	if _, ok := ms.pairIndex[connectionKey{conn.Source, conn.Target}]; ok {
+		return ErrConnectionExists
+	}
+	if _, ok := ms.connectionIndex[conn.ID]; ok && conn.ID != "" {
+		return ErrConnectionExists
+	}
+	return nil
+}
+
+// checkUpdateConnection returns the error UpdateConnection would fail with
+func (ms *MemoryStore) checkUpdateConnection(conn Connection) error {
+	if _, ok := ms.connectionIndex[conn.ID]; !ok {
+		return ErrConnectionNotFound
+	}
+	if !ms.hasPerson(conn.Source) || !ms.hasPerson(conn.Target) {
+		return ErrPersonNotFound
+	}
+	if id, ok := ms.pairIndex[connectionKey{conn.Source, conn.Target}]; ok && id != conn.ID {
+		return ErrConnectionExists
+	}
+	return nil
+}
+
+func (ms *MemoryStore) insertPerson(person Person) {
+	ms.data.Nodes = append(ms.data.Nodes, person.clone())
+	ms.personIndex[person.ID] = len(ms.data.Nodes) - 1
+}
+
+// indexConnection records a connection stored at position i
+func (ms *MemoryStore) indexConnection(conn Connection, i int) {
+	ms.connectionIndex[conn.ID] = i
+	ms.pairIndex[connectionKey{conn.Source, conn.Target}] = conn.ID
+	for _, end := range []string{conn.Source, conn.Target} {
+		if ms.adjacency[end] == nil {
+			ms.adjacency[end] = make(map[string]struct{})
+		}
+		ms.adjacency[end][conn.ID] = struct{}{}
+	}
+}
+
+// unindexConnection forgets a connection. It does not touch data.Links.
+func (ms *MemoryStore) unindexConnection(conn Connection) {
+	delete(ms.connectionIndex, conn.ID)
+	delete(ms.pairIndex, connectionKey{conn.Source, conn.Target})
+	delete(ms.adjacency[conn.Source], conn.ID)
+	delete(ms.adjacency[conn.Target], conn.ID)
+}
+
+// livePerson reports whether data.Nodes[i] holds a person rather than a hole
+func (ms *MemoryStore) livePerson(i int) bool {
+	j, ok := ms.personIndex[ms.data.Nodes[i].ID]
+	return ok && j == i
+}
+
+// liveConnection reports whether data.Links[i] holds a connection rather
+// than a hole
+func (ms *MemoryStore) liveConnection(i int) bool {
+	j, ok := ms.connectionIndex[ms.data.Links[i].ID]
+	return ok && j == i
+}
+
+// removeConnectionAt forgets the connection at position i, leaving a hole
+func (ms *MemoryStore) removeConnectionAt(i int) {
+	ms.unindexConnection(ms.data.Links[i])
+	ms.data.Links[i] = Connection{}
+	ms.removedLinks++
+	if ms.removedLinks > len(ms.data.Links)/2 {
+		ms.compactLinks()
+	}
+}
+
+// compactNodes closes the holes in data.Nodes, keeping the order of the rest
+func (ms *MemoryStore) compactNodes() {
+	nodes := make([]Person, 0, len(ms.data.Nodes)-ms.removedNodes)
+	for i, person := range ms.data.Nodes {
+		if ms.livePerson(i) {
+			ms.personIndex[person.ID] = len(nodes)
+			nodes = append(nodes, person)
+		}
+	}
+	ms.data.Nodes = nodes
+	ms.removedNodes = 0
+}
+
+// compactLinks closes the holes in data.Links, keeping the order of the rest
+func (ms *MemoryStore) compactLinks() {
+	links := make([]Connection, 0, len(ms.data.Links)-ms.removedLinks)
+	for i, conn := range ms.data.Links {
+		if ms.liveConnection(i) {
+			ms.connectionIndex[conn.ID] = len(links)
+			links = append(links, conn)
+		}
+	}
+	ms.data.Links = links
+	ms.removedLinks = 0
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// The tests in this file are run against every GraphStore implementation,
+// so that the backends stay interchangeable
+
+func TestMemoryStoreConformance(t *testing.T) {
+	testGraphStore(t, func(t *testing.T) GraphStore { return NewMemoryStore() })
+}
+
+func TestFileStoreConformance(t *testing.T) {
+	testGraphStore(t, func(t *testing.T) GraphStore { return openTestStore(t, "file", t.TempDir()) })
+	testGraphStoreReopen(t, "file")
+}
+
+func TestSQLiteStoreConformance(t *testing.T) {
+	testGraphStore(t, func(t *testing.T) GraphStore { return openTestStore(t, "sqlite", t.TempDir()) })
+	testGraphStoreReopen(t, "sqlite")
+}
+
+// openTestStore opens a persistent store of the given kind in dir, closing
+// it when the test ends
+func openTestStore(t *testing.T, kind, dir string) GraphStore {
+	t.Helper()
+	var store GraphStore
+	var err error
+	switch kind {
+	case "file":
+		store, err = OpenFileStore(FileStoreOptions{Dir: dir, Fsync: FsyncAlways})
+	case "sqlite":
+		store, err = OpenSQLiteStore(filepath.Join(dir, "graph.db"))
+	}
+	if err != nil {
+		t.Fatalf("opening %s store: %v", kind, err)
+	}
+	t.Cleanup(func() { closeStore(store) })
+	return store
+}
+
+func closeStore(store GraphStore) {
+	if closer, ok := store.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// testPeople are added in this order by seedStore
+var testPeople = []Person{
+	{ID: "socrates", Name: "Socrates", Era: "Ancient", Profession: "Philosopher", Country: "Greece", YearBirth: -470, YearDeath: -399},
+	{ID: "plato", Name: "Plato", Era: "Ancient", Profession: "Philosopher", Country: "Greece", YearBirth: -428, YearDeath: -348,
+		Birth: &HistoricalDate{Year: -428, Precision: PrecisionYear, Earliest: -428, Latest: -427}},
+	{ID: "aristotle", Name: "Aristotle", Era: "Ancient", Profession: "Philosopher, scientist", Country: "Greece", YearBirth: -384, YearDeath: -322,
+		Metrics: map[string]float64{"pagerank": 0.25}},
+	{ID: "isaac-newton", Name: "Isaac Newton", Era: "Early Modern", Profession: "Physicist", Country: "England", YearBirth: 1643, YearDeath: 1727},
+	{ID: "albert-einstein", Name: "Albert Einstein", Era: "Modern", Profession: "Physicist", Country: "Germany", YearBirth: 1879, YearDeath: 1955},
+}
+
+// testConnections are added in this order by seedStore
+var testConnections = []Connection{
+	{ID: "c1", Source: "socrates", Target: "plato", Type: "mentor", Strength: 9, Description: "Teacher"},
+	{ID: "c2", Source: "plato", Target: "aristotle", Type: "mentor", Strength: 9, Description: "Teacher", Confidence: ConfidenceHigh},
+	{ID: "c3", Source: "isaac-newton", Target: "albert-einstein", Type: "influenced", Strength: 8},
+	{ID: "c4", Source: "aristotle", Target: "isaac-newton", Type: "influenced", Strength: 5},
+}
+
+func seedStore(t *testing.T, store GraphStore) {
+	t.Helper()
+	for _, person := range testPeople {
+		if err := store.AddPerson(person); err != nil {
+			t.Fatalf("AddPerson(%s): %v", person.ID, err)
+		}
+	}
+	for _, conn := range testConnections {
+		if _, err := store.AddConnection(conn); err != nil {
+			t.Fatalf("AddConnection(%s): %v", conn.ID, err)
+		}
+	}
+}
+
+func personIDs(people []Person) []string {
+	ids := []string{}
+	for _, person := range people {
+		ids = append(ids, person.ID)
+	}
+	return ids
+}
+
+func connectionIDs(connections []Connection) []string {
+	ids := []string{}
+	for _, conn := range connections {
+		ids = append(ids, conn.ID)
+	}
+	return ids
+}
+
+func expectErr(t *testing.T, what string, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Errorf("%s: got error %v, want %v", what, err, want)
+	}
+}
+
+// testGraphStore checks that a store created by newStore behaves as the
+// GraphStore interface documents
+func testGraphStore(t *testing.T, newStore func(t *testing.T) GraphStore) {
+	t.Run("people", func(t *testing.T) {
+		store := newStore(t)
+		seedStore(t, store)
+
+		people, err := store.ListPeople()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(people, testPeople) {
+			t.Fatalf("ListPeople = %+v, want %+v in insertion order", people, testPeople)
+		}
+		got, err := store.GetPerson("plato")
+		if err != nil || !reflect.DeepEqual(got, testPeople[1]) {
+			t.Fatalf("GetPerson(plato) = %+v, %v", got, err)
+		}
+
+		updated := testPeople[0]
+		updated.Info = "Gadfly of Athens"
+		if err := store.UpdatePerson(updated); err != nil {
+			t.Fatalf("UpdatePerson: %v", err)
+		}
+		if got, _ := store.GetPerson("socrates"); got.Info != updated.Info {
+			t.Errorf("UpdatePerson didn't stick: %+v", got)
+		}
+
+		replaced := testPeople[3]
+		replaced.Country = "Kingdom of England"
+		if err := store.PutPerson(replaced); err != nil {
+			t.Fatalf("PutPerson (replace): %v", err)
+		}
+		added := Person{ID: "ada-lovelace", Name: "Ada Lovelace", Era: "Modern", YearBirth: 1815}
+		if err := store.PutPerson(added); err != nil {
+			t.Fatalf("PutPerson (insert): %v", err)
+		}
+		people, _ = store.ListPeople()
+		want := []string{"socrates", "plato", "aristotle", "isaac-newton", "albert-einstein", "ada-lovelace"}
+		if ids := personIDs(people); !reflect.DeepEqual(ids, want) {
+			t.Errorf("ListPeople after PutPerson = %v, want %v", ids, want)
+		}
+		if people[3].Country != replaced.Country {
+			t.Errorf("PutPerson didn't replace: %+v", people[3])
+		}
+
+		// Callers can't change stored people through returned values
+		got, _ = store.GetPerson("aristotle")
+		got.Metrics["pagerank"] = 1
+		if got, _ := store.GetPerson("aristotle"); got.Metrics["pagerank"] != 0.25 {
+			t.Errorf("stored metrics changed through a returned person: %v", got.Metrics)
+		}
+	})
+
+	t.Run("duplicates and missing records", func(t *testing.T) {
+		store := newStore(t)
+		seedStore(t, store)
+
+		expectErr(t, "AddPerson(existing)", store.AddPerson(testPeople[0]), ErrPersonExists)
+		expectErr(t, "UpdatePerson(missing)", store.UpdatePerson(Person{ID: "nobody"}), ErrPersonNotFound)
+		expectErr(t, "DeletePerson(missing)", store.DeletePerson("nobody"), ErrPersonNotFound)
+		_, err := store.GetPerson("nobody")
+		expectErr(t, "GetPerson(missing)", err, ErrPersonNotFound)
+
+		_, err = store.AddConnection(Connection{Source: "socrates", Target: "plato", Type: "friend"})
+		expectErr(t, "AddConnection(linked pair)", err, ErrConnectionExists)
+		_, err = store.AddConnection(Connection{ID: "c1", Source: "plato", Target: "socrates"})
+		expectErr(t, "AddConnection(taken ID)", err, ErrConnectionExists)
+		_, err = store.AddConnection(Connection{Source: "socrates", Target: "nobody"})
+		expectErr(t, "AddConnection(missing target)", err, ErrPersonNotFound)
+		_, err = store.AddConnection(Connection{Source: "nobody", Target: "plato"})
+		expectErr(t, "AddConnection(missing source)", err, ErrPersonNotFound)
+
+		moved := testConnections[2]
+		moved.Source, moved.Target = "socrates", "plato"
+		expectErr(t, "UpdateConnection(onto linked pair)", store.UpdateConnection(moved), ErrConnectionExists)
+		moved.Target = "nobody"
+		expectErr(t, "UpdateConnection(missing end)", store.UpdateConnection(moved), ErrPersonNotFound)
+		expectErr(t, "UpdateConnection(missing)", store.UpdateConnection(Connection{ID: "nope", Source: "socrates", Target: "plato"}), ErrConnectionNotFound)
+		expectErr(t, "RemoveConnection(missing)", store.RemoveConnection("nope"), ErrConnectionNotFound)
+		_, err = store.GetConnection("nope")
+		expectErr(t, "GetConnection(missing)", err, ErrConnectionNotFound)
+		_, err = store.Neighbors("nobody")
+		expectErr(t, "Neighbors(missing)", err, ErrPersonNotFound)
+
+		// The reverse direction is a different pair
+		reverse, err := store.AddConnection(Connection{Source: "plato", Target: "socrates", Type: "admired", Strength: 7})
+		if err != nil {
+			t.Fatalf("AddConnection(reverse pair): %v", err)
+		}
+		if reverse.ID == "" {
+			t.Error("AddConnection didn't assign an ID")
+		}
+		if got, err := store.GetConnection(reverse.ID); err != nil || !reflect.DeepEqual(got, reverse) {
+			t.Errorf("GetConnection(%s) = %+v, %v", reverse.ID, got, err)
+		}
+
+		// Nothing failed above changed the graph
+		connections, _ := store.ListConnections()
+		want := []string{"c1", "c2", "c3", "c4", reverse.ID}
+		if ids := connectionIDs(connections); !reflect.DeepEqual(ids, want) {
+			t.Errorf("ListConnections = %v, want %v", ids, want)
+		}
+	})
+
+	t.Run("connections", func(t *testing.T) {
+		store := newStore(t)
+		seedStore(t, store)
+
+		connections, err := store.ListConnections()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(connections, testConnections) {
+			t.Fatalf("ListConnections = %+v, want %+v", connections, testConnections)
+		}
+
+		updated := testConnections[3]
+		updated.Target, updated.Type = "albert-einstein", "admired"
+		if err := store.UpdateConnection(updated); err != nil {
+			t.Fatalf("UpdateConnection: %v", err)
+		}
+		if got, _ := store.GetConnection("c4"); !reflect.DeepEqual(got, updated) {
+			t.Errorf("GetConnection after update = %+v, want %+v", got, updated)
+		}
+		// The old pair is free again and the new one is taken
+		if _, err := store.AddConnection(Connection{ID: "c5", Source: "aristotle", Target: "isaac-newton"}); err != nil {
+			t.Errorf("AddConnection(pair freed by update): %v", err)
+		}
+
+		neighbors, _ := store.Neighbors("aristotle")
+		if ids := connectionIDs(neighbors); !reflect.DeepEqual(ids, []string{"c2", "c4", "c5"}) {
+			t.Errorf("Neighbors(aristotle) = %v, want [c2 c4 c5]", ids)
+		}
+
+		if err := store.RemoveConnection("c2"); err != nil {
+			t.Fatalf("RemoveConnection: %v", err)
+		}
+		neighbors, _ = store.Neighbors("aristotle")
+		if ids := connectionIDs(neighbors); !reflect.DeepEqual(ids, []string{"c4", "c5"}) {
+			t.Errorf("Neighbors(aristotle) after removal = %v, want [c4 c5]", ids)
+		}
+		connections, _ = store.ListConnections()
+		if ids := connectionIDs(connections); !reflect.DeepEqual(ids, []string{"c1", "c3", "c4", "c5"}) {
+			t.Errorf("ListConnections after removal = %v", ids)
+		}
+		if _, err := store.AddConnection(Connection{ID: "c2", Source: "plato", Target: "aristotle"}); err != nil {
+			t.Errorf("AddConnection(removed pair and ID): %v", err)
+		}
+	})
+
+	t.Run("delete cascades", func(t *testing.T) {
+		store := newStore(t)
+		seedStore(t, store)
+
+		if err := store.DeletePerson("plato"); err != nil {
+			t.Fatalf("DeletePerson: %v", err)
+		}
+		if _, err := store.GetPerson("plato"); !errors.Is(err, ErrPersonNotFound) {
+			t.Errorf("GetPerson after delete: %v", err)
+		}
+		for _, id := range []string{"c1", "c2"} {
+			if _, err := store.GetConnection(id); !errors.Is(err, ErrConnectionNotFound) {
+				t.Errorf("GetConnection(%s) after deleting an end: %v", id, err)
+			}
+		}
+		neighbors, _ := store.Neighbors("socrates")
+		if len(neighbors) != 0 {
+			t.Errorf("Neighbors(socrates) = %v, want none", connectionIDs(neighbors))
+		}
+		neighbors, _ = store.Neighbors("aristotle")
+		if ids := connectionIDs(neighbors); !reflect.DeepEqual(ids, []string{"c4"}) {
+			t.Errorf("Neighbors(aristotle) = %v, want [c4]", ids)
+		}
+
+		graph, err := store.Graph()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := personIDs(graph.Nodes); !reflect.DeepEqual(ids, []string{"socrates", "aristotle", "isaac-newton", "albert-einstein"}) {
+			t.Errorf("Graph nodes = %v", ids)
+		}
+		if ids := connectionIDs(graph.Links); !reflect.DeepEqual(ids, []string{"c3", "c4"}) {
+			t.Errorf("Graph links = %v", ids)
+		}
+
+		// The ID can be reused
+		if err := store.AddPerson(testPeople[1]); err != nil {
+			t.Errorf("AddPerson(deleted ID): %v", err)
+		}
+		if _, err := store.AddConnection(testConnections[0]); err != nil {
+			t.Errorf("AddConnection(to re-added person): %v", err)
+		}
+	})
+
+	t.Run("metrics", func(t *testing.T) {
+		store := newStore(t)
+		seedStore(t, store)
+
+		if err := store.SetMetric("aristotle", "betweenness", 0.5); err != nil {
+			t.Fatalf("SetMetric: %v", err)
+		}
+		if err := store.SetMetric("aristotle", "pagerank", 0.3); err != nil {
+			t.Fatalf("SetMetric: %v", err)
+		}
+		if err := store.SetMetric("socrates", "pagerank", 0.1); err != nil {
+			t.Fatalf("SetMetric: %v", err)
+		}
+		want := testPeople[2]
+		want.Metrics = map[string]float64{"pagerank": 0.3, "betweenness": 0.5}
+		if got, _ := store.GetPerson("aristotle"); !reflect.DeepEqual(got, want) {
+			t.Errorf("GetPerson after SetMetric = %+v, want %+v", got, want)
+		}
+		if got, _ := store.GetPerson("socrates"); !reflect.DeepEqual(got.Metrics, map[string]float64{"pagerank": 0.1}) {
+			t.Errorf("metrics set on a person without any = %v", got.Metrics)
+		}
+		expectErr(t, "SetMetric(missing)", store.SetMetric("nobody", "pagerank", 1), ErrPersonNotFound)
+	})
+
+	t.Run("groups", func(t *testing.T) {
+		store := newStore(t)
+		seedStore(t, store)
+
+		if err := store.SetGroup("aristotle", 3); err != nil {
+			t.Fatalf("SetGroup: %v", err)
+		}
+		want := testPeople[2]
+		want.Group = 3
+		if got, _ := store.GetPerson("aristotle"); !reflect.DeepEqual(got, want) {
+			t.Errorf("GetPerson after SetGroup = %+v, want %+v", got, want)
+		}
+		expectErr(t, "SetGroup(missing)", store.SetGroup("nobody", 1), ErrPersonNotFound)
+	})
+
+	t.Run("modify", func(t *testing.T) {
+		store := newStore(t)
+		seedStore(t, store)
+
+		err := store.ModifyPerson("plato", func(person *Person) error {
+			person.Info = "Founder of the Academy"
+			person.ID = "ignored"
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ModifyPerson: %v", err)
+		}
+		want := testPeople[1]
+		want.Info = "Founder of the Academy"
+		if got, _ := store.GetPerson("plato"); !reflect.DeepEqual(got, want) {
+			t.Errorf("GetPerson after ModifyPerson = %+v, want %+v", got, want)
+		}
+
+		failed := errors.New("failed")
+		err = store.ModifyPerson("plato", func(person *Person) error {
+			person.Info = "Changed"
+			return failed
+		})
+		expectErr(t, "ModifyPerson(failing)", err, failed)
+		if got, _ := store.GetPerson("plato"); got.Info != want.Info {
+			t.Errorf("failed ModifyPerson changed info to %q", got.Info)
+		}
+		expectErr(t, "ModifyPerson(missing)", store.ModifyPerson("nobody", func(*Person) error { return nil }), ErrPersonNotFound)
+	})
+
+	t.Run("filters and pagination", func(t *testing.T) {
+		store := newStore(t)
+		seedStore(t, store)
+		gs := NewGraphService(store, TemporalOff)
+
+		tests := []struct {
+			query string
+			want  []string
+		}{
+			{"", []string{"albert-einstein", "aristotle", "isaac-newton", "plato", "socrates"}},
+			{"era=ancient", []string{"aristotle", "plato", "socrates"}},
+			{"era=Modern,Early%20Modern&sort=-yearBirth", []string{"albert-einstein", "isaac-newton"}},
+			{"profession=physicist&country=england", []string{"isaac-newton"}},
+			{"born_before=0&sort=yearBirth", []string{"socrates", "plato", "aristotle"}},
+			{"born_after=-400&born_before=1800&sort=name", []string{"aristotle", "isaac-newton"}},
+		}
+		for _, tt := range tests {
+			for _, limit := range []string{"1", "2", "100"} {
+				query := tt.query + "&limit=" + limit
+				got := collectPages[Person](t, gs.GetPeople, "/api/people?"+query)
+				if ids := personIDs(got); !reflect.DeepEqual(ids, tt.want) {
+					t.Errorf("GET /api/people?%s = %v, want %v", query, ids, tt.want)
+				}
+			}
+		}
+
+		connTests := []struct {
+			query string
+			want  []string
+		}{
+			{"type=mentor", []string{"c1", "c2"}},
+			{"type=mentor,influenced&sort=-strength", []string{"c2", "c1", "c3", "c4"}},
+			{"source=aristotle", []string{"c4"}},
+			{"confidence=high", []string{"c2"}},
+			{"min_strength=8&sort=-id", []string{"c3", "c2", "c1"}},
+		}
+		for _, tt := range connTests {
+			for _, limit := range []string{"1", "100"} {
+				query := tt.query + "&limit=" + limit
+				got := collectPages[Connection](t, gs.GetConnections, "/api/connections?"+query)
+				if ids := connectionIDs(got); !reflect.DeepEqual(ids, tt.want) {
+					t.Errorf("GET /api/connections?%s = %v, want %v", query, ids, tt.want)
+				}
+			}
+		}
+	})
+}
+
+// collectPages follows nextCursor from url until the last page, returning
+// every item in order
+func collectPages[T any](t *testing.T, handler http.HandlerFunc, url string) []T {
+	t.Helper()
+	var items []T
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatalf("GET %s: too many pages", url)
+		}
+		target := url
+		if cursor != "" {
+			target += "&cursor=" + cursor
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("GET", target, nil))
+		if rec.Code != 200 {
+			t.Fatalf("GET %s: %d %s", target, rec.Code, rec.Body)
+		}
+		var page Page[T]
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatalf("GET %s: %v", target, err)
+		}
+		items = append(items, page.Items...)
+		if page.NextCursor == "" {
+			return items
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// testGraphStoreReopen checks that a persistent store brings back everything
+// written to it, including after a delete, once closed and opened again
+func testGraphStoreReopen(t *testing.T, kind string) {
+	t.Run("reopen", func(t *testing.T) {
+		dir := t.TempDir()
+		store := openTestStore(t, kind, dir)
+		seedStore(t, store)
+		if err := store.DeletePerson("socrates"); err != nil {
+			t.Fatal(err)
+		}
+		updated := testConnections[3]
+		updated.Strength = 6
+		if err := store.UpdateConnection(updated); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SetMetric("plato", "pagerank", 0.5); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.SetGroup("plato", 2); err != nil {
+			t.Fatal(err)
+		}
+		err := store.ModifyPerson("aristotle", func(person *Person) error {
+			person.Info = "Tutor of Alexander"
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, _ := store.Graph()
+		closeStore(store)
+
+		for i := 0; i < 2; i++ {
+			store = openTestStore(t, kind, dir)
+			got, err := store.Graph()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("graph after reopening %d times = %+v, want %+v", i+1, got, want)
+			}
+			closeStore(store)
+		}
+	})
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// TestMemoryStoreIndexes applies a random mix of mutations and checks after
+// each one that the indexes agree with a plain list of what should be stored
+func TestMemoryStoreIndexes(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	store := NewMemoryStore()
+	var people []string    // live IDs in insertion order
+	var links []Connection // live connections in insertion order
+	nextPerson, nextLink := 0, 0
+
+	for step := 0; step < 3000; step++ {
+		switch op := rng.Intn(10); {
+		case op < 3 || len(people) < 2:
+			id := fmt.Sprintf("p%d", nextPerson)
+			nextPerson++
+			if err := store.AddPerson(Person{ID: id, Name: id}); err != nil {
+				t.Fatalf("step %d: AddPerson: %v", step, err)
+			}
+			people = append(people, id)
+		case op < 7:
+			conn := Connection{
+				ID:     fmt.Sprintf("c%d", nextLink),
+				Source: people[rng.Intn(len(people))],
+				Target: people[rng.Intn(len(people))],
+			}
+			nextLink++
+			_, err := store.AddConnection(conn)
+			linked := false
+			for _, existing := range links {
+				linked = linked || (existing.Source == conn.Source && existing.Target == conn.Target)
+			}
+			if linked != (err == ErrConnectionExists) || (!linked && err != nil) {
+				t.Fatalf("step %d: AddConnection(%s->%s) = %v, already linked: %v", step, conn.Source, conn.Target, err, linked)
+			}
+			if err == nil {
+				links = append(links, conn)
+			}
+		case op < 9 && len(links) > 0:
+			i := rng.Intn(len(links))
+			if err := store.RemoveConnection(links[i].ID); err != nil {
+				t.Fatalf("step %d: RemoveConnection: %v", step, err)
+			}
+			links = append(links[:i], links[i+1:]...)
+		default:
+			i := rng.Intn(len(people))
+			id := people[i]
+			if err := store.DeletePerson(id); err != nil {
+				t.Fatalf("step %d: DeletePerson: %v", step, err)
+			}
+			people = append(people[:i], people[i+1:]...)
+			kept := links[:0]
+			for _, conn := range links {
+				if conn.Source != id && conn.Target != id {
+					kept = append(kept, conn)
+				}
+			}
+			links = kept
+		}
+
+		graph, _ := store.Graph()
+		if ids := personIDs(graph.Nodes); !reflect.DeepEqual(ids, append([]string{}, people...)) {
+			t.Fatalf("step %d: people = %v, want %v", step, ids, people)
+		}
+		if !reflect.DeepEqual(graph.Links, append([]Connection{}, links...)) {
+			t.Fatalf("step %d: connections = %v, want %v", step, connectionIDs(graph.Links), connectionIDs(links))
+		}
+		if step%50 != 0 {
+			continue
+		}
+		for _, id := range people {
+			if _, err := store.GetPerson(id); err != nil {
+				t.Fatalf("step %d: GetPerson(%s): %v", step, id, err)
+			}
+			neighbors, _ := store.Neighbors(id)
+			if got, want := connectionIDs(neighbors), connectionIDs(linearNeighbors(links, id)); !reflect.DeepEqual(got, want) {
+				t.Fatalf("step %d: Neighbors(%s) = %v, want %v", step, id, got, want)
+			}
+		}
+		for _, conn := range links {
+			if got, err := store.ConnectionBetween(conn.Source, conn.Target); err != nil || got != conn {
+				t.Fatalf("step %d: ConnectionBetween(%s, %s) = %v, %v", step, conn.Source, conn.Target, got, err)
+			}
+		}
+	}
+}
+
+// The benchmarks compare the indexed store against scanning the graph, as
+// the store did before it kept indexes
+
+const (
+	benchmarkPeople = 10000
+	benchmarkEdges  = 100000
+)
+
+var (
+	benchmarkOnce  sync.Once
+	benchmarkStore *MemoryStore
+	benchmarkData  GraphData
+)
+
+// benchmarkGraph builds a store with 100k random connections between 10k
+// people, once for every benchmark
+func benchmarkGraph(b *testing.B) (*MemoryStore, GraphData) {
+	b.Helper()
+	benchmarkOnce.Do(func() {
+		rng := rand.New(rand.NewSource(1))
+		benchmarkStore = NewMemoryStore()
+		for i := 0; i < benchmarkPeople; i++ {
+			id := fmt.Sprintf("person-%d", i)
+			benchmarkStore.AddPerson(Person{ID: id, Name: id})
+		}
+		for added := 0; added < benchmarkEdges; {
+			conn := Connection{
+				ID:     fmt.Sprintf("conn-%d", added),
+				Source: fmt.Sprintf("person-%d", rng.Intn(benchmarkPeople)),
+				Target: fmt.Sprintf("person-%d", rng.Intn(benchmarkPeople)),
+			}
+			if _, err := benchmarkStore.AddConnection(conn); err == nil {
+				added++
+			}
+		}
+		benchmarkData, _ = benchmarkStore.Graph()
+	})
+	b.ResetTimer()
+	return benchmarkStore, benchmarkData
+}
+
+// spread maps the ith iteration to an index in [0, n), visiting the whole
+// range rather than just its start
+func spread(i, n int) int {
+	return i * 7919 % n
+}
+
+func linearGetPerson(nodes []Person, id string) (Person, bool) {
+	for _, person := range nodes {
+		if person.ID == id {
+			return person, true
+		}
+	}
+	return Person{}, false
+}
+
+func linearConnectionExists(links []Connection, source, target string) bool {
+	for _, conn := range links {
+		if conn.Source == source && conn.Target == target {
+			return true
+		}
+	}
+	return false
+}
+
+func linearNeighbors(links []Connection, id string) []Connection {
+	neighbors := []Connection{}
+	for _, conn := range links {
+		if conn.Source == id || conn.Target == id {
+			neighbors = append(neighbors, conn)
+		}
+	}
+	return neighbors
+}
+
+func BenchmarkMemoryStoreGetPerson(b *testing.B) {
+	b.Run("indexed", func(b *testing.B) {
+		store, _ := benchmarkGraph(b)
+		for i := 0; i < b.N; i++ {
+			if _, err := store.GetPerson(fmt.Sprintf("person-%d", spread(i, benchmarkPeople))); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("linear-scan", func(b *testing.B) {
+		_, graph := benchmarkGraph(b)
+		for i := 0; i < b.N; i++ {
+			if _, ok := linearGetPerson(graph.Nodes, fmt.Sprintf("person-%d", spread(i, benchmarkPeople))); !ok {
+				b.Fatal("person not found")
+			}
+		}
+	})
+}
+
+func BenchmarkMemoryStoreAddConnectionDuplicate(b *testing.B) {
+	b.Run("indexed", func(b *testing.B) {
+		store, graph := benchmarkGraph(b)
+		for i := 0; i < b.N; i++ {
+			conn := graph.Links[spread(i, len(graph.Links))]
+			conn.ID = ""
+			if _, err := store.AddConnection(conn); err != ErrConnectionExists {
+				b.Fatalf("AddConnection of a duplicate: %v", err)
+			}
+		}
+	})
+	b.Run("linear-scan", func(b *testing.B) {
+		_, graph := benchmarkGraph(b)
+		for i := 0; i < b.N; i++ {
+			conn := graph.Links[spread(i, len(graph.Links))]
+			if !linearConnectionExists(graph.Links, conn.Source, conn.Target) {
+				b.Fatal("duplicate not found")
+			}
+		}
+	})
+}
+
+func BenchmarkMemoryStoreNeighbors(b *testing.B) {
+	b.Run("indexed", func(b *testing.B) {
+		store, _ := benchmarkGraph(b)
+		for i := 0; i < b.N; i++ {
+			if _, err := store.Neighbors(fmt.Sprintf("person-%d", spread(i, benchmarkPeople))); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("linear-scan", func(b *testing.B) {
+		_, graph := benchmarkGraph(b)
+		for i := 0; i < b.N; i++ {
+			linearNeighbors(graph.Links, fmt.Sprintf("person-%d", spread(i, benchmarkPeople)))
+		}
+	})
+}
+
+// BenchmarkMemoryStoreRemoveConnection removes a connection and adds it
+// back, so the graph stays at 100k edges
+func BenchmarkMemoryStoreRemoveConnection(b *testing.B) {
+	store, graph := benchmarkGraph(b)
+	for i := 0; i < b.N; i++ {
+		conn := graph.Links[spread(i, len(graph.Links))]
+		if err := store.RemoveConnection(conn.ID); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := store.AddConnection(conn); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+// maxEgoDepth bounds ego network expansion so a single request can't walk
+// the entire graph through a few hubs
+const maxEgoDepth = 6
+
+// EgoNetwork returns the subgraph induced by every person within depth hops
+// of center. Connections are followed in either direction, and only those
+// matching filter are used for expansion or included in the result.
+func EgoNetwork(store GraphStore, center string, depth int, filter ConnectionFilter) (GraphData, error) {
+	root, err := store.GetPerson(center)
+	if err != nil {
+		return GraphData{}, err
+	}
+
+	graph := GraphData{Nodes: []Person{root}, Links: []Connection{}}
+	visited := map[string]bool{center: true}
+	frontier := []string{center}
+
+	// Breadth-first expansion, one ring per iteration
+	for hop := 0; hop < depth && len(frontier) > 0; hop++ {
+		var next []string
+		for _, id := range frontier {
+			connections, err := store.Neighbors(id)
+			if err != nil {
+				return GraphData{}, err
+			}
+			for _, conn := range connections {
+				if !filter.Matches(conn) {
+					continue
+				}
+				other := conn.Target
+				if other == id {
+					other = conn.Source
+				}
+				if visited[other] {
+					continue
+				}
+
+				person, err := store.GetPerson(other)
+				if err != nil {
+					return GraphData{}, err
+				}
+				visited[other] = true
+				graph.Nodes = append(graph.Nodes, person)
+				next = append(next, other)
+			}
+		}
+		frontier = next
+	}
+
+	// Include every matching connection between the collected people
+	seen := make(map[string]bool)
+	for _, person := range graph.Nodes {
+		connections, err := store.Neighbors(person.ID)
+		if err != nil {
+			return GraphData{}, err
+		}
+		for _, conn := range connections {
+			if seen[conn.ID] || !visited[conn.Source] || !visited[conn.Target] || !filter.Matches(conn) {
+				continue
+			}
+			seen[conn.ID] = true
+			graph.Links = append(graph.Links, conn)
+		}
+	}
+
+	return graph, nil
+}
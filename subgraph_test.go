@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testGraph builds a graph of the space-separated people in ids, linked by
+// edges written "source-target" or "source-target:strength" (default 1).
+// Each connection's ID is its edge without the strength.
+func testGraph(ids string, edges ...string) GraphData {
+	graph := GraphData{Nodes: []Person{}, Links: []Connection{}}
+	for _, id := range strings.Fields(ids) {
+		graph.Nodes = append(graph.Nodes, Person{ID: id, Name: strings.ToUpper(id)})
+	}
+	for _, edge := range edges {
+		pair, weight, _ := strings.Cut(edge, ":")
+		strength := 1
+		if weight != "" {
+			strength, _ = strconv.Atoi(weight)
+		}
+		source, target, _ := strings.Cut(pair, "-")
+		graph.Links = append(graph.Links, Connection{ID: pair, Source: source, Target: target, Type: "colleague", Strength: strength})
+	}
+	return graph
+}
+
+// testStore puts a graph into a memory store
+func testStore(t *testing.T, graph GraphData) *MemoryStore {
+	t.Helper()
+	store := NewMemoryStore()
+	for _, person := range graph.Nodes {
+		if err := store.AddPerson(person); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, conn := range graph.Links {
+		if _, err := store.AddConnection(conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func TestEgoNetwork(t *testing.T) {
+	path := testGraph("a b c d", "a-b", "b-c", "c-d")
+	star := testGraph("hub l1 l2 l3", "l1-hub", "hub-l2", "l3-hub:8")
+	components := testGraph("a b c d", "a-b", "c-d")
+
+	tests := []struct {
+		name      string
+		graph     GraphData
+		center    string
+		depth     int
+		filter    ConnectionFilter
+		wantNodes []string // in the order reached
+		wantLinks []string
+	}{
+		{"depth 0", path, "b", 0, ConnectionFilter{}, []string{"b"}, []string{}},
+		{"one hop either way", path, "b", 1, ConnectionFilter{}, []string{"b", "a", "c"}, []string{"a-b", "b-c"}},
+		{"two hops", path, "a", 2, ConnectionFilter{}, []string{"a", "b", "c"}, []string{"a-b", "b-c"}},
+		{"past the end", path, "a", 6, ConnectionFilter{}, []string{"a", "b", "c", "d"}, []string{"a-b", "b-c", "c-d"}},
+		{"leaf through hub", star, "l1", 2, ConnectionFilter{}, []string{"l1", "hub", "l2", "l3"}, []string{"l1-hub", "hub-l2", "l3-hub"}},
+		{"filter stops expansion", star, "l1", 2, ConnectionFilter{MinStrength: 2}, []string{"l1"}, []string{}},
+		{"filter drops links", star, "hub", 1, ConnectionFilter{MinStrength: 2}, []string{"hub", "l3"}, []string{"l3-hub"}},
+		{"own component only", components, "a", 6, ConnectionFilter{}, []string{"a", "b"}, []string{"a-b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ego, err := EgoNetwork(testStore(t, tt.graph), tt.center, tt.depth, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := personIDs(ego.Nodes); !reflect.DeepEqual(got, tt.wantNodes) {
+				t.Errorf("nodes = %v, want %v", got, tt.wantNodes)
+			}
+			if got := connectionIDs(ego.Links); !reflect.DeepEqual(got, tt.wantLinks) {
+				t.Errorf("links = %v, want %v", got, tt.wantLinks)
+			}
+		})
+	}
+
+	if _, err := EgoNetwork(testStore(t, path), "nobody", 1, ConnectionFilter{}); !errors.Is(err, ErrPersonNotFound) {
+		t.Errorf("EgoNetwork(missing) error = %v, want ErrPersonNotFound", err)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// TemporalPolicy controls what happens to connections that are impossible
+// given the lifespans of the people they join
+type TemporalPolicy string
+
+const (
+	TemporalOff    TemporalPolicy = "off"    // don't check
+	TemporalWarn   TemporalPolicy = "warn"   // log and accept
+	TemporalReject TemporalPolicy = "reject" // refuse the connection
+)
+
+// ParseTemporalPolicy converts a configuration string into a TemporalPolicy
+func ParseTemporalPolicy(s string) (TemporalPolicy, error) {
+	switch policy := TemporalPolicy(s); policy {
+	case TemporalOff, TemporalWarn, TemporalReject:
+		return policy, nil
+	case "":
+		return TemporalWarn, nil
+	default:
+		return "", fmt.Errorf("unknown temporal policy %q (want off, warn or reject)", s)
+	}
+}
+
+const (
+	// maxLifespan is assumed when only one of birth and death is known
+	maxLifespan = 110
+	// floruitMargin is how long before and after their active period someone
+	// known only by a floruit date may have lived
+	floruitMargin = 60
+)
+
+// contemporaryTypes require the two people to have been alive at the same time
+var contemporaryTypes = map[string]bool{
+	"mentor":    true,
+	"student":   true,
+	"colleague": true,
+	"friend":    true,
+	"rival":     true,
+	"spouse":    true,
+}
+
+// TemporalIssue is a connection that contradicts the lifespans of its endpoints
+type TemporalIssue struct {
+	Connection Connection `json:"connection"`
+	Reason     string     `json:"reason"`
+}
+
+// lifespan returns the earliest and latest years a person could have been
+// alive, widened by any uncertainty in their dates. ok is false when nothing
+// is known.
+func lifespan(p Person) (from, to int, ok bool) {
+	birth, death := p.birthDate(), p.deathDate()
+	switch {
+	case birth != nil && death != nil:
+		return birth.Earliest, death.Latest, true
+	case birth != nil:
+		return birth.Earliest, addYears(birth.Latest, maxLifespan), true
+	case death != nil:
+		return addYears(death.Earliest, -maxLifespan), death.Latest, true
+	case p.Floruit != nil:
+		return addYears(p.Floruit.Earliest, -floruitMargin), addYears(p.Floruit.Latest, floruitMargin), true
+	default:
+		return 0, 0, false
+	}
+}
+
+// CheckTemporal explains why conn is impossible given the lifespans of source
+// and target, or returns "" if it is plausible. Connections with an endpoint
+// of unknown lifespan are always plausible.
+//
+// Contemporary relationships (mentor, student, colleague, friend, rival,
+// spouse) need overlapping lifespans. Influence only flows forward in time:
+// the source of "influenced" and the target of "admired" must be born before
+// the other person died.
+func CheckTemporal(conn Connection, source, target Person) string {
+	sourceFrom, sourceTo, ok := lifespan(source)
+	if !ok {
+		return ""
+	}
+	targetFrom, targetTo, ok := lifespan(target)
+	if !ok {
+		return ""
+	}
+
+	switch {
+	case contemporaryTypes[conn.Type]:
+		if sourceFrom > targetTo || targetFrom > sourceTo {
+			return fmt.Sprintf("%s requires overlapping lifespans, but %s (%s) and %s (%s) never lived at the same time",
+				conn.Type, source.Name, formatLifespan(source), target.Name, formatLifespan(target))
+		}
+	case conn.Type == "influenced":
+		if sourceFrom > targetTo {
+			return fmt.Sprintf("%s (%s) was born after %s (%s) died, so could not have influenced them",
+				source.Name, formatLifespan(source), target.Name, formatLifespan(target))
+		}
+	case conn.Type == "admired":
+		if targetFrom > sourceTo {
+			return fmt.Sprintf("%s (%s) died before %s (%s) was born, so could not have admired them",
+				source.Name, formatLifespan(source), target.Name, formatLifespan(target))
+		}
+	}
+	return ""
+}
+
+// formatLifespan renders a person's known dates, e.g. "c. 470 BCE–399 BCE"
+func formatLifespan(p Person) string {
+	birth, death := p.birthDate(), p.deathDate()
+	if birth == nil && death == nil && p.Floruit != nil {
+		return p.Floruit.String()
+	}
+
+	text := "?"
+	if birth != nil {
+		text = birth.String()
+	}
+	if death != nil {
+		return text + "–" + death.String()
+	}
+	return text + "–?"
+}
+
+// AuditTemporal checks every connection in the store
+func AuditTemporal(store GraphStore) ([]TemporalIssue, int, error) {
+	net, err := loadNetwork(store)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	issues := []TemporalIssue{}
+	checked := 0
+	seen := map[string]bool{}
+	for _, id := range net.ids {
+		for _, conn := range net.edges[id] {
+			if seen[conn.ID] {
+				continue
+			}
+			seen[conn.ID] = true
+			checked++
+			if reason := CheckTemporal(conn, net.people[conn.Source], net.people[conn.Target]); reason != "" {
+				issues = append(issues, TemporalIssue{Connection: conn, Reason: reason})
+			}
+		}
+	}
+	return issues, checked, nil
+}
+
+// guard applies the policy to a connection about to be stored. Under
+// TemporalReject an impossible connection yields a ValidationError; under
+// TemporalWarn it is logged and accepted. Unknown endpoints are left for the
+// store to report.
+func (p TemporalPolicy) guard(store GraphStore, conn Connection) error {
+	if p == TemporalOff {
+		return nil
+	}
+	source, err := store.GetPerson(conn.Source)
+	if err != nil {
+		return nil
+	}
+	target, err := store.GetPerson(conn.Target)
+	if err != nil {
+		return nil
+	}
+
+	reason := CheckTemporal(conn, source, target)
+	if reason == "" {
+		return nil
+	}
+	if p == TemporalReject {
+		ve := &ValidationError{}
+		ve.add("type", "is impossible: %s", reason)
+		return ve
+	}
+	log.Printf("Temporal warning for connection %s -> %s: %s", conn.Source, conn.Target, reason)
+	return nil
+}
+
+// filter applies the policy to a batch of connections, dropping the
+// impossible ones under TemporalReject
+func (p TemporalPolicy) filter(store GraphStore, connections []Connection) []Connection {
+	if p == TemporalOff {
+		return connections
+	}
+	kept := make([]Connection, 0, len(connections))
+	for _, conn := range connections {
+		if err := p.guard(store, conn); err != nil {
+			log.Printf("Dropping connection %s -> %s: %v", conn.Source, conn.Target, err)
+			continue
+		}
+		kept = append(kept, conn)
+	}
+	return kept
+}
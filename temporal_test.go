@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var temporalPeople = map[string]Person{
+	"socrates":   {ID: "socrates", Name: "Socrates", YearBirth: -470, YearDeath: -399},
+	"plato":      {ID: "plato", Name: "Plato", YearBirth: -428, YearDeath: -348},
+	"newton":     {ID: "newton", Name: "Isaac Newton", YearBirth: 1643, YearDeath: 1727},
+	"einstein":   {ID: "einstein", Name: "Albert Einstein", YearBirth: 1879, YearDeath: 1955},
+	"euclid":     {ID: "euclid", Name: "Euclid", Floruit: &HistoricalDate{Year: -300, Precision: PrecisionYear, Floruit: true, Earliest: -300, Latest: -300}},
+	"archimedes": {ID: "archimedes", Name: "Archimedes", YearBirth: -287, YearDeath: -212},
+	"unknown":    {ID: "unknown", Name: "Unknown"},
+}
+
+func TestCheckTemporal(t *testing.T) {
+	tests := []struct {
+		source, target, kind string
+		impossible           bool
+	}{
+		{"socrates", "plato", "mentor", false},
+		{"socrates", "newton", "mentor", true},
+		{"newton", "socrates", "friend", true},
+		{"plato", "newton", "influenced", false},
+		{"newton", "plato", "influenced", true}, // influence runs forward in time
+		{"newton", "plato", "admired", false},
+		{"plato", "newton", "admired", true},
+		{"plato", "newton", "associated", false}, // unchecked type
+		{"euclid", "archimedes", "colleague", false},
+		{"euclid", "einstein", "colleague", true},
+		{"unknown", "einstein", "spouse", false}, // unknown lifespan is plausible
+	}
+	for _, tt := range tests {
+		conn := Connection{Source: tt.source, Target: tt.target, Type: tt.kind}
+		reason := CheckTemporal(conn, temporalPeople[tt.source], temporalPeople[tt.target])
+		if (reason != "") != tt.impossible {
+			t.Errorf("CheckTemporal(%s %s %s) = %q, want impossible: %v", tt.source, tt.kind, tt.target, reason, tt.impossible)
+		}
+	}
+}
+
+func newTemporalStore(t *testing.T) GraphStore {
+	t.Helper()
+	store := NewMemoryStore()
+	for _, person := range temporalPeople {
+		if err := store.AddPerson(person); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func TestTemporalPolicyGuard(t *testing.T) {
+	store := newTemporalStore(t)
+	impossible := Connection{Source: "socrates", Target: "newton", Type: "mentor", Strength: 5}
+	plausible := Connection{Source: "socrates", Target: "plato", Type: "mentor", Strength: 5}
+
+	var logged bytes.Buffer
+	previous := log.Writer()
+	log.SetOutput(&logged)
+	defer log.SetOutput(previous)
+
+	tests := []struct {
+		policy  TemporalPolicy
+		reject  bool
+		warning bool
+	}{
+		{TemporalOff, false, false},
+		{TemporalWarn, false, true},
+		{TemporalReject, true, false},
+	}
+	for _, tt := range tests {
+		logged.Reset()
+		err := tt.policy.guard(store, impossible)
+		var ve *ValidationError
+		if rejected := errors.As(err, &ve); rejected != tt.reject {
+			t.Errorf("%s: guard(impossible) = %v, want rejected: %v", tt.policy, err, tt.reject)
+		}
+		if warned := strings.Contains(logged.String(), "Temporal warning"); warned != tt.warning {
+			t.Errorf("%s: logged %q, want a warning: %v", tt.policy, logged.String(), tt.warning)
+		}
+		if err := tt.policy.guard(store, plausible); err != nil {
+			t.Errorf("%s: guard(plausible) = %v", tt.policy, err)
+		}
+
+		kept := tt.policy.filter(store, []Connection{impossible, plausible})
+		want := 2
+		if tt.reject {
+			want = 1
+		}
+		if len(kept) != want || kept[len(kept)-1] != plausible {
+			t.Errorf("%s: filter kept %v", tt.policy, kept)
+		}
+	}
+
+	// Missing endpoints are left for the store to report
+	if err := TemporalReject.guard(store, Connection{Source: "nobody", Target: "plato", Type: "mentor"}); err != nil {
+		t.Errorf("guard with a missing endpoint = %v", err)
+	}
+}
+
+func TestAddConnectionTemporalPolicy(t *testing.T) {
+	body := `{"source": "socrates", "target": "newton", "type": "mentor", "strength": 5}`
+	for policy, want := range map[TemporalPolicy]int{
+		TemporalWarn:   201,
+		TemporalReject: 422,
+	} {
+		gs := NewGraphService(newTemporalStore(t), policy)
+		rec := httptest.NewRecorder()
+		gs.AddConnection(rec, httptest.NewRequest("POST", "/api/connections", strings.NewReader(body)))
+		if rec.Code != want {
+			t.Errorf("%s: POST /api/connections = %d %s, want %d", policy, rec.Code, rec.Body, want)
+			continue
+		}
+		if policy == TemporalReject {
+			var response struct{ Fields []FieldError }
+			json.NewDecoder(rec.Body).Decode(&response)
+			if len(response.Fields) != 1 || response.Fields[0].Field != "type" {
+				t.Errorf("rejection fields = %+v", response.Fields)
+			}
+		}
+	}
+}
+
+func TestAuditTemporal(t *testing.T) {
+	store := newTemporalStore(t)
+	for _, conn := range []Connection{
+		{Source: "socrates", Target: "plato", Type: "mentor"},
+		{Source: "newton", Target: "plato", Type: "influenced"},
+		{Source: "plato", Target: "einstein", Type: "influenced"},
+	} {
+		if _, err := store.AddConnection(conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	issues, checked, err := AuditTemporal(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked != 3 || len(issues) != 1 || issues[0].Connection.Source != "newton" {
+		t.Errorf("AuditTemporal = %+v, checked %d", issues, checked)
+	}
+}
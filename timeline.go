@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxTimelineFrames bounds how many snapshots a single timeline request may produce
+const maxTimelineFrames = 1000
+
+// SnapshotMode selects who appears in the network at a given year
+type SnapshotMode string
+
+const (
+	SnapshotAlive SnapshotMode = "alive" // people alive in that year
+	SnapshotBorn  SnapshotMode = "born"  // everyone born by that year, living or dead
+)
+
+// ParseSnapshotMode converts a query value into a SnapshotMode
+func ParseSnapshotMode(s string) (SnapshotMode, error) {
+	switch mode := SnapshotMode(s); mode {
+	case SnapshotAlive, SnapshotBorn:
+		return mode, nil
+	case "":
+		return SnapshotAlive, nil
+	default:
+		return "", fmt.Errorf("mode must be alive or born")
+	}
+}
+
+// Years are stored as in the historical calendar: -470 is 470 BCE and there
+// is no year 0, so 1 BCE is followed directly by 1 CE.
+
+// addYears moves a historical year by n years, skipping the missing year 0
+func addYears(year, n int) int {
+	astronomical := year
+	if year < 0 {
+		astronomical++
+	}
+	astronomical += n
+	if astronomical <= 0 {
+		return astronomical - 1
+	}
+	return astronomical
+}
+
+// parseYear reads a year such as "1905", "-470", "470 BC", "470 BCE",
+// "AD 30" or "30 CE"
+func parseYear(s string) (int, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	bce := false
+	for _, suffix := range []string{"BCE", "BC", "B.C.E.", "B.C."} {
+		if strings.HasSuffix(value, suffix) {
+			value, bce = strings.TrimSpace(strings.TrimSuffix(value, suffix)), true
+			break
+		}
+	}
+	if !bce {
+		for _, era := range []string{"CE", "AD", "A.D.", "C.E."} {
+			value = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(value, era), era))
+		}
+	}
+
+	year, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid year %q", s)
+	}
+	if bce {
+		if year <= 0 {
+			return 0, fmt.Errorf("invalid year %q", s)
+		}
+		year = -year
+	}
+	if year == 0 {
+		return 0, fmt.Errorf("there is no year 0; use -1 for 1 BCE")
+	}
+	return year, nil
+}
+
+// presentAt reports whether a person appears in the snapshot for year.
+// People with neither year known never appear.
+func presentAt(p Person, year int, mode SnapshotMode) bool {
+	from, to, ok := lifespan(p)
+	if !ok || from > year {
+		return false
+	}
+	return mode == SnapshotBorn || year <= to
+}
+
+// snapshotAt returns the people present in year
+func (n *network) snapshotAt(year int, mode SnapshotMode) map[string]bool {
+	present := map[string]bool{}
+	for _, id := range n.ids {
+		if presentAt(n.people[id], year, mode) {
+			present[id] = true
+		}
+	}
+	return present
+}
+
+// links returns every connection whose endpoints are both present, each once
+func (n *network) links(present map[string]bool) []Connection {
+	links := []Connection{}
+	seen := map[string]bool{}
+	for _, id := range n.ids {
+		if !present[id] {
+			continue
+		}
+		for _, conn := range n.edges[id] {
+			if seen[conn.ID] || !present[conn.Source] || !present[conn.Target] {
+				continue
+			}
+			seen[conn.ID] = true
+			links = append(links, conn)
+		}
+	}
+	return links
+}
+
+// GraphAt returns the network as it existed in year: the people present and
+// the connections between them
+func GraphAt(store GraphStore, year int, mode SnapshotMode) (GraphData, error) {
+	net, err := loadNetwork(store)
+	if err != nil {
+		return GraphData{}, err
+	}
+
+	present := net.snapshotAt(year, mode)
+	graph := GraphData{Nodes: []Person{}, Links: net.links(present)}
+	for _, id := range net.ids {
+		if present[id] {
+			graph.Nodes = append(graph.Nodes, net.people[id])
+		}
+	}
+	return graph, nil
+}
+
+// TimelineFrame is the change in the network since the previous frame. The
+// first frame adds everything present in its year.
+type TimelineFrame struct {
+	Year         int          `json:"year"`
+	AddedNodes   []Person     `json:"addedNodes"`
+	RemovedNodes []string     `json:"removedNodes"`
+	AddedLinks   []Connection `json:"addedLinks"`
+	RemovedLinks []string     `json:"removedLinks"`
+}
+
+// timelineYears lists the years from..to in step-year increments, always
+// ending on to
+func timelineYears(from, to, step int) ([]int, error) {
+	if step < 1 {
+		return nil, fmt.Errorf("step must be positive")
+	}
+	if to < from {
+		return nil, fmt.Errorf("to must not be before from")
+	}
+
+	var years []int
+	for year := from; year < to; year = addYears(year, step) {
+		years = append(years, year)
+		if len(years) >= maxTimelineFrames {
+			return nil, fmt.Errorf("timeline would have more than %d frames; increase step", maxTimelineFrames)
+		}
+	}
+	return append(years, to), nil
+}
+
+// Timeline returns snapshot deltas for each year from from to to
+func Timeline(store GraphStore, from, to, step int, mode SnapshotMode) ([]TimelineFrame, error) {
+	years, err := timelineYears(from, to, step)
+	if err != nil {
+		return nil, err
+	}
+	net, err := loadNetwork(store)
+	if err != nil {
+		return nil, err
+	}
+
+	frames := make([]TimelineFrame, 0, len(years))
+	previousNodes := map[string]bool{}
+	previousLinks := map[string]bool{}
+
+	for _, year := range years {
+		frame := TimelineFrame{
+			Year:         year,
+			AddedNodes:   []Person{},
+			RemovedNodes: []string{},
+			AddedLinks:   []Connection{},
+			RemovedLinks: []string{},
+		}
+
+		present := net.snapshotAt(year, mode)
+		for _, id := range net.ids {
+			switch {
+			case present[id] && !previousNodes[id]:
+				frame.AddedNodes = append(frame.AddedNodes, net.people[id])
+			case !present[id] && previousNodes[id]:
+				frame.RemovedNodes = append(frame.RemovedNodes, id)
+			}
+		}
+
+		links := map[string]bool{}
+		for _, conn := range net.links(present) {
+			links[conn.ID] = true
+			if !previousLinks[conn.ID] {
+				frame.AddedLinks = append(frame.AddedLinks, conn)
+			}
+		}
+		// Walk the previous frame's links in network order for a stable response
+		for _, id := range net.ids {
+			for _, conn := range net.edges[id] {
+				if conn.Source == id && previousLinks[conn.ID] && !links[conn.ID] {
+					frame.RemovedLinks = append(frame.RemovedLinks, conn.ID)
+				}
+			}
+		}
+
+		frames = append(frames, frame)
+		previousNodes, previousLinks = present, links
+	}
+	return frames, nil
+}
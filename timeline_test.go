@@ -0,0 +1,137 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseYear(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"1905", 1905, false},
+		{"-470", -470, false},
+		{"470 BC", -470, false},
+		{"470 bce", -470, false},
+		{"44 B.C.", -44, false},
+		{"AD 30", 30, false},
+		{"30 CE", 30, false},
+		{"0", 0, true},
+		{"0 BC", 0, true},
+		{"-5 BC", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseYear(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseYear(%q) = %d, %v; want %d, error: %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestAddYearsSkipsYearZero(t *testing.T) {
+	tests := []struct{ year, n, want int }{
+		{-1, 1, 1},
+		{1, -1, -1},
+		{-470, 110, -360},
+		{-50, 100, 51},
+		{1643, 84, 1727},
+	}
+	for _, tt := range tests {
+		if got := addYears(tt.year, tt.n); got != tt.want {
+			t.Errorf("addYears(%d, %d) = %d, want %d", tt.year, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestGraphAt(t *testing.T) {
+	store := newTemporalStore(t)
+	for _, conn := range []Connection{
+		{ID: "c1", Source: "socrates", Target: "plato", Type: "mentor"},
+		{ID: "c2", Source: "plato", Target: "newton", Type: "influenced"},
+		{ID: "c3", Source: "newton", Target: "einstein", Type: "influenced"},
+	} {
+		if _, err := store.AddConnection(conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		year   int
+		mode   SnapshotMode
+		people []string
+		links  []string
+	}{
+		{-400, SnapshotAlive, []string{"plato", "socrates"}, []string{"c1"}},
+		{-250, SnapshotAlive, []string{"archimedes", "euclid"}, []string{}},
+		{-250, SnapshotBorn, []string{"archimedes", "euclid", "plato", "socrates"}, []string{"c1"}},
+		{1700, SnapshotAlive, []string{"newton"}, []string{}},
+		{1900, SnapshotBorn, []string{"archimedes", "einstein", "euclid", "newton", "plato", "socrates"}, []string{"c1", "c2", "c3"}},
+	}
+	for _, tt := range tests {
+		graph, err := GraphAt(store, tt.year, tt.mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		people := map[string]bool{}
+		for _, person := range graph.Nodes {
+			people[person.ID] = true
+		}
+		var got []string
+		for _, id := range []string{"archimedes", "einstein", "euclid", "newton", "plato", "socrates", "unknown"} {
+			if people[id] {
+				got = append(got, id)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.people) {
+			t.Errorf("GraphAt(%d, %s) people = %v, want %v", tt.year, tt.mode, got, tt.people)
+		}
+		links := connectionIDs(graph.Links)
+		sort.Strings(links)
+		if !reflect.DeepEqual(links, tt.links) {
+			t.Errorf("GraphAt(%d, %s) links = %v, want %v", tt.year, tt.mode, links, tt.links)
+		}
+	}
+}
+
+func TestTimelineDeltas(t *testing.T) {
+	store := NewMemoryStore()
+	for _, person := range []Person{
+		{ID: "socrates", Name: "Socrates", YearBirth: -470, YearDeath: -399},
+		{ID: "plato", Name: "Plato", YearBirth: -428, YearDeath: -348},
+	} {
+		store.AddPerson(person)
+	}
+	store.AddConnection(Connection{ID: "c1", Source: "socrates", Target: "plato", Type: "mentor"})
+
+	frames, err := Timeline(store, -450, -350, 50, SnapshotAlive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type delta struct {
+		year                int
+		added, removed      []string
+		addedLinks, dropped []string
+	}
+	want := []delta{
+		{-450, []string{"socrates"}, []string{}, []string{}, []string{}},
+		{-400, []string{"plato"}, []string{}, []string{"c1"}, []string{}},
+		{-350, []string{}, []string{"socrates"}, []string{}, []string{"c1"}},
+	}
+	if len(frames) != len(want) {
+		t.Fatalf("got %d frames, want %d", len(frames), len(want))
+	}
+	for i, frame := range frames {
+		got := delta{frame.Year, personIDs(frame.AddedNodes), frame.RemovedNodes, connectionIDs(frame.AddedLinks), frame.RemovedLinks}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("frame %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	if _, err := Timeline(store, -100000, 2000, 1, SnapshotAlive); err == nil {
+		t.Error("Timeline allowed more than maxTimelineFrames frames")
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	minStrength = 1
+	maxStrength = 10
+)
+
+// validIDPattern matches the IDs produced by createIDFromName: lowercase
+// letters, including those of scripts without case, digits and hyphens
+var validIDPattern = regexp.MustCompile(`^[\p{Ll}\p{Lo}\p{Nd}][\p{Ll}\p{Lo}\p{Lm}\p{Mn}\p{Mc}\p{Nd}-]*$`)
+
+// FieldError describes a single invalid field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every problem found with a person or connection
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (ve *ValidationError) Error() string {
+	var problems []string
+	for _, f := range ve.Fields {
+		problems = append(problems, fmt.Sprintf("%s %s", f.Field, f.Message))
+	}
+	return "validation failed: " + strings.Join(problems, "; ")
+}
+
+func (ve *ValidationError) add(field, format string, args ...interface{}) {
+	ve.Fields = append(ve.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// err returns nil when no problems were recorded
+func (ve *ValidationError) err() error {
+	if len(ve.Fields) == 0 {
+		return nil
+	}
+	return ve
+}
+
+// ValidatePerson checks a person for missing or inconsistent fields
+func ValidatePerson(person Person) error {
+	ve := &ValidationError{}
+
+	switch {
+	case person.ID == "":
+		ve.add("id", "is required")
+	case !validIDPattern.MatchString(person.ID):
+		ve.add("id", "must contain only lowercase letters, digits and hyphens")
+	}
+	if strings.TrimSpace(person.Name) == "" {
+		ve.add("name", "is required")
+	}
+	if person.YearBirth != 0 && person.YearDeath != 0 && person.YearDeath < person.YearBirth {
+		ve.add("yearDeath", "must not be before yearBirth (%d)", person.YearBirth)
+	}
+	validateDate(ve, "birth", person.Birth)
+	validateDate(ve, "death", person.Death)
+	validateDate(ve, "floruit", person.Floruit)
+	if person.Birth != nil && person.Death != nil && person.Death.Latest < person.Birth.Earliest {
+		ve.add("death", "must not be entirely before birth")
+	}
+	if person.Group < 0 {
+		ve.add("group", "must not be negative")
+	}
+
+	return ve.err()
+}
+
+// validDatePrecisions are the precisions a HistoricalDate may have
+var validDatePrecisions = map[DatePrecision]bool{
+	PrecisionDay:     true,
+	PrecisionMonth:   true,
+	PrecisionYear:    true,
+	PrecisionDecade:  true,
+	PrecisionCentury: true,
+}
+
+// validateDate checks a structured date, if present
+func validateDate(ve *ValidationError, field string, date *HistoricalDate) {
+	if date == nil {
+		return
+	}
+	if date.Year == 0 {
+		ve.add(field+".year", "is required (there is no year 0; use -1 for 1 BCE)")
+	}
+	if !validDatePrecisions[date.Precision] {
+		ve.add(field+".precision", "must be one of day, month, year, decade, century")
+	}
+	if date.Earliest > date.Latest {
+		ve.add(field+".earliest", "must not be after latest")
+	} else if date.Year != 0 && (date.Year < date.Earliest || date.Year > date.Latest) {
+		ve.add(field+".year", "must be between earliest and latest")
+	}
+	if date.Month < 0 || date.Month > 12 {
+		ve.add(field+".month", "must be between 1 and 12")
+	}
+	if date.Day < 0 || date.Day > 31 {
+		ve.add(field+".day", "must be between 1 and 31")
+	}
+	if date.Calendar != "" && date.Calendar != CalendarJulian && date.Calendar != CalendarGregorian {
+		ve.add(field+".calendar", "must be julian or gregorian")
+	}
+}
+
+// ValidateConnection checks a connection's endpoints, type and strength
+func ValidateConnection(conn Connection) error {
+	ve := &ValidationError{}
+
+	if conn.Source == "" {
+		ve.add("source", "is required")
+	}
+	if conn.Target == "" {
+		ve.add("target", "is required")
+	}
+	if conn.Source != "" && conn.Source == conn.Target {
+		ve.add("target", "must differ from source")
+	}
+	if !IsKnownConnectionType(conn.Type) {
+		ve.add("type", "must be one of %s", strings.Join(KnownConnectionTypes(), ", "))
+	}
+	if conn.Strength < minStrength || conn.Strength > maxStrength {
+		ve.add("strength", "must be between %d and %d", minStrength, maxStrength)
+	}
+	if conn.Confidence != "" && conn.Confidence != ConfidenceHigh && conn.Confidence != ConfidenceLow {
+		ve.add("confidence", "must be %s, %s or empty", ConfidenceHigh, ConfidenceLow)
+	}
+
+	return ve.err()
+}
+
+// writeValidationError responds with 422 and the list of field problems
+func writeValidationError(w http.ResponseWriter, err error) {
+	ve, ok := err.(*ValidationError)
+	if !ok {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	response := struct {
+		Error  string       `json:"error"`
+		Fields []FieldError `json:"fields"`
+	}{
+		Error:  "validation failed",
+		Fields: ve.Fields,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(response)
+}
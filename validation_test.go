@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCreateIDFromName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Albert Einstein", "albert-einstein"},
+		{"Martin Luther King Jr.", "martin-luther-king-jr"},
+		{"Louis XIV", "louis-xiv"},
+		{"Ōda Nobunaga", "oda-nobunaga"},
+		{"Ælfred the Great", "aelfred-the-great"},
+		{"Marie Skłodowska-Curie", "marie-sklodowska-curie"},
+		{"Émilie du Châtelet", "emilie-du-chatelet"},
+		{"Søren Kierkegaard", "soren-kierkegaard"},
+		{"Carl Friedrich Gauß", "carl-friedrich-gauss"},
+		{"Þórbergur Þórðarson", "thorbergur-thordarson"},
+		{"Ō Sadaharu", "o-sadaharu"},
+		{"(Pseudo-)Dionysius", "pseudo-dionysius"},
+		{"孔子", "孔子"},
+		{"Ибн Сина", "ибн-сина"},
+	}
+	for _, tt := range tests {
+		id := createIDFromName(tt.name)
+		if id != tt.want {
+			t.Errorf("createIDFromName(%q) = %q, want %q", tt.name, id, tt.want)
+		}
+		if err := ValidatePerson(Person{ID: id, Name: tt.name}); err != nil {
+			t.Errorf("the ID for %q doesn't validate: %v", tt.name, err)
+		}
+	}
+}
+
+func TestValidatePerson(t *testing.T) {
+	tests := []struct {
+		name   string
+		person Person
+		fields []string // fields reported invalid
+	}{
+		{"valid", Person{ID: "socrates", Name: "Socrates", YearBirth: -470, YearDeath: -399}, nil},
+		{"missing ID and name", Person{}, []string{"id", "name"}},
+		{"uppercase ID", Person{ID: "Socrates", Name: "Socrates"}, []string{"id"}},
+		{"hyphen-led ID", Person{ID: "-sadaharu", Name: "Ō Sadaharu"}, []string{"id"}},
+		{"ID with a space", Person{ID: "isaac newton", Name: "Isaac Newton"}, []string{"id"}},
+		{"death before birth", Person{ID: "x", Name: "X", YearBirth: 1900, YearDeath: 1800}, []string{"yearDeath"}},
+		{"negative group", Person{ID: "x", Name: "X", Group: -1}, []string{"group"}},
+		{
+			"bad date",
+			Person{ID: "x", Name: "X", Birth: &HistoricalDate{Year: 1900, Precision: "week", Earliest: 1901, Latest: 1900, Month: 13}},
+			[]string{"birth.precision", "birth.earliest", "birth.month"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePerson(tt.person)
+			var fields []string
+			var ve *ValidationError
+			if errors.As(err, &ve) {
+				for _, f := range ve.Fields {
+					fields = append(fields, f.Field)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error type %T: %v", err, err)
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestValidateConnection(t *testing.T) {
+	tests := []struct {
+		name   string
+		conn   Connection
+		fields []string
+	}{
+		{"valid", Connection{Source: "socrates", Target: "plato", Type: "mentor", Strength: 9}, nil},
+		{"self link", Connection{Source: "plato", Target: "plato", Type: "mentor", Strength: 9}, []string{"target"}},
+		{"missing ends", Connection{Type: "mentor", Strength: 9}, []string{"source", "target"}},
+		{"strength out of range", Connection{Source: "a", Target: "b", Type: "friend", Strength: 11}, []string{"strength"}},
+		{"bad confidence", Connection{Source: "a", Target: "b", Type: "friend", Strength: 1, Confidence: "certain"}, []string{"confidence"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []string
+			var ve *ValidationError
+			if errors.As(ValidateConnection(tt.conn), &ve) {
+				for _, f := range ve.Fields {
+					fields = append(fields, f.Field)
+				}
+			}
+			if !reflect.DeepEqual(fields, tt.fields) {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
@@ -1,30 +1,83 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 // WikipediaService combines the scraper and NLP analyzer
 type WikipediaService struct {
-	scraper  *WikipediaScraper
-	analyzer *NLPAnalyzer
-	inProgress map[string]bool // track ongoing scraping operations
-	mu         sync.RWMutex
+	scraper       *WikipediaScraper
+	analyzer      *NLPAnalyzer
+	store         GraphStore
+	temporal      TemporalPolicy // applied to discovered connections before storing
+	crawler       *Crawler
+	crawlDefaults CrawlOptions // used for anything a crawl request leaves out
+	dumpDir       string       // dumps are imported from here
+	refresher     *Refresher
+	jobs          *JobManager
+	inProgress    map[string]bool // track ongoing scraping operations
+	mu            sync.RWMutex
 }
 
-// NewWikipediaService creates a new Wikipedia service
-func NewWikipediaService() *WikipediaService {
-	return &WikipediaService{
-		scraper:    NewWikipediaScraper(),
+// NewWikipediaService creates a new Wikipedia service that writes into the given
+// store, refreshing it on schedule while this replica holds the lease
+func NewWikipediaService(store GraphStore, cfg Config, lease Lease, jobs *JobManager) *WikipediaService {
+	scraper := NewWikipediaScraper()
+	temporal := cfg.Graph.TemporalCheck
+	ws := &WikipediaService{
+		scraper:    scraper,
+		store:      store,
+		temporal:   temporal,
+		crawler:    NewCrawler(scraper, store, temporal),
+		refresher:  NewRefresher(scraper, store, temporal, lease, 0),
+		jobs:       jobs,
 		analyzer:   NewNLPAnalyzer(),
 		inProgress: make(map[string]bool),
 	}
+	ws.Configure(cfg)
+	return ws
+}
+
+// Configure applies the wikipedia and nlp settings. It is called again
+// whenever the configuration is reloaded.
+func (ws *WikipediaService) Configure(cfg Config) {
+	ws.mu.Lock()
+	ws.dumpDir = cfg.Wikipedia.DumpDir
+	ws.crawlDefaults = CrawlOptions{
+		Seeds:      cfg.Wikipedia.SeedFigures,
+		MaxDepth:   cfg.Wikipedia.MaxDepth,
+		MaxRelated: cfg.Wikipedia.MaxRelatedPerFigure,
+	}
+	ws.mu.Unlock()
+
+	interval := time.Duration(cfg.Wikipedia.ScrapeInterval) * time.Second
+	if cfg.Wikipedia.Offline {
+		// Every figure would fail to refresh
+		interval = 0
+	}
+	ws.refresher.SetInterval(interval)
+	ws.scraper.Configure(cfg)
+	ws.analyzer.Configure(cfg.NLP)
+}
+
+// Close stops any running crawl, refresh or job so the store can be closed safely
+func (ws *WikipediaService) Close() {
+	ws.crawler.Stop()
+	ws.refresher.Stop()
+	ws.jobs.Close()
 }
 
 // SearchWikipedia handles searching for historical figures
@@ -37,7 +90,7 @@ func (ws *WikipediaService) SearchWikipedia(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Use the Wikipedia API to search for matches
-	results, err := ws.searchWikipedia(query)
+	results, err := ws.searchWikipedia(r.Context(), query)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to search Wikipedia: %v", err), http.StatusInternalServerError)
 		return
@@ -48,23 +101,12 @@ func (ws *WikipediaService) SearchWikipedia(w http.ResponseWriter, r *http.Reque
 }
 
 // searchWikipedia performs the actual search
-func (ws *WikipediaService) searchWikipedia(query string) ([]map[string]string, error) {
-	// This is a simplified implementation
-	// In a real-world scenario, you'd use Wikipedia's API for more accurate results
-	
-	url := fmt.Sprintf("https://en.wikipedia.org/w/api.php?action=opensearch&search=%s&limit=10&namespace=0&format=json",
-		strings.ReplaceAll(query, " ", "%20"))
-	
-	resp, err := http.Get(url)
+func (ws *WikipediaService) searchWikipedia(ctx context.Context, query string) ([]map[string]string, error) {
+	// Goes through the scraper's client so searches share its rate limit
+	searchResults, err := ws.scraper.api.opensearch(ctx, query, 10)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	
-	var searchResults []interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&searchResults); err != nil {
-		return nil, err
-	}
 	
 	// Extract results from the OpenSearch response
 	if len(searchResults) < 4 {
@@ -139,35 +181,41 @@ func (ws *WikipediaService) ScrapeHistoricalFigure(w http.ResponseWriter, r *htt
 	}()
 	
 	// Scrape the figure
-	person, err := ws.scraper.ScrapeHistoricalFigure(request.Name)
+	person, err := ws.scraper.ScrapeHistoricalFigure(r.Context(), request.Name)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to scrape historical figure: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to scrape historical figure: %v", err), scrapeErrorStatus(err))
 		return
 	}
 	
-	// Add to graph data
-	mu.Lock()
-	
-	// Check if person already exists
-	exists := false
-	for _, node := range graphData.Nodes {
-		if node.ID == person.ID {
-			exists = true
-			break
-		}
+	if err := ValidatePerson(*person); err != nil {
+		writeValidationError(w, err)
+		return
 	}
 	
-	if !exists {
-		graphData.Nodes = append(graphData.Nodes, *person)
+	// Add to graph data unless the person already exists
+	if err := ws.store.AddPerson(*person); err != nil && !errors.Is(err, ErrPersonExists) {
+		http.Error(w, fmt.Sprintf("Failed to store historical figure: %v", err), http.StatusInternalServerError)
+		return
 	}
 	
-	mu.Unlock()
-	
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(person)
 }
 
+// scrapeErrorStatus maps a scraping error to an HTTP status: 404 for a
+// missing article, 409 for an ambiguous name, 502 for anything else
+func scrapeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrPageNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrDisambiguation):
+		return http.StatusConflict
+	default:
+		return http.StatusBadGateway
+	}
+}
+
 // FindRelationships handles extracting relationships for a figure
 func (ws *WikipediaService) FindRelationships(w http.ResponseWriter, r *http.Request) {
 	// Get person ID from URL
@@ -180,37 +228,25 @@ func (ws *WikipediaService) FindRelationships(w http.ResponseWriter, r *http.Req
 	}
 	
 	// Find relationships
-	connections, err := ws.scraper.FindRelationships(id)
+	connections, err := ws.scraper.FindRelationships(r.Context(), id)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to find relationships: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to find relationships: %v", err), scrapeErrorStatus(err))
 		return
 	}
 	
-	// Add new connections to graph data
-	mu.Lock()
-	
-	// Check for existing connections to avoid duplicates
-	for _, conn := range connections {
-		exists := false
-		for _, existingConn := range graphData.Links {
-			if existingConn.Source == conn.Source && existingConn.Target == conn.Target {
-				exists = true
-				break
-			}
-		}
-		
-		if !exists {
-			graphData.Links = append(graphData.Links, conn)
-		}
-	}
+	// Drop or flag relationships the lifespans rule out
+	connections = ws.temporal.filter(ws.store, connections)
 	
-	mu.Unlock()
+	// Add new connections to graph data
+	storeConnections(ws.store, connections)
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(connections)
 }
 
-// BatchScrape handles scraping multiple historical figures
+// BatchScrape handles scraping multiple historical figures. The work is done
+// by a background job; the response is the queued job, whose progress can be
+// followed at /api/jobs/{id}.
 func (ws *WikipediaService) BatchScrape(w http.ResponseWriter, r *http.Request) {
 	// Parse request body to get names
 	var request struct {
@@ -222,14 +258,85 @@ func (ws *WikipediaService) BatchScrape(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	
-	if len(request.Names) == 0 {
+	var names []string
+	for _, name := range request.Names {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
 		http.Error(w, "At least one name is required", http.StatusBadRequest)
 		return
 	}
 	
+	job, err := ws.jobs.Start("batch-scrape", names, func(ctx context.Context, update func(func(*Job))) error {
+		return ws.batchScrape(ctx, names, update)
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to start job: %v", err), http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// ImportDump handles building people and relationships from a MediaWiki XML
+// dump in the dump directory instead of from Wikipedia. Like a batch scrape,
+// the work is done by a background job.
+func (ws *WikipediaService) ImportDump(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		File  string   `json:"file"`  // relative to the dump directory
+		Names []string `json:"names"` // only import these; all biographies if empty
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	if !filepath.IsLocal(request.File) {
+		http.Error(w, "A file within the dump directory is required", http.StatusBadRequest)
+		return
+	}
+
+	ws.mu.RLock()
+	path := filepath.Join(ws.dumpDir, request.File)
+	ws.mu.RUnlock()
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		http.Error(w, fmt.Sprintf("Dump %s not found", request.File), http.StatusNotFound)
+		return
+	}
+
+	var names []string
+	for _, name := range request.Names {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	job, err := ws.jobs.Start("dump-import", names, func(ctx context.Context, update func(func(*Job))) error {
+		return ws.importDump(ctx, path, names, update)
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to start job: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// batchScrape scrapes the names on the scraper's worker pool, then finds
+// the relationships of everyone scraped. Relationships come last so that
+// text analysis can recognize everyone in the batch.
+func (ws *WikipediaService) batchScrape(ctx context.Context, names []string, update func(func(*Job))) error {
 	// Flag in-progress names
 	ws.mu.Lock()
-	for _, name := range request.Names {
+	for _, name := range names {
 		ws.inProgress[name] = true
 	}
 	ws.mu.Unlock()
@@ -237,84 +344,253 @@ func (ws *WikipediaService) BatchScrape(w http.ResponseWriter, r *http.Request)
 	// Ensure we mark as no longer in progress when done
 	defer func() {
 		ws.mu.Lock()
-		for _, name := range request.Names {
+		for _, name := range names {
 			delete(ws.inProgress, name)
 		}
 		ws.mu.Unlock()
 	}()
 	
-	// Scrape the figures
-	people, err := ws.scraper.BatchScrapeHistoricalFigures(request.Names)
+	scraped := make([]*Person, len(names))
+	err := ws.scraper.each(ctx, len(names), func(i int) {
+		name := names[i]
+		update(func(job *Job) { job.Items[i].State = JobRunning })
+		
+		person, err := ws.scraper.ScrapeHistoricalFigure(ctx, name)
+		if err == nil {
+			err = ValidatePerson(*person)
+		}
+		reason := failureReason(err)
+		if err == nil {
+			// People already in the graph still have their relationships found
+			if err = ws.store.AddPerson(*person); errors.Is(err, ErrPersonExists) {
+				err = nil
+			}
+			reason = ReasonStorage
+		}
+		if err != nil {
+			log.Printf("Error scraping %s: %v", name, err)
+			update(func(job *Job) {
+				job.Items[i].State = JobFailed
+				job.Items[i].Error = err.Error()
+				job.Items[i].Reason = reason
+			})
+		} else {
+			scraped[i] = person
+			update(func(job *Job) { job.Items[i].Person = person })
+		}
+	})
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Some scraping operations failed: %v", err), http.StatusInternalServerError)
-		// Continue with partial results
+		return err
 	}
 	
-	// Add to graph data
-	mu.Lock()
-	
-	for _, person := range people {
-		// Check if person already exists
-		exists := false
-		for _, node := range graphData.Nodes {
-			if node.ID == person.ID {
-				exists = true
-				break
-			}
+	return ws.scraper.each(ctx, len(names), func(i int) {
+		person := scraped[i]
+		if person == nil {
+			return
 		}
 		
-		if !exists {
-			graphData.Nodes = append(graphData.Nodes, *person)
+		connections, err := ws.scraper.relationships(ctx, person.ID, person.Name)
+		if err != nil {
+			log.Printf("Error finding relationships for %s: %v", person.ID, err)
+			update(func(job *Job) {
+				job.Items[i].State = JobFailed
+				job.Items[i].Error = fmt.Sprintf("finding relationships: %v", err)
+				job.Items[i].Reason = failureReason(err)
+			})
+		} else {
+			// Drop or flag relationships the lifespans rule out
+			added := storeConnections(ws.store, ws.temporal.filter(ws.store, connections))
+			update(func(job *Job) {
+				job.Items[i].State = JobDone
+				job.Items[i].Connections = len(added)
+				job.Connections = append(job.Connections, added...)
+			})
 		}
+	})
+}
+
+// ListJobs handles listing background jobs, most recent first
+func (ws *WikipediaService) ListJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := ws.jobs.List()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list jobs: %v", err), http.StatusInternalServerError)
+		return
 	}
 	
-	mu.Unlock()
-	
-	// Extract person IDs for relationship analysis
-	var personIDs []string
-	for _, person := range people {
-		personIDs = append(personIDs, person.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// GetJob handles reporting the progress of a background job
+func (ws *WikipediaService) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := ws.jobs.Get(mux.Vars(r)["id"])
+	if errors.Is(err, ErrJobNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read job: %v", err), http.StatusInternalServerError)
+		return
 	}
 	
-	// Find relationships
-	connections, err := ws.scraper.BatchFindRelationships(personIDs)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// GetJobResults handles reporting the outcome of each name in a batch job as
+// a multi-status document. The response is 207 Multi-Status once the job has
+// finished with any failures, 200 if every name succeeded and 202 while the
+// job is still running.
+func (ws *WikipediaService) GetJobResults(w http.ResponseWriter, r *http.Request) {
+	job, err := ws.jobs.Get(mux.Vars(r)["id"])
+	if errors.Is(err, ErrJobNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		// Log error but continue with partial results
-		fmt.Printf("Some relationship analyses failed: %v\n", err)
+		http.Error(w, fmt.Sprintf("Failed to read job: %v", err), http.StatusInternalServerError)
+		return
 	}
 	
-	// Add new connections to graph data
-	mu.Lock()
+	results, status := jobResults(job)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(results)
+}
+
+// CancelJob handles canceling a queued or running background job
+func (ws *WikipediaService) CancelJob(w http.ResponseWriter, r *http.Request) {
+	job, err := ws.jobs.Cancel(mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, ErrJobFinished), errors.Is(err, ErrJobElsewhere):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, fmt.Sprintf("Failed to cancel job: %v", err), http.StatusInternalServerError)
+		return
+	}
 	
-	// Check for existing connections to avoid duplicates
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// storeConnections adds connections to the graph, skipping duplicates,
+// invalid connections and connections whose endpoints are not in the graph.
+// It returns the connections that were added.
+func storeConnections(store GraphStore, connections []Connection) []Connection {
+	var added []Connection
 	for _, conn := range connections {
-		exists := false
-		for _, existingConn := range graphData.Links {
-			if existingConn.Source == conn.Source && existingConn.Target == conn.Target {
-				exists = true
-				break
-			}
+		if err := ValidateConnection(conn); err != nil {
+			log.Printf("Skipping connection %s -> %s: %v", conn.Source, conn.Target, err)
+			continue
 		}
-		
-		if !exists {
-			graphData.Links = append(graphData.Links, conn)
+		stored, err := store.AddConnection(conn)
+		if err == nil {
+			added = append(added, stored)
+		} else if !errors.Is(err, ErrConnectionExists) {
+			log.Printf("Skipping connection %s -> %s: %v", conn.Source, conn.Target, err)
 		}
 	}
+	return added
+}
+
+// StartCrawl handles starting a recursive crawl from seed figures. Seeds,
+// maxDepth and maxRelated default to the server's configuration.
+func (ws *WikipediaService) StartCrawl(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Seeds      []string `json:"seeds"`
+		MaxDepth   *int     `json:"maxDepth"`
+		MaxRelated *int     `json:"maxRelated"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		return
+	}
+	
+	ws.mu.RLock()
+	opts := ws.crawlDefaults
+	ws.mu.RUnlock()
+	if len(request.Seeds) > 0 {
+		opts.Seeds = request.Seeds
+	}
+	if request.MaxDepth != nil {
+		opts.MaxDepth = *request.MaxDepth
+	}
+	if request.MaxRelated != nil {
+		opts.MaxRelated = *request.MaxRelated
+	}
 	
-	mu.Unlock()
+	status, err := ws.crawler.Start(opts)
+	if errors.Is(err, ErrCrawlRunning) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	
-	// Create response
-	response := struct {
-		People      []*Person     `json:"people"`
-		Connections []Connection `json:"connections"`
-	}{
-		People:      people,
-		Connections: connections,
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(status)
+}
+
+// GetCrawlStatus handles reporting the progress of the current or last crawl
+func (ws *WikipediaService) GetCrawlStatus(w http.ResponseWriter, r *http.Request) {
+	status, ok := ws.crawler.Status()
+	if !ok {
+		http.Error(w, "No crawl has been started", http.StatusNotFound)
+		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(status)
+}
+
+// TriggerRefresh handles starting a refresh of everyone in the graph now
+func (ws *WikipediaService) TriggerRefresh(w http.ResponseWriter, r *http.Request) {
+	run, err := ws.refresher.Trigger(TriggerManual)
+	if errors.Is(err, ErrRefreshRunning) || errors.Is(err, ErrNotLeader) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(run)
+}
+
+// GetRefreshStatus handles reporting the refresh schedule and recent runs
+func (ws *WikipediaService) GetRefreshStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws.refresher.Status())
+}
+
+// GetCacheStats handles reporting the page cache's size and hit rates
+func (ws *WikipediaService) GetCacheStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ws.scraper.cache.Stats())
+}
+
+// PurgeCache handles removing cached pages: those about the title given in
+// the query string, or all of them
+func (ws *WikipediaService) PurgeCache(w http.ResponseWriter, r *http.Request) {
+	purged, err := ws.scraper.cache.Purge(r.URL.Query().Get("title"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to purge cache: %v", err), http.StatusInternalServerError)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"purged": purged})
 }
 
 // ExtractEntitiesFromText handles extracting named entities from text
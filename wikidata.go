@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// wikidataEndpoint is the Action API of Wikidata
+	wikidataEndpoint = "https://www.wikidata.org/w/api.php"
+	// maxEntitiesPerRequest is the most IDs wbgetentities accepts at once
+	maxEntitiesPerRequest = 50
+)
+
+// Wikidata properties read when enriching a person
+const (
+	PropBirthDate       = "P569"
+	PropDeathDate       = "P570"
+	PropFloruit         = "P1317"
+	PropCitizenship     = "P27"
+	PropOccupation      = "P106"
+	PropImage           = "P18"
+	PropStudentOf       = "P1066"
+	PropDoctoralAdvisor = "P184"
+	PropInfluencedBy    = "P737"
+	PropSpouse          = "P26"
+	PropInstanceOf      = "P31"
+	PropSourcing        = "P1480" // sourcing circumstances qualifier, e.g. "circa"
+)
+
+// Wikidata items compared against claim values
+const (
+	itemHuman             = "Q5"
+	itemCirca             = "Q5727902"
+	itemJulianCalendar    = "Q1985786"
+	itemGregorianCalendar = "Q1985727"
+)
+
+// wikidataRelation describes how a relationship property becomes a connection
+type wikidataRelation struct {
+	Type     string
+	Strength int
+	Reverse  bool // the claimed item is the source rather than the target
+	Label    string
+}
+
+// wikidataRelations maps relationship properties to connections. A claim on
+// person X with value Y reads "X <property> Y".
+var wikidataRelations = map[string]wikidataRelation{
+	PropStudentOf:       {Type: "student", Strength: 8, Label: "student of"},
+	PropDoctoralAdvisor: {Type: "student", Strength: 9, Label: "doctoral advisor"},
+	PropInfluencedBy:    {Type: "influenced", Strength: 7, Reverse: true, Label: "influenced by"},
+	PropSpouse:          {Type: "spouse", Strength: 9, Label: "spouse"},
+}
+
+// WikidataFacts are the structured claims about a person on Wikidata
+type WikidataFacts struct {
+	QID          string
+	Label        string // English name of the item
+	Birth        *HistoricalDate
+	Death        *HistoricalDate
+	Floruit      *HistoricalDate
+	Citizenships []string // labels, preferred first
+	Occupations  []string
+	ImageURL     string
+	Relations    []WikidataLink
+}
+
+// WikidataLink is a relationship claim to another item
+type WikidataLink struct {
+	Property string
+	QID      string
+	Title    string // English Wikipedia title, empty if the item has no article
+	Label    string
+}
+
+// WikidataClient talks to the Wikidata API
+type WikidataClient struct {
+	client   *http.Client
+	endpoint string
+}
+
+// NewWikidataClient creates a Wikidata client
+func NewWikidataClient(client *http.Client) *WikidataClient {
+	return &WikidataClient{client: client, endpoint: wikidataEndpoint}
+}
+
+type wdEntity struct {
+	ID      string  `json:"id"`
+	Missing *string `json:"missing"`
+	Labels  map[string]struct {
+		Value string `json:"value"`
+	} `json:"labels"`
+	Sitelinks map[string]struct {
+		Title string `json:"title"`
+	} `json:"sitelinks"`
+	Claims map[string][]wdClaim `json:"claims"`
+}
+
+type wdClaim struct {
+	Mainsnak   wdSnak              `json:"mainsnak"`
+	Rank       string              `json:"rank"`
+	Qualifiers map[string][]wdSnak `json:"qualifiers"`
+}
+
+type wdSnak struct {
+	SnakType  string `json:"snaktype"`
+	DataValue struct {
+		Type  string          `json:"type"`
+		Value json.RawMessage `json:"value"`
+	} `json:"datavalue"`
+}
+
+// item returns the ID of an item-valued snak, or ""
+func (s wdSnak) item() string {
+	var value struct {
+		ID string `json:"id"`
+	}
+	if s.SnakType != "value" || s.DataValue.Type != "wikibase-entityid" {
+		return ""
+	}
+	json.Unmarshal(s.DataValue.Value, &value)
+	return value.ID
+}
+
+// text returns the value of a string-valued snak, or ""
+func (s wdSnak) text() string {
+	var value string
+	if s.SnakType != "value" || s.DataValue.Type != "string" {
+		return ""
+	}
+	json.Unmarshal(s.DataValue.Value, &value)
+	return value
+}
+
+// date converts a time-valued snak into a HistoricalDate
+func (s wdSnak) date() (HistoricalDate, bool) {
+	var value struct {
+		Time          string `json:"time"`
+		Precision     int    `json:"precision"`
+		CalendarModel string `json:"calendarmodel"`
+	}
+	if s.SnakType != "value" || s.DataValue.Type != "time" {
+		return HistoricalDate{}, false
+	}
+	if err := json.Unmarshal(s.DataValue.Value, &value); err != nil {
+		return HistoricalDate{}, false
+	}
+	return wikidataDate(value.Time, value.Precision, value.CalendarModel)
+}
+
+// wikidataDate converts a Wikidata time such as "+1879-03-14T00:00:00Z".
+// Wikidata numbers years historically, so -0470 is 470 BCE and there is no
+// year 0. Precision is 11 for a day, 10 month, 9 year, 8 decade and 7
+// century; anything vaguer is ignored.
+func wikidataDate(value string, precision int, calendarModel string) (HistoricalDate, bool) {
+	sign := 1
+	if strings.HasPrefix(value, "-") {
+		sign = -1
+	}
+	fields := strings.SplitN(strings.TrimLeft(value, "+-"), "-", 3)
+	if len(fields) < 3 {
+		return HistoricalDate{}, false
+	}
+	year, err := strconv.Atoi(fields[0])
+	if err != nil || year == 0 {
+		return HistoricalDate{}, false
+	}
+	month, _ := strconv.Atoi(fields[1])
+	day, _ := strconv.Atoi(fields[2][:min(2, len(fields[2]))])
+
+	d := HistoricalDate{Year: sign * year}
+	switch precision {
+	case 11:
+		d.Precision, d.Month, d.Day = PrecisionDay, month, day
+	case 10:
+		d.Precision, d.Month = PrecisionMonth, month
+	case 9:
+		d.Precision = PrecisionYear
+	case 8:
+		// The 1870s run from 1870 to 1879; the 470s BC from 479 to 470 BC
+		d.Precision = PrecisionDecade
+		decade := year / 10 * 10
+		d.Earliest, d.Latest = decade, decade+9
+		if sign < 0 {
+			d.Earliest, d.Latest = -(decade + 9), -decade
+		}
+	case 7:
+		// The 19th century runs from 1801 to 1900
+		d.Precision = PrecisionCentury
+		century := (year-1)/100 + 1
+		d.Earliest, d.Latest = (century-1)*100+1, century*100
+		if sign < 0 {
+			d.Earliest, d.Latest = -century*100, -((century-1)*100 + 1)
+		}
+	default:
+		return HistoricalDate{}, false
+	}
+	if d.Earliest == 0 && d.Latest == 0 {
+		d.Earliest, d.Latest = d.Year, d.Year
+	} else {
+		d.Year = d.Earliest + (d.Latest-d.Earliest)/2
+	}
+
+	switch strings.TrimPrefix(calendarModel, "http://www.wikidata.org/entity/") {
+	case itemJulianCalendar:
+		d.Calendar = CalendarJulian
+	case itemGregorianCalendar:
+		d.Calendar = CalendarGregorian
+	}
+	return d, true
+}
+
+// get runs an API request and decodes the JSON response into out
+func (wc *WikidataClient) get(ctx context.Context, params url.Values, out any) error {
+	params.Set("format", "json")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wc.endpoint+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := wc.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error making request to Wikidata: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w from Wikidata: %d", ErrUnexpectedStatus, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("error decoding Wikidata response: %w", err)
+	}
+	return nil
+}
+
+// entities runs a wbgetentities request
+func (wc *WikidataClient) entities(ctx context.Context, params url.Values) (map[string]wdEntity, error) {
+	var result struct {
+		Entities map[string]wdEntity `json:"entities"`
+		Error    *struct {
+			Code string `json:"code"`
+			Info string `json:"info"`
+		} `json:"error"`
+	}
+	params.Set("action", "wbgetentities")
+	if err := wc.get(ctx, params, &result); err != nil {
+		return nil, err
+	}
+	if result.Error != nil {
+		return nil, fmt.Errorf("Wikidata API error %s: %s", result.Error.Code, result.Error.Info)
+	}
+	return result.Entities, nil
+}
+
+// Resolve returns the QID of the item for an English Wikipedia article
+func (wc *WikidataClient) Resolve(ctx context.Context, title string) (string, error) {
+	entities, err := wc.entities(ctx, url.Values{
+		"sites":     {"enwiki"},
+		"titles":    {title},
+		"normalize": {"1"},
+		"props":     {"info"},
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, entity := range entities {
+		if entity.Missing == nil && entity.ID != "" {
+			return entity.ID, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no Wikidata item for %s", ErrPageNotFound, title)
+}
+
+// Facts fetches the claims about a person and resolves the items they refer
+// to into English labels and Wikipedia titles
+func (wc *WikidataClient) Facts(ctx context.Context, qid string) (*WikidataFacts, error) {
+	entities, err := wc.entities(ctx, url.Values{"ids": {qid}, "props": {"claims|labels"}, "languages": {"en"}})
+	if err != nil {
+		return nil, err
+	}
+	entity, ok := entities[qid]
+	if !ok || entity.Missing != nil {
+		return nil, fmt.Errorf("%w: Wikidata item %s", ErrPageNotFound, qid)
+	}
+
+	facts := &WikidataFacts{QID: qid, Label: entity.Labels["en"].Value}
+	if date, ok := firstDate(entity.Claims[PropBirthDate]); ok {
+		facts.Birth = &date
+	}
+	if date, ok := firstDate(entity.Claims[PropDeathDate]); ok {
+		facts.Death = &date
+	}
+	if date, ok := firstDate(entity.Claims[PropFloruit]); ok {
+		date.Floruit = true
+		facts.Floruit = &date
+	}
+	for _, claim := range rankedClaims(entity.Claims[PropImage]) {
+		if file := claim.Mainsnak.text(); file != "" {
+			facts.ImageURL = commonsFileURL(file)
+			break
+		}
+	}
+
+	// Collect every referenced item so they can be looked up together
+	var ids []string
+	seen := map[string]bool{}
+	itemsOf := func(property string) []string {
+		var items []string
+		for _, claim := range rankedClaims(entity.Claims[property]) {
+			if id := claim.Mainsnak.item(); id != "" {
+				items = append(items, id)
+				if !seen[id] {
+					seen[id] = true
+					ids = append(ids, id)
+				}
+			}
+		}
+		return items
+	}
+	citizenships := itemsOf(PropCitizenship)
+	occupations := itemsOf(PropOccupation)
+	related := map[string][]string{}
+	for property := range wikidataRelations {
+		related[property] = itemsOf(property)
+	}
+
+	referenced, err := wc.lookup(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	label := func(id string) string {
+		return referenced[id].Labels["en"].Value
+	}
+
+	for _, id := range citizenships {
+		if l := label(id); l != "" {
+			facts.Citizenships = append(facts.Citizenships, l)
+		}
+	}
+	for _, id := range occupations {
+		if l := label(id); l != "" {
+			facts.Occupations = append(facts.Occupations, l)
+		}
+	}
+	for _, property := range []string{PropStudentOf, PropDoctoralAdvisor, PropInfluencedBy, PropSpouse} {
+		for _, id := range related[property] {
+			facts.Relations = append(facts.Relations, WikidataLink{
+				Property: property,
+				QID:      id,
+				Title:    referenced[id].Sitelinks["enwiki"].Title,
+				Label:    label(id),
+			})
+		}
+	}
+	return facts, nil
+}
+
+// IsHuman reports whether an item is an instance of human (Q5)
+func (wc *WikidataClient) IsHuman(ctx context.Context, qid string) (bool, error) {
+	var result struct {
+		Claims map[string][]wdClaim `json:"claims"`
+		Error  *struct {
+			Code string `json:"code"`
+			Info string `json:"info"`
+		} `json:"error"`
+	}
+	err := wc.get(ctx, url.Values{"action": {"wbgetclaims"}, "entity": {qid}, "property": {PropInstanceOf}}, &result)
+	if err != nil {
+		return false, err
+	}
+	if result.Error != nil {
+		return false, fmt.Errorf("Wikidata API error %s: %s", result.Error.Code, result.Error.Info)
+	}
+	for _, claim := range result.Claims[PropInstanceOf] {
+		if claim.Mainsnak.item() == itemHuman {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// lookup fetches the English labels and Wikipedia titles of items
+func (wc *WikidataClient) lookup(ctx context.Context, ids []string) (map[string]wdEntity, error) {
+	found := make(map[string]wdEntity, len(ids))
+	for start := 0; start < len(ids); start += maxEntitiesPerRequest {
+		end := min(start+maxEntitiesPerRequest, len(ids))
+		entities, err := wc.entities(ctx, url.Values{
+			"ids":        {strings.Join(ids[start:end], "|")},
+			"props":      {"labels|sitelinks"},
+			"languages":  {"en"},
+			"sitefilter": {"enwiki"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for id, entity := range entities {
+			found[id] = entity
+		}
+	}
+	return found, nil
+}
+
+// rankedClaims drops deprecated claims and puts preferred ones first
+func rankedClaims(claims []wdClaim) []wdClaim {
+	var preferred, normal []wdClaim
+	for _, claim := range claims {
+		switch claim.Rank {
+		case "preferred":
+			preferred = append(preferred, claim)
+		case "deprecated":
+		default:
+			normal = append(normal, claim)
+		}
+	}
+	return append(preferred, normal...)
+}
+
+// firstDate returns the best-ranked date claim, marked circa if qualified so
+func firstDate(claims []wdClaim) (HistoricalDate, bool) {
+	for _, claim := range rankedClaims(claims) {
+		date, ok := claim.Mainsnak.date()
+		if !ok {
+			continue
+		}
+		for _, qualifier := range claim.Qualifiers[PropSourcing] {
+			if qualifier.item() == itemCirca {
+				date.Circa = true
+				date.Earliest, date.Latest = addYears(date.Earliest, -circaMargin), addYears(date.Latest, circaMargin)
+			}
+		}
+		return date, true
+	}
+	return HistoricalDate{}, false
+}
+
+// commonsFileURL links to a Wikimedia Commons file by name
+func commonsFileURL(file string) string {
+	return "https://commons.wikimedia.org/wiki/Special:FilePath/" + url.PathEscape(strings.ReplaceAll(file, " ", "_"))
+}
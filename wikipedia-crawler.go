@@ -1,55 +1,233 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/PuerkitoBio/goquery"
 )
 
 type WikipediaScraper struct {
-	client     *http.Client
-	knownNames map[string]bool
-	mu         sync.RWMutex
+	client      *http.Client
+	api         *MediaWikiClient
+	wikidata    *WikidataClient
+	limiter     *RateLimiter // shared by every request the client sends
+	cache       *PageCache   // answers repeated requests before they reach the limiter
+	offline     *offlineTransport
+	knownNames  nameIndex // lowercased names recognized when analyzing articles
+	minStrength int       // inferred relationships weaker than this are dropped
+	workers     int       // figures processed at once by batch operations
+	mu          sync.RWMutex
 }
 
 func NewWikipediaScraper() *WikipediaScraper {
+	defaults := DefaultConfig().Wikipedia
+	limiter := NewRateLimiter(defaults.RequestsPerSecond)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 30 * time.Second
+	offline := &offlineTransport{next: &throttledTransport{base: transport, limiter: limiter}}
+	cache := NewPageCache(offline)
+	client := &http.Client{
+		// Long enough to wait out the limiter and a few retries
+		Timeout:   2 * time.Minute,
+		Transport: cache,
+	}
 	return &WikipediaScraper{
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		knownNames: make(map[string]bool),
+		client:     client,
+		api:        NewMediaWikiClient(client),
+		wikidata:   NewWikidataClient(client),
+		limiter:    limiter,
+		cache:      cache,
+		offline:    offline,
+		knownNames: nameIndex{},
+		workers:    defaults.Workers,
 	}
 }
 
-// ScrapeHistoricalFigure scrapes Wikipedia for info about a historical figure
-func (ws *WikipediaScraper) ScrapeHistoricalFigure(name string) (*Person, error) {
-	// Format name for URL
-	formattedName := strings.ReplaceAll(name, " ", "_")
-	url := fmt.Sprintf("https://en.wikipedia.org/wiki/%s", formattedName)
+// Configure applies the wikipedia, nlp and api cache settings
+func (ws *WikipediaScraper) Configure(cfg Config) {
+	ws.offline.enabled.Store(cfg.Wikipedia.Offline)
+	ws.limiter.SetRate(cfg.Wikipedia.RequestsPerSecond)
+	ws.cache.Configure(cfg.API)
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.workers = cfg.Wikipedia.Workers
+	ws.minStrength = cfg.NLP.MinRelationshipStrength
+}
 
-	// Make request to Wikipedia
-	resp, err := ws.client.Get(url)
+// each calls fn for 0 <= i < n on the configured number of workers,
+// stopping early once ctx is canceled
+func (ws *WikipediaScraper) each(ctx context.Context, n int, fn func(i int)) error {
+	ws.mu.RLock()
+	workers := ws.workers
+	ws.mu.RUnlock()
+	return forEach(ctx, workers, n, fn)
+}
+
+// ScrapeHistoricalFigure looks up a historical figure on Wikipedia, using the
+// MediaWiki API and falling back to the rendered article if the API fails.
+// Missing and disambiguation pages are reported as ErrPageNotFound and
+// ErrDisambiguation rather than retried. Canceling ctx abandons the requests,
+// including any wait for the rate limiter.
+func (ws *WikipediaScraper) ScrapeHistoricalFigure(ctx context.Context, name string) (*Person, error) {
+	person, _, err := ws.scrape(ctx, name)
+	return person, err
+}
+
+// scrape looks up a historical figure and also returns the titles of the
+// articles their page links to, most relevant first: people related to them
+// on Wikidata, then links from the lead section in order of appearance
+func (ws *WikipediaScraper) scrape(ctx context.Context, name string) (*Person, []string, error) {
+	person, related, err := ws.scrapeFromAPI(ctx, name)
+	// A canceled job has no time to fall back to the rendered article either
+	if errors.Is(err, ErrPageNotFound) || errors.Is(err, ErrDisambiguation) || errors.Is(err, ErrOffline) || (err != nil && ctx.Err() != nil) {
+		return nil, nil, err
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error making request to Wikipedia: %w", err)
+		log.Printf("MediaWiki API failed for %s, falling back to HTML: %v", name, err)
+		if person, related, err = ws.scrapeFromHTML(ctx, name); err != nil {
+			return nil, nil, err
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	ws.register(person)
+	return person, related, nil
+}
+
+// register gives a newly scraped person a default group and adds them to the
+// names recognized when analyzing articles
+func (ws *WikipediaScraper) register(person *Person) {
+	// Set a default group based on era/profession (can be refined later)
+	person.Group = determineGroup(person.Era, person.Profession)
+
+	ws.addName(person.Name)
+}
+
+// addName adds a name to those recognized when analyzing articles
+func (ws *WikipediaScraper) addName(name string) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.knownNames.add(strings.ToLower(name))
+}
+
+// scrapeFromAPI builds a person from the article's infobox and lead section,
+// then applies Wikidata's claims. Redirects are followed, so the person is
+// named after the article.
+func (ws *WikipediaScraper) scrapeFromAPI(ctx context.Context, name string) (*Person, []string, error) {
+	page, err := ws.api.Page(ctx, name)
+	if err != nil {
+		return nil, nil, err
 	}
+	person := personFromPage(page)
 
-	// Parse HTML using goquery
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	// Structured claims are more reliable than anything parsed from the article
+	var related []string
+	if page.WikidataID != "" {
+		facts, err := ws.wikidata.Facts(ctx, page.WikidataID)
+		if err != nil {
+			log.Printf("Wikidata lookup failed for %s: %v", page.Title, err)
+		} else {
+			applyWikidataFacts(person, facts)
+			for _, link := range facts.Relations {
+				if link.Title != "" {
+					related = append(related, link.Title)
+				}
+			}
+		}
+	}
+	return person, append(related, page.Links...), nil
+}
+
+// personFromPage builds a person from an article's infobox and lead section
+func personFromPage(page *WikiPage) *Person {
+	person := &Person{
+		ID:       createIDFromName(page.Title),
+		Name:     page.Title,
+		ImageURL: page.ImageURL,
+	}
+	opening := firstLine(page.Extract)
+
+	birth, _ := LeadingDate(page.Infobox["birth_date"])
+	death, _ := LeadingDate(page.Infobox["death_date"])
+	if birth.IsZero() && death.IsZero() {
+		if floruit, ok := LeadingDate(page.Infobox["floruit"]); ok {
+			floruit.Floruit = true
+			birth = floruit
+		}
+	}
+	setLifespan(person, birth, death, opening)
+
+	person.Profession = findProfession(opening)
+	if person.Profession == "" {
+		occupation := strings.TrimSpace(strings.Split(page.Infobox["occupation"], ",")[0])
+		person.Profession = strings.Title(occupation)
+	}
+	if person.Profession == "" {
+		person.Profession = "Historical Figure"
+	}
+	setEra(person)
+
+	for _, field := range []string{"nationality", "citizenship", "country"} {
+		if value := page.Infobox[field]; value != "" {
+			// Lists of citizenships are usually chronological; take the first
+			value = parentheticalPattern.ReplaceAllString(value, "")
+			person.Country = strings.TrimSpace(strings.Split(value, ",")[0])
+			break
+		}
+	}
+	if place := page.Infobox["birth_place"]; person.Country == "" && place != "" {
+		// Places are written from specific to general, so the country comes last
+		parts := strings.Split(place, ",")
+		person.Country = strings.TrimSpace(parts[len(parts)-1])
+	}
+	if person.Country == "" {
+		person.Country = "Unknown"
+	}
+
+	person.Info = truncateBio(cleanText(opening))
+	return person
+}
+
+// applyWikidataFacts overrides a person's dates, country and profession with
+// Wikidata claims where there are any, and fills in a missing image
+func applyWikidataFacts(person *Person, facts *WikidataFacts) {
+	if facts.Birth != nil {
+		person.Birth = facts.Birth
+	}
+	if facts.Death != nil {
+		person.Death = facts.Death
+	}
+	if facts.Floruit != nil {
+		person.Floruit = facts.Floruit
+	}
+	person.normalizeDates()
+	setEra(person)
+	if len(facts.Citizenships) > 0 {
+		person.Country = facts.Citizenships[0]
+	}
+	if len(facts.Occupations) > 0 {
+		person.Profession = strings.Title(facts.Occupations[0])
+	}
+	if person.ImageURL == "" {
+		person.ImageURL = facts.ImageURL
+	}
+}
+
+// scrapeFromHTML builds a person from the rendered article
+func (ws *WikipediaScraper) scrapeFromHTML(ctx context.Context, name string) (*Person, []string, error) {
+	doc, err := ws.fetchArticle(ctx, name)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing HTML: %w", err)
+		return nil, nil, err
 	}
 
 	// Extract basic information
@@ -70,32 +248,55 @@ func (ws *WikipediaScraper) ScrapeHistoricalFigure(name string) (*Person, error)
 	// Extract biographical information
 	ws.extractBio(doc, person)
 
-	// Set a default group based on era/profession (can be refined later)
-	person.Group = determineGroup(person.Era, person.Profession)
-
-	// Add this person to known names
-	ws.mu.Lock()
-	ws.knownNames[strings.ToLower(name)] = true
-	ws.mu.Unlock()
+	return person, leadLinks(doc), nil
+}
 
-	return person, nil
+// leadLinks lists the articles linked from the infobox and the paragraphs
+// before the first heading, in order of appearance
+func leadLinks(doc *goquery.Document) []string {
+	var links []string
+	seen := map[string]bool{}
+	doc.Find("#mw-content-text .mw-parser-output").First().Children().EachWithBreak(func(i int, s *goquery.Selection) bool {
+		if goquery.NodeName(s) == "h2" || s.HasClass("mw-heading") {
+			return false
+		}
+		if goquery.NodeName(s) != "p" && !s.HasClass("infobox") {
+			return true
+		}
+		s.Find(`a[href^="/wiki/"]`).Each(func(i int, a *goquery.Selection) {
+			title := a.AttrOr("title", "")
+			if title != "" && !strings.Contains(title, ":") && !seen[title] {
+				seen[title] = true
+				links = append(links, title)
+			}
+		})
+		return true
+	})
+	return links
 }
 
-// FindRelationships analyzes a Wikipedia page to find relationships with other historical figures
-func (ws *WikipediaScraper) FindRelationships(personID string) ([]Connection, error) {
-	// Get the person's name from ID
-	formattedName := strings.ReplaceAll(personID, "-", " ")
-	url := fmt.Sprintf("https://en.wikipedia.org/wiki/%s", strings.ReplaceAll(formattedName, " ", "_"))
+// fetchArticle downloads and parses the rendered article with the given title
+func (ws *WikipediaScraper) fetchArticle(ctx context.Context, title string) (*goquery.Document, error) {
+	url := fmt.Sprintf("https://en.wikipedia.org/wiki/%s", strings.ReplaceAll(title, " ", "_"))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
 
 	// Make request to Wikipedia
-	resp, err := ws.client.Get(url)
+	resp, err := ws.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("error making request to Wikipedia: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrPageNotFound, title)
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, fmt.Errorf("%w: %d", ErrUnexpectedStatus, resp.StatusCode)
 	}
 
 	// Parse HTML using goquery
@@ -103,24 +304,109 @@ func (ws *WikipediaScraper) FindRelationships(personID string) ([]Connection, er
 	if err != nil {
 		return nil, fmt.Errorf("error parsing HTML: %w", err)
 	}
+	return doc, nil
+}
 
-	// Extract content paragraphs
-	content := ws.extractContent(doc)
+// FindRelationships finds relationships with other historical figures: typed,
+// high-confidence connections from Wikidata claims, plus low-confidence ones
+// inferred from the article text for anyone Wikidata says nothing about
+func (ws *WikipediaScraper) FindRelationships(ctx context.Context, personID string) ([]Connection, error) {
+	// Get the person's name from ID
+	return ws.relationships(ctx, personID, strings.ReplaceAll(personID, "-", " "))
+}
+
+// relationships finds the relationships described in the article with the
+// given title, for the person with the given ID
+func (ws *WikipediaScraper) relationships(ctx context.Context, personID, title string) ([]Connection, error) {
+	content, err := ws.api.Text(ctx, title)
+	if errors.Is(err, ErrPageNotFound) || errors.Is(err, ErrOffline) || (err != nil && ctx.Err() != nil) {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("MediaWiki API failed for %s, falling back to HTML: %v", title, err)
+		doc, err := ws.fetchArticle(ctx, title)
+		if err != nil {
+			return nil, err
+		}
+		content = ws.extractContent(doc)
+	}
 
 	// Find relationships
-	return ws.analyzeRelationships(personID, content)
+	inferred, err := ws.analyzeRelationships(personID, content)
+	if err != nil {
+		return nil, err
+	}
+
+	connections, err := ws.wikidataConnections(ctx, personID, title)
+	if err != nil {
+		log.Printf("Wikidata relationships unavailable for %s: %v", title, err)
+		return inferred, nil
+	}
+
+	// Wikidata wins over text analysis for the same pair of people
+	covered := map[string]bool{}
+	for _, conn := range connections {
+		covered[conn.Source+"|"+conn.Target] = true
+		covered[conn.Target+"|"+conn.Source] = true
+	}
+	for _, conn := range inferred {
+		if !covered[conn.Source+"|"+conn.Target] {
+			connections = append(connections, conn)
+		}
+	}
+	return connections, nil
+}
+
+// wikidataConnections turns the relationship claims on a person's Wikidata
+// item into connections. Related people without an English Wikipedia
+// article are skipped, since they could never be scraped.
+func (ws *WikipediaScraper) wikidataConnections(ctx context.Context, personID, title string) ([]Connection, error) {
+	qid, err := ws.wikidata.Resolve(ctx, title)
+	if err != nil {
+		return nil, err
+	}
+	facts, err := ws.wikidata.Facts(ctx, qid)
+	if err != nil {
+		return nil, err
+	}
+
+	name := facts.Label
+	if name == "" {
+		name = title
+	}
+
+	var connections []Connection
+	for _, link := range facts.Relations {
+		targetID := createIDFromName(link.Title)
+		if link.Title == "" || targetID == personID {
+			continue
+		}
+		relation := wikidataRelations[link.Property]
+		conn := Connection{
+			Source:      personID,
+			Target:      targetID,
+			Type:        relation.Type,
+			Strength:    relation.Strength,
+			Description: fmt.Sprintf("%s: %s %s (Wikidata %s)", name, relation.Label, link.Title, link.Property),
+			Confidence:  ConfidenceHigh,
+		}
+		if relation.Reverse {
+			conn.Source, conn.Target = conn.Target, conn.Source
+		}
+		connections = append(connections, conn)
+	}
+	return connections, nil
 }
 
 // Analyze text to find relationships with other known historical figures
 func (ws *WikipediaScraper) analyzeRelationships(sourceID string, content string) ([]Connection, error) {
 	var connections []Connection
 
-	// Get all known people for checking
+	// Find the known people the article mentions
+	lowerContent := strings.ToLower(content)
 	ws.mu.RLock()
-	knownNames := make(map[string]bool)
-	for name := range ws.knownNames {
-		knownNames[name] = true
-	}
+	mentioned := ws.knownNames.find(lowerContent)
+	minStrength := ws.minStrength
 	ws.mu.RUnlock()
 
 	// Keywords indicating relationships
@@ -132,10 +418,10 @@ func (ws *WikipediaScraper) analyzeRelationships(sourceID string, content string
 		"rival":      {"rival", "opponent", "adversary", "competed", "disagreed", "disputed", "contested"},
 		"friend":     {"friend", "companion", "close to", "confidant"},
 		"admired":    {"admired", "respected", "honored", "looked up to", "esteemed"},
+		"spouse":     {"married", "wife", "husband", "spouse"},
 	}
 
-	// Check content for each known person
-	for name := range knownNames {
+	for _, name := range mentioned {
 		targetID := createIDFromName(name)
 
 		// Skip self-relationships
@@ -143,21 +429,19 @@ func (ws *WikipediaScraper) analyzeRelationships(sourceID string, content string
 			continue
 		}
 
-		// Look for the name in content
-		if strings.Contains(strings.ToLower(content), name) {
-			// Find relationship type by analyzing surrounding text
-			relationType, strength, description := ws.determineRelationship(content, name, relationshipPatterns)
-
-			if relationType != "" {
-				connection := Connection{
-					Source:      sourceID,
-					Target:      targetID,
-					Type:        relationType,
-					Strength:    strength,
-					Description: description,
-				}
-				connections = append(connections, connection)
+		// Find relationship type by analyzing surrounding text
+		relationType, strength, description := ws.determineRelationship(content, name, relationshipPatterns)
+
+		if relationType != "" && strength >= minStrength {
+			connection := Connection{
+				Source:      sourceID,
+				Target:      targetID,
+				Type:        relationType,
+				Strength:    strength,
+				Description: description,
+				Confidence:  ConfidenceLow,
 			}
+			connections = append(connections, connection)
 		}
 	}
 
@@ -204,7 +488,7 @@ func (ws *WikipediaScraper) determineRelationship(content, targetName string, pa
 	// If no specific relationship is found but they are mentioned together,
 	// consider it a general "connection"
 	if len(relevantParagraphs) > 0 {
-		return "associated", 3, ws.extractRelevantSentence(relevantParagraphs[0], "", targetName)
+		return AssociatedType, 3, ws.extractRelevantSentence(relevantParagraphs[0], "", targetName)
 	}
 
 	return "", 0, ""
@@ -275,38 +559,78 @@ func (ws *WikipediaScraper) calculateRelationshipStrength(paragraphs []string, k
 // Helper functions for information extraction
 
 func (ws *WikipediaScraper) extractLifespan(doc *goquery.Document, person *Person) {
-	// Look for birth and death dates in the infobox
-	birthDateText := doc.Find(".infobox .bday").Text()
-	deathDateText := doc.Find(".infobox .dday").Text()
-
-	// Extract years using regex
-	birthYear := extractYear(birthDateText)
-	deathYear := extractYear(deathDateText)
-
-	// If not found in specific fields, try to find in general text
-	if birthYear == 0 || deathYear == 0 {
-		// Check the first paragraph for birth-death pattern
-		firstPara := doc.Find("#mw-content-text p").First().Text()
-		years := extractYearsFromText(firstPara)
+	// Prefer the infobox: the machine-readable bday/dday spans, then the
+	// readable Born/Died rows, which are the only dates given for BCE figures
+	birth, _ := ParseHistoricalDate(doc.Find(".infobox .bday").First().Text())
+	if birth.IsZero() {
+		birth, _ = LeadingDate(infoboxValue(doc, "Born"))
+	}
+	death, _ := ParseHistoricalDate(doc.Find(".infobox .dday").First().Text())
+	if death.IsZero() {
+		death, _ = LeadingDate(infoboxValue(doc, "Died"))
+	}
+	setLifespan(person, birth, death, firstParagraph(doc))
+}
 
-		if len(years) >= 1 && birthYear == 0 {
-			birthYear = years[0]
+// setLifespan stores the birth and death dates found in an infobox, falling
+// back to the dates in parentheses after the name in the opening paragraph
+func setLifespan(person *Person, birth, death HistoricalDate, opening string) {
+	if birth.IsZero() || death.IsZero() {
+		textBirth, textDeath := FindLifespan(opening)
+		if birth.IsZero() {
+			birth = textBirth
 		}
-		if len(years) >= 2 && deathYear == 0 {
-			deathYear = years[1]
+		if death.IsZero() {
+			death = textDeath
 		}
 	}
 
-	person.YearBirth = birthYear
-	if deathYear != 0 {
-		person.YearDeath = deathYear
+	// A floruit date says when someone was active, not when they were born
+	if birth.Floruit {
+		person.Floruit = &birth
+	} else if !birth.IsZero() {
+		person.Birth = &birth
 	}
+	if !death.IsZero() {
+		person.Death = &death
+	}
+	person.normalizeDates()
+}
+
+// infoboxValue returns the text of the infobox row with the given label
+func infoboxValue(doc *goquery.Document, label string) string {
+	var value string
+	doc.Find(".infobox tr").EachWithBreak(func(i int, row *goquery.Selection) bool {
+		if strings.TrimSpace(row.Find("th").First().Text()) == label {
+			value = cleanText(row.Find("td").First().Text())
+			return false
+		}
+		return true
+	})
+	return value
+}
+
+// firstParagraph returns the article's opening paragraph, skipping empty ones
+func firstParagraph(doc *goquery.Document) string {
+	var text string
+	doc.Find("#mw-content-text p").EachWithBreak(func(i int, p *goquery.Selection) bool {
+		text = strings.TrimSpace(p.Text())
+		return text == ""
+	})
+	return text
 }
 
 func (ws *WikipediaScraper) extractProfessionAndEra(doc *goquery.Document, person *Person) {
 	// First paragraph often contains profession
-	firstPara := doc.Find("#mw-content-text p").First().Text()
+	person.Profession = findProfession(doc.Find("#mw-content-text p").First().Text())
+	if person.Profession == "" {
+		person.Profession = "Historical Figure"
+	}
+	setEra(person)
+}
 
+// findProfession returns the first common profession mentioned in text, or ""
+func findProfession(text string) string {
 	// Common profession keywords
 	professions := []string{"philosopher", "scientist", "physicist", "mathematician",
 		"writer", "artist", "politician", "leader", "general",
@@ -314,34 +638,37 @@ func (ws *WikipediaScraper) extractProfessionAndEra(doc *goquery.Document, perso
 		"emperor", "empress", "president", "prime minister"}
 
 	for _, profession := range professions {
-		if strings.Contains(strings.ToLower(firstPara), profession) {
-			person.Profession = strings.Title(profession)
-			break
+		if strings.Contains(strings.ToLower(text), profession) {
+			return strings.Title(profession)
 		}
 	}
+	return ""
+}
 
-	if person.Profession == "" {
-		person.Profession = "Historical Figure"
-	}
-
-	// Determine era based on birth year
-	if person.YearBirth < -800 {
+// setEra places a person in an era from their dates
+func setEra(person *Person) {
+	// Determine era from the middle of the plausible birth range, so an
+	// approximate date isn't placed by whichever bound happens to be written
+	year, known := person.eraYear()
+	if !known {
+		person.Era = "Unknown"
+	} else if year < -800 {
 		person.Era = "Ancient (Pre-Classical)"
-	} else if person.YearBirth < -500 {
+	} else if year < -500 {
 		person.Era = "Classical Antiquity"
-	} else if person.YearBirth < 476 {
+	} else if year < 476 {
 		person.Era = "Ancient"
-	} else if person.YearBirth < 1000 {
+	} else if year < 1000 {
 		person.Era = "Early Medieval"
-	} else if person.YearBirth < 1300 {
+	} else if year < 1300 {
 		person.Era = "High Medieval"
-	} else if person.YearBirth < 1500 {
+	} else if year < 1500 {
 		person.Era = "Late Medieval"
-	} else if person.YearBirth < 1650 {
+	} else if year < 1650 {
 		person.Era = "Renaissance"
-	} else if person.YearBirth < 1800 {
+	} else if year < 1800 {
 		person.Era = "Early Modern"
-	} else if person.YearBirth < 1914 {
+	} else if year < 1914 {
 		person.Era = "Modern"
 	} else {
 		person.Era = "Contemporary"
@@ -395,13 +722,25 @@ func (ws *WikipediaScraper) extractBio(doc *goquery.Document, person *Person) {
 	// Get the first paragraph as a brief bio
 	firstPara := doc.Find("#mw-content-text p").First().Text()
 	// Clean up the text
-	bio := cleanText(firstPara)
+	person.Info = truncateBio(cleanText(firstPara))
+}
 
+// truncateBio shortens a biography to at most 500 bytes
+func truncateBio(bio string) string {
 	if len(bio) > 500 {
-		bio = bio[:497] + "..."
+		return bio[:497] + "..."
 	}
+	return bio
+}
 
-	person.Info = bio
+// firstLine returns the first non-empty line of a plain-text extract
+func firstLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
 }
 
 func (ws *WikipediaScraper) extractContent(doc *goquery.Document) string {
@@ -424,39 +763,37 @@ func (ws *WikipediaScraper) extractContent(doc *goquery.Document) string {
 
 // Utility functions
 
+// latinLetters spells accented Latin letters without their accents, so that
+// IDs for names such as "Ōda Nobunaga" or "Ælfred" stay readable
+var latinLetters = func() *strings.Replacer {
+	var pairs []string
+	for plain, accented := range map[string]string{
+		"a": "àáâãäåāăą", "c": "çćĉċč", "d": "ďđð", "e": "èéêëēĕėęě",
+		"g": "ĝğġģ", "h": "ĥħ", "i": "ìíîïĩīĭįı", "j": "ĵ", "k": "ķ",
+		"l": "ĺļľŀł", "n": "ñńņňŉ", "o": "òóôõöøōŏő", "r": "ŕŗř",
+		"s": "śŝşšș", "t": "ţťŧț", "u": "ùúûüũūŭůűų", "w": "ŵ", "y": "ýÿŷ",
+		"z": "źżž", "ae": "æ", "oe": "œ", "ss": "ß", "th": "þ",
+	} {
+		for _, letter := range accented {
+			pairs = append(pairs, string(letter), plain)
+		}
+	}
+	return strings.NewReplacer(pairs...)
+}()
+
+// idUnsafePattern matches what can't appear in an ID. Letters of scripts
+// without case, such as Chinese or Arabic, are kept.
+var idUnsafePattern = regexp.MustCompile(`[^\p{Ll}\p{Lo}\p{Lm}\p{Mn}\p{Mc}\p{Nd}\-]`)
+
 func createIDFromName(name string) string {
 	// Convert name to lowercase
 	id := strings.ToLower(name)
+	id = latinLetters.Replace(id)
 	// Replace spaces with hyphens
 	id = strings.ReplaceAll(id, " ", "-")
 	// Remove any special characters
-	id = regexp.MustCompile(`[^a-z0-9\-]`).ReplaceAllString(id, "")
-	return id
-}
-
-func extractYear(dateStr string) int {
-	re := regexp.MustCompile(`\b\d{4}\b`)
-	matches := re.FindStringSubmatch(dateStr)
-	if len(matches) > 0 {
-		var year int
-		fmt.Sscanf(matches[0], "%d", &year)
-		return year
-	}
-	return 0
-}
-
-func extractYearsFromText(text string) []int {
-	re := regexp.MustCompile(`\b\d{4}\b`)
-	matches := re.FindAllString(text, -1)
-
-	var years []int
-	for _, match := range matches {
-		var year int
-		fmt.Sscanf(match, "%d", &year)
-		years = append(years, year)
-	}
-
-	return years
+	id = idUnsafePattern.ReplaceAllString(id, "")
+	return strings.Trim(id, "-")
 }
 
 func splitIntoSentences(text string) []string {
@@ -474,6 +811,79 @@ func splitIntoSentences(text string) []string {
 	return result
 }
 
+// nameIndex holds lowercased names by their first word, so that the names
+// mentioned in a text are found in one pass over it rather than one search
+// per name, which matters once a dump import has made thousands known
+type nameIndex map[string][]string
+
+// add adds a lowercased name to the index
+func (ix nameIndex) add(name string) {
+	first := name[:wordEnd(name, 0)]
+	for _, known := range ix[first] {
+		if known == name {
+			return
+		}
+	}
+	ix[first] = append(ix[first], name)
+}
+
+// find returns the names occurring in the lowercased text, sorted. A name
+// must start at the start of a word but may end inside one, so "plato" is
+// found in "platonic".
+func (ix nameIndex) find(text string) []string {
+	found := map[string]bool{}
+	// Names starting with punctuation can't be found by their first word
+	for _, name := range ix[""] {
+		if strings.Contains(text, name) {
+			found[name] = true
+		}
+	}
+
+	wordStart := true
+	for start, r := range text {
+		if !isWordRune(r) {
+			wordStart = true
+			continue
+		}
+		if !wordStart {
+			continue
+		}
+		wordStart = false
+		// The name's first word may be any prefix of this word
+		end := wordEnd(text, start)
+		for i := start; i < end; {
+			_, size := utf8.DecodeRuneInString(text[i:])
+			i += size
+			for _, name := range ix[text[start:i]] {
+				if strings.HasPrefix(text[start:], name) {
+					found[name] = true
+				}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// wordEnd returns the index just past the word starting at start
+func wordEnd(s string, start int) int {
+	for i, r := range s[start:] {
+		if !isWordRune(r) {
+			return start + i
+		}
+	}
+	return len(s)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
 func cleanText(text string) string {
 	// Remove Wikipedia citations [1], [2], etc.
 	text = regexp.MustCompile(`\[\d+\]`).ReplaceAllString(text, "")
@@ -485,8 +895,8 @@ func cleanText(text string) string {
 }
 
 func determineGroup(era, profession string) int {
-	// Simple group assignment based on era and profession
-	// This can be expanded to be more sophisticated
+	// Provisional group based on era, until POST /api/analytics/communities
+	// assigns groups from the actual relationship structure
 	switch era {
 	case "Ancient", "Classical Antiquity", "Ancient (Pre-Classical)":
 		return 1
@@ -504,109 +914,3 @@ func determineGroup(era, profession string) int {
 		return 7
 	}
 }
-
-// WikipediaAPI provides a way to use Wikipedia's API for more structured data
-func (ws *WikipediaScraper) WikipediaAPI(query string) (map[string]interface{}, error) {
-	url := fmt.Sprintf("https://en.wikipedia.org/w/api.php?action=query&format=json&prop=extracts&exintro=true&redirects=1&titles=%s",
-		strings.ReplaceAll(query, " ", "_"))
-
-	resp, err := ws.client.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
-	}
-
-	return result, nil
-}
-
-// BatchScrapeHistoricalFigures scrapes information for multiple historical figures
-func (ws *WikipediaScraper) BatchScrapeHistoricalFigures(names []string) ([]*Person, error) {
-	var people []*Person
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	errCh := make(chan error, len(names))
-
-	for _, name := range names {
-		wg.Add(1)
-		go func(name string) {
-			defer wg.Done()
-
-			// Throttle requests to be kind to Wikipedia
-			time.Sleep(1 * time.Second)
-
-			person, err := ws.ScrapeHistoricalFigure(name)
-			if err != nil {
-				log.Printf("Error scraping %s: %v", name, err)
-				errCh <- err
-				return
-			}
-
-			mu.Lock()
-			people = append(people, person)
-			mu.Unlock()
-		}(name)
-	}
-
-	wg.Wait()
-	close(errCh)
-
-	// Check if there were any errors
-	for err := range errCh {
-		if err != nil {
-			return people, fmt.Errorf("some scraping operations failed: %w", err)
-		}
-	}
-
-	return people, nil
-}
-
-// BatchFindRelationships finds relationships for multiple historical figures
-func (ws *WikipediaScraper) BatchFindRelationships(personIDs []string) ([]Connection, error) {
-	var allConnections []Connection
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	errCh := make(chan error, len(personIDs))
-
-	for _, id := range personIDs {
-		wg.Add(1)
-		go func(id string) {
-			defer wg.Done()
-
-			// Throttle requests to be kind to Wikipedia
-			time.Sleep(1 * time.Second)
-
-			connections, err := ws.FindRelationships(id)
-			if err != nil {
-				log.Printf("Error finding relationships for %s: %v", id, err)
-				errCh <- err
-				return
-			}
-
-			mu.Lock()
-			allConnections = append(allConnections, connections...)
-			mu.Unlock()
-		}(id)
-	}
-
-	wg.Wait()
-	close(errCh)
-
-	// Check if there were any errors
-	for err := range errCh {
-		if err != nil {
-			return allConnections, fmt.Errorf("some relationship operations failed: %w", err)
-		}
-	}
-
-	return allConnections, nil
-}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNameIndexFind(t *testing.T) {
+	ix := nameIndex{}
+	for _, name := range []string{"plato", "socrates", "isaac newton", "émilie du châtelet", "newton", "(pseudo-)dionysius", "plato"} {
+		ix.add(name)
+	}
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"socrates taught plato.", []string{"plato", "socrates"}},
+		{"a platonic dialogue", []string{"plato"}},
+		{"isaac newton read émilie du châtelet's translation", []string{"isaac newton", "newton", "émilie du châtelet"}},
+		{"the isaac newtonian", []string{"isaac newton", "newton"}},
+		{"isaac wrote to anewton", nil},
+		{"the works of (pseudo-)dionysius", []string{"(pseudo-)dionysius"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got := ix.find(tt.text)
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("find(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+	if len(ix["plato"]) != 1 {
+		t.Errorf("plato indexed %d times", len(ix["plato"]))
+	}
+}
+
+func TestAnalyzeRelationships(t *testing.T) {
+	ws := NewWikipediaScraper()
+	for _, name := range []string{"Socrates", "Plato", "Xenophon", "Aristotle"} {
+		ws.addName(name)
+	}
+	content := "Plato was a student of Socrates.\nXenophon was a friend of Socrates.\nPlato founded the Academy."
+	connections, err := ws.analyzeRelationships("socrates", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var targets []string
+	for _, conn := range connections {
+		if conn.Source != "socrates" || conn.Confidence != ConfidenceLow {
+			t.Errorf("unexpected connection %+v", conn)
+		}
+		targets = append(targets, conn.Target)
+	}
+	if want := []string{"plato", "xenophon"}; !reflect.DeepEqual(targets, want) {
+		t.Errorf("targets = %v, want %v", targets, want)
+	}
+}